@@ -35,5 +35,6 @@ $GCLOUD compute ssh --zone=${ZONE} cybozu@${INSTANCE_NAME} --command="sudo -H /h
 STATUSCODE=$?
 mkdir -p ~/test-results/junit/
 $GCLOUD compute scp --zone=${ZONE} cybozu@${INSTANCE_NAME}:/tmp/junit.xml ~/test-results/junit/
+$GCLOUD compute scp --recurse --zone=${ZONE} cybozu@${INSTANCE_NAME}:/tmp/diagnostics ~/test-results/ || true
 
 exit ${STATUSCODE}
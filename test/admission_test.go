@@ -24,11 +24,11 @@ spec:
     image: quay.io/cybozu/ubuntu:20.04
     command: ["pause"]
 `
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(podYAML), "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(podYAML), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 
 		By("confirming that a emptyDir is added")
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "get", "pod", "pod-mutator-test", "-o", "json")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "get", "pod", "pod-mutator-test", "-o", "json")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 
 		po := new(corev1.Pod)
@@ -65,7 +65,7 @@ spec:
       ports:
       - 8000
 `
-		_, stderr, err := ExecAtWithInput(boot0, []byte(networkPolicyYAML), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(networkPolicyYAML), "kubectl", "apply", "-f", "-")
 		Expect(err).To(HaveOccurred())
 		Expect(string(stderr)).Should(ContainSubstring(`admission webhook "vnetworkpolicy.kb.io" denied the request`))
 	})
@@ -88,10 +88,10 @@ spec:
           port: 80
 `
 		By("creating HTTPProxy without annotations")
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(httpProxyYAML), "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(httpProxyYAML), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "get", "-n", "default", "httpproxy/bad", "-o", "json")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "get", "-n", "default", "httpproxy/bad", "-o", "json")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 
 		hp := &unstructured.Unstructured{}
@@ -100,10 +100,10 @@ spec:
 		Expect(hp.GetAnnotations()).To(HaveKeyWithValue("kubernetes.io/ingress.class", "forest"))
 
 		By("updating HTTPProxy to remove annotations")
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "annotate", "-n", "default", "httpproxy/bad", "kubernetes.io/ingress.class-")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "annotate", "-n", "default", "httpproxy/bad", "kubernetes.io/ingress.class-")
 		Expect(err).To(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 
-		stdout, stderr, err = ExecAtWithInput(boot0, []byte(httpProxyYAML), "kubectl", "delete", "-f", "-")
+		stdout, stderr, err = ExecAtWithInput(cfg.Boot0, []byte(httpProxyYAML), "kubectl", "delete", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 	})
 
@@ -129,30 +129,30 @@ spec:
 		name := "valid"
 		project := "default"
 		repoURL := "https://github.com/cybozu-go/neco-apps.git"
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(fmt.Sprintf(applicationTmplYAML, name, project, repoURL)),
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(fmt.Sprintf(applicationTmplYAML, name, project, repoURL)),
 			"kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
-		ExecSafeAt(boot0, "kubectl", "delete", "application", name)
+		ExecSafeAt(cfg.Boot0, "kubectl", "delete", "application", name)
 
 		By("denying to create Application which points to maneki-apps repo and belongs to default project")
 		name = "invalid"
 		repoURL = "https://github.com/cybozu-private/maneki-apps.git"
-		stdout, stderr, err = ExecAtWithInput(boot0, []byte(fmt.Sprintf(applicationTmplYAML, name, project, repoURL)),
+		stdout, stderr, err = ExecAtWithInput(cfg.Boot0, []byte(fmt.Sprintf(applicationTmplYAML, name, project, repoURL)),
 			"kubectl", "apply", "-f", "-")
 		Expect(err).To(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 	})
 
 	It("should validate deletion", func() {
 		By("trying to delete a namespace")
-		_, _, err := ExecAt(boot0, "kubectl", "delete", "namespace", "internet-egress")
+		_, _, err := ExecAt(cfg.Boot0, "kubectl", "delete", "namespace", "internet-egress")
 		Expect(err).Should(HaveOccurred())
 
 		By("trying to delete a CRD")
-		_, _, err = ExecAt(boot0, "kubectl", "delete", "crd", "applications.argoproj.io")
+		_, _, err = ExecAt(cfg.Boot0, "kubectl", "delete", "crd", "applications.argoproj.io")
 		Expect(err).Should(HaveOccurred())
 
 		By("trying to delete a CephCluster")
-		_, _, err = ExecAt(boot0, "kubectl", "delete", "-n", "ceph-hdd", "cephclusters.ceph.rook.io", "ceph-hdd")
+		_, _, err = ExecAt(cfg.Boot0, "kubectl", "delete", "-n", "ceph-hdd", "cephclusters.ceph.rook.io", "ceph-hdd")
 		Expect(err).Should(HaveOccurred())
 	})
 }
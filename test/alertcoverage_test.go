@@ -0,0 +1,176 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/neco-apps/test/vmrule"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// vmRulesDir is the directory of VMRules relative to this package.
+	vmRulesDir = "../monitoring/base/victoriametrics/rules"
+	// vmalertTestDir is the directory of promtool unit tests for the VMRules.
+	vmalertTestDir = "vmalert_test"
+)
+
+// untestedAlerts is the list of alerts accepted to lack an alert_rule_test.
+// The value is the reason.  Remove the entry when a test is added.
+var untestedAlerts = map[string]string{
+	"ContourBastionDown": "same as ContourGlobalDown except the namespace",
+	"ContourForestDown":  "same as ContourGlobalDown except the namespace",
+	"IngressBastionDown": "same as IngressGlobalDown except the namespace",
+	"IngressForestDown":  "same as IngressGlobalDown except the namespace",
+}
+
+// promtoolTestFile is a unit test file of promtool.
+type promtoolTestFile struct {
+	RuleFiles []string `json:"rule_files"`
+	Tests     []struct {
+		AlertRuleTests []struct {
+			Alertname string `json:"alertname"`
+		} `json:"alert_rule_test"`
+	} `json:"tests"`
+}
+
+// alertCoverage is the test coverage of an alert.
+type alertCoverage struct {
+	Alert  string
+	Source string
+	Tests  []string
+}
+
+// collectAlertCoverage returns the coverage of the alerts defined in ruleDir by the promtool tests in testDir.
+// The rule files referenced by the tests are matched to the VMRule files by their base names
+// because the tests load the files converted by vmrule-convert.
+// It also returns the problems in the tests, such as alert_rule_test for alerts not defined in the loaded rule files.
+func collectAlertCoverage(ruleDir, testDir string) ([]*alertCoverage, []string, error) {
+	rules, err := vmrule.LoadDir(ruleDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var coverage []*alertCoverage
+	byFile := make(map[string]map[string]*alertCoverage)
+	for _, vr := range rules {
+		file := filepath.Base(vr.Source)
+		if byFile[file] == nil {
+			byFile[file] = make(map[string]*alertCoverage)
+		}
+		for _, g := range vr.Groups {
+			for _, r := range g.Rules {
+				if r.Alert == "" || byFile[file][r.Alert] != nil {
+					continue
+				}
+				c := &alertCoverage{Alert: r.Alert, Source: file}
+				byFile[file][r.Alert] = c
+				coverage = append(coverage, c)
+			}
+		}
+	}
+
+	testFiles, err := filepath.Glob(filepath.Join(testDir, "*.yaml"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(testFiles)
+
+	var problems []string
+	for _, tf := range testFiles {
+		data, err := ioutil.ReadFile(tf)
+		if err != nil {
+			return nil, nil, err
+		}
+		var pt promtoolTestFile
+		if err := yaml.Unmarshal(data, &pt); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", tf, err)
+		}
+
+		testName := filepath.Base(tf)
+		for _, rf := range pt.RuleFiles {
+			if byFile[filepath.Base(rf)] == nil {
+				problems = append(problems, fmt.Sprintf("%s: rule file %s is not a VMRule file in %s", testName, rf, ruleDir))
+			}
+		}
+		for _, t := range pt.Tests {
+			for _, art := range t.AlertRuleTests {
+				found := false
+				for _, rf := range pt.RuleFiles {
+					c := byFile[filepath.Base(rf)][art.Alertname]
+					if c == nil {
+						continue
+					}
+					found = true
+					if !containsString(c.Tests, testName) {
+						c.Tests = append(c.Tests, testName)
+					}
+				}
+				if !found {
+					problems = append(problems, fmt.Sprintf("%s: alert %s is not defined in the rule files", testName, art.Alertname))
+				}
+			}
+		}
+	}
+
+	sort.Slice(coverage, func(i, j int) bool {
+		if coverage[i].Source != coverage[j].Source {
+			return coverage[i].Source < coverage[j].Source
+		}
+		return coverage[i].Alert < coverage[j].Alert
+	})
+	return coverage, problems, nil
+}
+
+// formatAlertCoverage returns a table of the coverage.
+func formatAlertCoverage(coverage []*alertCoverage) string {
+	var sb strings.Builder
+	tested := 0
+	for _, c := range coverage {
+		tests := strings.Join(c.Tests, ",")
+		switch {
+		case tests != "":
+			tested++
+		case untestedAlerts[c.Alert] != "":
+			tests = "(waived: " + untestedAlerts[c.Alert] + ")"
+		default:
+			tests = "-"
+		}
+		fmt.Fprintf(&sb, "%-40s %-50s %s\n", c.Source, c.Alert, tests)
+	}
+	fmt.Fprintf(&sb, "%d/%d alerts are tested\n", tested, len(coverage))
+	return sb.String()
+}
+
+func testAlertRuleCoverage(t *testing.T) {
+	coverage, problems, err := collectAlertCoverage(vmRulesDir, vmalertTestDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Error(p)
+	}
+
+	defined := make(map[string]bool)
+	for _, c := range coverage {
+		defined[c.Alert] = true
+		_, waived := untestedAlerts[c.Alert]
+		switch {
+		case len(c.Tests) == 0 && !waived:
+			t.Errorf("alert %s in %s is not tested by alert_rule_test in %s", c.Alert, c.Source, vmalertTestDir)
+		case len(c.Tests) > 0 && waived:
+			t.Errorf("alert %s is tested; remove it from untestedAlerts", c.Alert)
+		}
+	}
+	for alert := range untestedAlerts {
+		if !defined[alert] {
+			t.Errorf("alert %s in untestedAlerts is not defined", alert)
+		}
+	}
+
+	t.Logf("alert rule test coverage:\n%s", formatAlertCoverage(coverage))
+}
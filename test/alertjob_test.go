@@ -0,0 +1,164 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/neco-apps/test/manifest"
+	"github.com/cybozu-go/neco-apps/test/vmrule"
+	promlabels "github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pushedJobs are the jobs pushed to Pushgateway instead of being scraped.
+// They are collected by the agents scraping the pushgateway job because it honors the pushed labels.
+var pushedJobs = map[string]string{
+	"ingress-watcher": "ingress-watcher on the boot servers",
+}
+
+const pushgatewayJob = "pushgateway"
+
+// collectScrapeJobs returns the jobs scraped by agent in idx.
+func collectScrapeJobs(idx *manifest.Index, agent *VMAgent) (map[string]bool, error) {
+	jobs := make(map[string]bool)
+	for _, s := range []struct {
+		kind     string
+		selector *metav1.LabelSelector
+	}{
+		{"VMServiceScrape", agent.Spec.ServiceScrapeSelector},
+		{"VMPodScrape", agent.Spec.PodScrapeSelector},
+		{"VMNodeScrape", agent.Spec.NodeScrapeSelector},
+	} {
+		objs, err := idx.Select(s.kind, s.selector)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid selector for %s: %w", agent.Name, s.kind, err)
+		}
+		for _, obj := range objs {
+			var r VMScrapeOrRule
+			if err := obj.Decode(&r); err != nil {
+				return nil, err
+			}
+			for _, rcs := range r.endpointRelabelConfigs() {
+				if job := explicitJob(rcs); job != "" {
+					jobs[job] = true
+				}
+			}
+		}
+	}
+	if jobs[pushgatewayJob] {
+		for job := range pushedJobs {
+			jobs[job] = true
+		}
+	}
+	return jobs, nil
+}
+
+// jobMatchers returns the distinct matchers of the job label in expr.  Negative matchers are ignored.
+func jobMatchers(expr string) ([]*promlabels.Matcher, error) {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	var matchers []*promlabels.Matcher
+	seen := make(map[string]bool)
+	parser.Inspect(e, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		for _, m := range vs.LabelMatchers {
+			if m.Name != "job" || (m.Type != promlabels.MatchEqual && m.Type != promlabels.MatchRegexp) {
+				continue
+			}
+			if !seen[m.String()] {
+				seen[m.String()] = true
+				matchers = append(matchers, m)
+			}
+		}
+		return nil
+	})
+	return matchers, nil
+}
+
+// matchingJobs returns the jobs that match m.
+func matchingJobs(m *promlabels.Matcher, jobs map[string]bool) []string {
+	var matched []string
+	for job := range jobs {
+		if m.Matches(job) {
+			matched = append(matched, job)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+func testAlertRuleJobs(t *testing.T) {
+	vmBaseDir := filepath.Join("monitoring", "base", "victoriametrics")
+	idx := loadSourceIndex(t, vmBaseDir)
+
+	agents := make(map[string]map[string]bool)
+	for _, name := range []string{"vmagent-smallset", "vmagent-largeset"} {
+		var agent VMAgent
+		decodeVMObject(t, idx, "VMAgent", name, &agent)
+		jobs, err := collectScrapeJobs(idx, &agent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		agents[name] = jobs
+	}
+	allJobs := make(map[string]bool)
+	for _, jobs := range agents {
+		for job := range jobs {
+			allJobs[job] = true
+		}
+	}
+
+	var smallsetVMAlert VMAlert
+	decodeVMObject(t, idx, "VMAlert", "vmalert-smallset", &smallsetVMAlert)
+
+	rules, err := vmrule.LoadDir(vmRulesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallsetRules, err := vmrule.Select(rules, smallsetVMAlert.Spec.RuleSelector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallset := make(map[*vmrule.VMRule]bool)
+	for _, vr := range smallsetRules {
+		smallset[vr] = true
+	}
+
+	for _, vr := range rules {
+		file := filepath.Base(vr.Source)
+		for _, g := range vr.Groups {
+			for _, r := range g.Rules {
+				if r.Alert == "" {
+					continue
+				}
+				matchers, err := jobMatchers(r.Expr)
+				if err != nil {
+					t.Errorf("%s: alert %s: %v", file, r.Alert, err)
+					continue
+				}
+				for _, m := range matchers {
+					jobs := matchingJobs(m, allJobs)
+					if len(jobs) == 0 {
+						t.Errorf("%s: alert %s: no scrape produces %s", file, r.Alert, m)
+						continue
+					}
+					if !smallset[vr] {
+						continue
+					}
+					if len(matchingJobs(m, agents["vmagent-smallset"])) == 0 {
+						t.Errorf("%s: smallset alert %s: %s is only scraped by vmagent-largeset: %s", file, r.Alert, m, strings.Join(jobs, ", "))
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/neco-apps/test/vmrule"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+)
+
+// alertSeverities is the allowed values of the severity label.
+// See monitoring/README.md for their meanings.
+var alertSeverities = []string{"info", "warning", "error", "critical"}
+
+// defaultScrapeInterval is the default of spec.scrapeInterval of VMAgent.
+const defaultScrapeInterval = 30 * time.Second
+
+// alertsWithoutFor is the list of alerts allowed to lack "for".
+// They fire immediately because their expressions already look back over a range.
+var alertsWithoutFor = map[string]string{
+	"CKELeaderChangesFrequently":      "changes over 30m",
+	"CKENearlyDown":                   "avg_over_time over 15m",
+	"CKERestartsFrequently":           "changes over 15m",
+	"KubeClientCertificateExpiration": "histogram_quantile of the expiration",
+}
+
+// runbookPlaceholder is the runbook annotation of the alerts whose runbooks are not written yet.
+const runbookPlaceholder = "TBD"
+
+// alertsWithoutRunbook is the list of alerts allowed to lack a runbook or to have runbookPlaceholder.
+// Do not add new alerts; write their runbooks instead.  Remove an alert when its runbook is written.
+var alertsWithoutRunbook = map[string]string{
+	"BootServerNotHealthy":                             "sabakan alerts are waiting for the runbook of the boot servers",
+	"CKEDoesNotPerformAnyOps":                          "CKE alerts are waiting for the runbook of CKE",
+	"CKEDown":                                          "CKE alerts are waiting for the runbook of CKE",
+	"CKELeaderChangesFrequently":                       "CKE alerts are waiting for the runbook of CKE",
+	"CKENearlyDown":                                    "CKE alerts are waiting for the runbook of CKE",
+	"CKENoLeader":                                      "CKE alerts are waiting for the runbook of CKE",
+	"CKEOperationTakesLongTime":                        "CKE alerts are waiting for the runbook of CKE",
+	"CKEPerformOps":                                    "CKE alerts are waiting for the runbook of CKE",
+	"CKERebootQueueStuck":                              "CKE alerts are waiting for the runbook of CKE",
+	"CKERestartsFrequently":                            "CKE alerts are waiting for the runbook of CKE",
+	"CKESabakanIntegrationDoesNotPerformAnyOps":        "CKE alerts are waiting for the runbook of CKE",
+	"CKESabakanIntegrationSeemsToBeFailed":             "CKE alerts are waiting for the runbook of CKE",
+	"CertManagerDown":                                  "cert-manager has no runbook for its pods yet",
+	"ElasticOperatorDown":                              "ECK operator has no runbook yet",
+	"IngressDown":                                      "ingress-watcher alerts have no runbook yet",
+	"IngressWatcherDown":                               "ingress-watcher alerts have no runbook yet",
+	"KubeAPIErrorsHigh":                                "imported from kubernetes-mixin without its runbook",
+	"KubeAPILatencyHigh":                               "imported from kubernetes-mixin without its runbook",
+	"KubeClientCertificateExpiration":                  "imported from kubernetes-mixin without its runbook",
+	"KubeClientErrors":                                 "imported from kubernetes-mixin without its runbook",
+	"KubeCronJobRunning":                               "imported from kubernetes-mixin without its runbook",
+	"KubeDaemonSetNotScheduled":                        "imported from kubernetes-mixin without its runbook",
+	"KubeDaemonSetReplicasMismatch":                    "imported from kubernetes-mixin without its runbook",
+	"KubeDaemonSetRolloutStuck":                        "imported from kubernetes-mixin without its runbook",
+	"KubeDeploymentGenerationMismatch":                 "imported from kubernetes-mixin without its runbook",
+	"KubeDeploymentReplicasMismatch":                   "imported from kubernetes-mixin without its runbook",
+	"KubeJobCompletion":                                "imported from kubernetes-mixin without its runbook",
+	"KubeJobFailed":                                    "imported from kubernetes-mixin without its runbook",
+	"KubeNodeNotReady":                                 "imported from kubernetes-mixin without its runbook",
+	"KubeNodeUnschedulable":                            "imported from kubernetes-mixin without its runbook",
+	"KubePodCrashLooping":                              "imported from kubernetes-mixin without its runbook",
+	"KubePodNotReady":                                  "imported from kubernetes-mixin without its runbook",
+	"KubePodNotReadyWithContainersReady":               "imported from kubernetes-mixin without its runbook",
+	"KubePodScheduledNotReady":                         "imported from kubernetes-mixin without its runbook",
+	"KubeStateMetricsDown":                             "imported from kubernetes-mixin without its runbook",
+	"KubeStateMetricsListErrors":                       "imported from kube-state-metrics without a runbook",
+	"KubeStateMetricsWatchErrors":                      "imported from kube-state-metrics without a runbook",
+	"KubeStatefulSetGenerationMismatch":                "imported from kubernetes-mixin without its runbook",
+	"KubeStatefulSetReplicasMismatch":                  "imported from kubernetes-mixin without its runbook",
+	"KubeStatefulSetUpdateNotRolledOut":                "imported from kubernetes-mixin without its runbook",
+	"KubeVersionMismatch":                              "imported from kubernetes-mixin without its runbook",
+	"KubeletTooManyPods":                               "imported from kubernetes-mixin without its runbook",
+	"NecoAdmissionControllerRuntimeWebhookLatencyHigh": "neco-admission alerts have no runbook yet",
+	"NecoAdmissionRestClientLatencyHigh":               "neco-admission alerts have no runbook yet",
+	"PersistentVolumeUsageRapidIncrease":               "the runbook depends on the tenant owning the volume",
+	"PushGatewayDown":                                  "monitoring components have no runbook yet",
+	"SabakanDown":                                      "sabakan alerts are waiting for the runbook of the boot servers",
+	"SabakanMachineUnavailable10":                      "sabakan alerts are waiting for the runbook of the boot servers",
+	"VMAgentLargesetDown":                              "monitoring components have no runbook yet",
+	"VMAgentSmallsetDown":                              "monitoring components have no runbook yet",
+	"VMAlertLargesetDown":                              "monitoring components have no runbook yet",
+	"VMAlertSmallsetDown":                              "monitoring components have no runbook yet",
+	"VMAlertmanagerLargesetDown":                       "monitoring components have no runbook yet",
+	"VMAlertmanagerSmallsetDown":                       "monitoring components have no runbook yet",
+	"VMInsertLargesetDown":                             "monitoring components have no runbook yet",
+	"VMOperatorDown":                                   "monitoring components have no runbook yet",
+	"VMSelectLargesetDown":                             "monitoring components have no runbook yet",
+	"VMSingleSmallsetDown":                             "monitoring components have no runbook yet",
+	"VMStorageLargesetDown":                            "monitoring components have no runbook yet",
+}
+
+// hasRunbook returns true if r has a runbook other than runbookPlaceholder.
+func hasRunbook(r *vmrule.Rule) bool {
+	runbook := strings.TrimSpace(r.Annotations["runbook"])
+	return runbook != "" && runbook != runbookPlaceholder
+}
+
+// runbookLinkPattern matches the links to the markdown files in this repository.
+var runbookLinkPattern = regexp.MustCompile(`https://github\.com/cybozu-go/neco-apps/blob/[^/\s"]+/([^#\s"]+\.md)#([^\s")]+)`)
+
+// maxScrapeInterval returns the longest scrape interval of the VMAgents defined in the YAML files in dir.
+func maxScrapeInterval(dir string) (time.Duration, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "vmagent-*.yaml"))
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no VMAgent manifests in %s", dir)
+	}
+
+	max := time.Duration(0)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return 0, err
+		}
+		var agent struct {
+			Spec struct {
+				ScrapeInterval string `json:"scrapeInterval"`
+			} `json:"spec"`
+		}
+		if err := yaml.Unmarshal(data, &agent); err != nil {
+			return 0, fmt.Errorf("%s: %w", file, err)
+		}
+		interval := defaultScrapeInterval
+		if agent.Spec.ScrapeInterval != "" {
+			interval, err = time.ParseDuration(agent.Spec.ScrapeInterval)
+			if err != nil {
+				return 0, fmt.Errorf("%s: invalid scrapeInterval: %w", file, err)
+			}
+		}
+		if interval > max {
+			max = interval
+		}
+	}
+	return max, nil
+}
+
+// markdownAnchors returns the anchors of the headings in the markdown file in the way GitHub generates them.
+func markdownAnchors(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	anchors := make(map[string]bool)
+	counts := make(map[string]int)
+	add := func(heading string) {
+		anchor := githubAnchor(heading)
+		if n := counts[anchor]; n > 0 {
+			anchors[fmt.Sprintf("%s-%d", anchor, n)] = true
+		} else {
+			anchors[anchor] = true
+		}
+		counts[anchor]++
+	}
+
+	var prev string
+	inCode := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			inCode = !inCode
+			prev = ""
+			continue
+		case inCode:
+			continue
+		case strings.HasPrefix(line, "#"):
+			add(strings.TrimLeft(line, "#"))
+		case prev != "" && trimmed != "" && (strings.Trim(trimmed, "=") == "" || strings.Trim(trimmed, "-") == ""):
+			// setext heading
+			add(prev)
+			line = ""
+		}
+		prev = strings.TrimSpace(line)
+	}
+	return anchors, scanner.Err()
+}
+
+// githubAnchor converts heading into the anchor.
+func githubAnchor(heading string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case r == ' ':
+			sb.WriteRune('-')
+		case r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') || r > 0x7f:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// lintAlertRule returns the problems of an alerting rule.
+// anchors returns the anchors of the markdown file whose path is relative to the repository root.
+func lintAlertRule(r *vmrule.Rule, scrapeInterval time.Duration, anchors func(string) (map[string]bool, error)) []string {
+	var problems []string
+	severity := r.Labels["severity"]
+	switch {
+	case severity == "":
+		problems = append(problems, "severity label is missing")
+	case !containsString(alertSeverities, severity):
+		problems = append(problems, fmt.Sprintf("severity %q is not one of %v", severity, alertSeverities))
+	}
+
+	if strings.TrimSpace(r.Annotations["summary"]) == "" {
+		problems = append(problems, "summary annotation is missing")
+	}
+
+	runbook := strings.TrimSpace(r.Annotations["runbook"])
+	if _, ok := alertsWithoutRunbook[r.Alert]; !ok {
+		switch runbook {
+		case "":
+			problems = append(problems, "runbook annotation is missing")
+		case runbookPlaceholder:
+			problems = append(problems, fmt.Sprintf("runbook is the placeholder %q", runbookPlaceholder))
+		}
+	}
+	for _, m := range runbookLinkPattern.FindAllStringSubmatch(runbook, -1) {
+		file, anchor := m[1], m[2]
+		as, err := anchors(file)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("runbook link to %s: %v", file, err))
+		case !as[anchor]:
+			problems = append(problems, fmt.Sprintf("runbook link to %s: heading #%s does not exist", file, anchor))
+		}
+	}
+
+	if r.For == "" {
+		if _, ok := alertsWithoutFor[r.Alert]; !ok {
+			problems = append(problems, "for is missing")
+		}
+	} else if d, err := time.ParseDuration(r.For); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid for: %v", err))
+	} else if d < scrapeInterval {
+		problems = append(problems, fmt.Sprintf("for %s is shorter than the scrape interval %s", r.For, scrapeInterval))
+	}
+	return problems
+}
+
+func testAlertRuleLint(t *testing.T) {
+	scrapeInterval, err := maxScrapeInterval(filepath.Dir(vmRulesDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := vmrule.LoadDir(vmRulesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchorCache := make(map[string]map[string]bool)
+	anchors := func(file string) (map[string]bool, error) {
+		if as, ok := anchorCache[file]; ok {
+			return as, nil
+		}
+		as, err := markdownAnchors(filepath.Join(manifestDir, file))
+		if err != nil {
+			return nil, err
+		}
+		anchorCache[file] = as
+		return as, nil
+	}
+
+	problems := make(map[string][]string)
+	withoutRunbook := make(map[string]bool)
+	for _, vr := range rules {
+		file := filepath.Base(vr.Source)
+		for _, g := range vr.Groups {
+			for i := range g.Rules {
+				r := &g.Rules[i]
+				if r.Alert == "" {
+					continue
+				}
+				if !hasRunbook(r) {
+					withoutRunbook[r.Alert] = true
+				}
+				for _, p := range lintAlertRule(r, scrapeInterval, anchors) {
+					problems[file] = append(problems[file], fmt.Sprintf("group %q: alert %s: %s", g.Name, r.Alert, p))
+				}
+			}
+		}
+	}
+
+	files := make([]string, 0, len(problems))
+	for file := range problems {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		t.Errorf("%s:\n  %s", file, strings.Join(problems[file], "\n  "))
+	}
+
+	for alert := range alertsWithoutRunbook {
+		if !withoutRunbook[alert] {
+			t.Errorf("alert %s has a runbook or does not exist; remove it from alertsWithoutRunbook", alert)
+		}
+	}
+}
+
+func TestLintAlertRule(t *testing.T) {
+	anchors := func(file string) (map[string]bool, error) {
+		if file != "DEVELOPMENT.md" {
+			return nil, fmt.Errorf("open %s: no such file or directory", file)
+		}
+		return map[string]bool{githubAnchor("Out of sync"): true}, nil
+	}
+	link := "https://github.com/cybozu-go/neco-apps/blob/main/DEVELOPMENT.md#"
+
+	testCases := []struct {
+		name     string
+		rule     vmrule.Rule
+		expected []string
+	}{
+		{"ok", vmrule.Rule{
+			Alert:       "AppOutOfSync",
+			For:         "10m",
+			Labels:      map[string]string{"severity": "error"},
+			Annotations: map[string]string{"summary": "out of sync", "runbook": "See " + link + "out-of-sync"},
+		}, nil},
+		{"missing", vmrule.Rule{Alert: "Foo"}, []string{
+			"severity label is missing",
+			"summary annotation is missing",
+			"runbook annotation is missing",
+			"for is missing",
+		}},
+		{"invalid", vmrule.Rule{
+			Alert:       "Foo",
+			For:         "10s",
+			Labels:      map[string]string{"severity": "fatal"},
+			Annotations: map[string]string{"summary": "foo", "runbook": link + "no-such-heading " + strings.Replace(link, "DEVELOPMENT", "README", 1) + "foo"},
+		}, []string{
+			`severity "fatal" is not one of [info warning error critical]`,
+			"runbook link to DEVELOPMENT.md: heading #no-such-heading does not exist",
+			"runbook link to README.md: open README.md: no such file or directory",
+			"for 10s is shorter than the scrape interval 30s",
+		}},
+		{"placeholder", vmrule.Rule{
+			Alert:       "Foo",
+			For:         "10m",
+			Labels:      map[string]string{"severity": "error"},
+			Annotations: map[string]string{"summary": "foo", "runbook": "TBD"},
+		}, []string{
+			`runbook is the placeholder "TBD"`,
+		}},
+		{"waived", vmrule.Rule{
+			Alert:       "CKEDown",
+			For:         "10m",
+			Labels:      map[string]string{"severity": "error"},
+			Annotations: map[string]string{"summary": "CKE is down", "runbook": "TBD"},
+		}, nil},
+	}
+	for _, tc := range testCases {
+		actual := lintAlertRule(&tc.rule, defaultScrapeInterval, anchors)
+		if !cmp.Equal(actual, tc.expected) {
+			t.Errorf("%s: %s", tc.name, cmp.Diff(tc.expected, actual))
+		}
+	}
+}
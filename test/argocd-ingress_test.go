@@ -11,7 +11,7 @@ import (
 )
 
 func prepareArgoCDIngress() {
-	argocdFQDN := testID + "-argocd.gcp0.dev-ne.co"
+	argocdFQDN := cfg.TestID + "-argocd.gcp0.dev-ne.co"
 	It("should create HTTPProxy for ArgoCD", func() {
 		manifest := fmt.Sprintf(`
 apiVersion: projectcontour.io/v1
@@ -51,13 +51,13 @@ spec:
         idle: 5m
 `, argocdFQDN)
 
-		_, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 	})
 }
 
 func testArgoCDIngress() {
-	argocdFQDN := testID + "-argocd.gcp0.dev-ne.co"
+	argocdFQDN := cfg.TestID + "-argocd.gcp0.dev-ne.co"
 	It("should confirm Argo CD functionalities", func() {
 		By("confirming created Certificate")
 		Eventually(func() error {
@@ -66,7 +66,7 @@ func testArgoCDIngress() {
 
 		By("logging in to Argo CD")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "argocd", "login", argocdFQDN,
+			stdout, stderr, err := ExecAt(cfg.Boot0, "argocd", "login", argocdFQDN,
 				"--insecure", "--username", "admin", "--password", loadArgoCDPassword())
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -75,7 +75,7 @@ func testArgoCDIngress() {
 		}).Should(Succeed())
 
 		By("requesting to web UI with https")
-		stdout, stderr, err := ExecAt(boot0,
+		stdout, stderr, err := ExecAt(cfg.Boot0,
 			"curl", "-skL", "https://"+argocdFQDN,
 			"-o", "/dev/null",
 			"-w", `'%{http_code}\n%{content_type}'`,
@@ -86,7 +86,7 @@ func testArgoCDIngress() {
 		Expect(s[1]).To(Equal("text/html; charset=utf-8"))
 
 		By("requesting to argocd-dex-server via argocd-server with https")
-		stdout, stderr, err = ExecAt(boot0,
+		stdout, stderr, err = ExecAt(cfg.Boot0,
 			"curl", "-skL", "https://"+argocdFQDN+"/api/dex/.well-known/openid-configuration",
 			"-o", "/dev/null",
 			"-w", `'%{http_code}\n%{content_type}'`,
@@ -97,7 +97,7 @@ func testArgoCDIngress() {
 		Expect(s[1]).To(Equal("application/json"))
 
 		By("requesting to argocd-server with gRPC")
-		stdout, stderr, err = ExecAt(boot0,
+		stdout, stderr, err = ExecAt(cfg.Boot0,
 			"curl", "-skL", "https://"+argocdFQDN+"/account.AccountService/Read",
 			"-H", "'Content-Type: application/grpc'",
 			"-o", "/dev/null",
@@ -109,7 +109,7 @@ func testArgoCDIngress() {
 		Expect(s[1]).To(Equal("application/grpc"))
 
 		By("requesting to argocd-server with gRPC-Web")
-		stdout, stderr, err = ExecAt(boot0,
+		stdout, stderr, err = ExecAt(cfg.Boot0,
 			"curl", "-skL", "https://"+argocdFQDN+"/application.ApplicationService/Read",
 			"-H", "'Content-Type: application/grpc-web+proto'",
 			"-o", "/dev/null",
@@ -0,0 +1,260 @@
+// +build !kind
+
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// appRecoveryPolicy decides how appWaiter recovers applications whose operation does not end.
+//
+// Syncing network-policy app may cause temporal network disruption.
+// It leads to ArgoCD's improper behavior. In spite of the app becomes Synced/Healthy, the operation does not end.
+// TODO: This is workaround for ArgoCD's improper behavior. When this issue (T.B.D.) is closed, delete this policy.
+type appRecoveryPolicy struct {
+	// TerminateStuckOperations enables to terminate the stuck operation and to sync the app again.
+	TerminateStuckOperations bool
+
+	// StuckAfter is the duration for which an operation keeps running on a Synced/Healthy app
+	// before it is considered stuck.
+	StuckAfter time.Duration
+
+	// MaxAttempts is the maximum number of recoveries per app.  Zero means unlimited.
+	MaxAttempts int
+}
+
+// appWaiter waits for Argo CD applications to become Synced and Healthy.
+type appWaiter struct {
+	// Apps is the names of the applications to wait for.
+	Apps []string
+
+	// Revision is the expected target revision of the applications.
+	// It is not checked if empty.
+	Revision string
+
+	// SkipRevision is the names of the applications whose revision is not checked.
+	SkipRevision map[string]bool
+
+	// StableFor is the duration for which all applications should keep ready.
+	StableFor time.Duration
+
+	// Recovery is the recovery policy of stuck operations.
+	Recovery appRecoveryPolicy
+
+	// Out is where the progress is printed.
+	Out io.Writer
+}
+
+var applicationGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Application"}
+
+// appProgress is the progress of an application observed by appWaiter.
+type appProgress struct {
+	summary    string
+	stuckSince time.Time
+	recoveries int
+}
+
+// Wait waits until all applications keep ready for StableFor.
+// If ctx is done before that, the returned error describes the resources that prevent each application from being ready.
+func (w *appWaiter) Wait(ctx context.Context) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(applicationGVK)
+	lw, err := kube().ListWatch(ctx, "argocd", obj, fields.Everything())
+	if err != nil {
+		return err
+	}
+	store, controller := cache.NewInformer(lw, &unstructured.Unstructured{}, 0, cache.ResourceEventHandlerFuncs{})
+	go controller.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), controller.HasSynced) {
+		return errors.New("failed to list applications")
+	}
+
+	progress := make(map[string]*appProgress)
+	for _, name := range w.Apps {
+		progress[name] = &appProgress{}
+	}
+
+	var readySince time.Time
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		apps, err := w.get(store)
+		if err != nil {
+			return err
+		}
+
+		allReady := true
+		for _, name := range w.Apps {
+			app := apps[name]
+			p := progress[name]
+			summary := w.summary(name, app)
+			if summary != p.summary {
+				fmt.Fprintf(w.Out, "%s %s\n", time.Now().Format(time.RFC3339), summary)
+				p.summary = summary
+			}
+			if w.ready(name, app) {
+				continue
+			}
+			allReady = false
+			if app != nil {
+				w.recover(ctx, app, p)
+			}
+		}
+
+		switch {
+		case !allReady:
+			readySince = time.Time{}
+		case readySince.IsZero():
+			readySince = time.Now()
+		case time.Since(readySince) >= w.StableFor:
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("applications are not ready: %w\n%s", ctx.Err(), w.report(apps))
+		case <-ticker.C:
+		}
+	}
+}
+
+// get returns the applications in store by name.
+func (w *appWaiter) get(store cache.Store) (map[string]*Application, error) {
+	apps := make(map[string]*Application)
+	for _, obj := range store.List() {
+		app, err := decodeApplication(obj.(*unstructured.Unstructured))
+		if err != nil {
+			return nil, err
+		}
+		apps[app.Name] = app
+	}
+	return apps, nil
+}
+
+// decodeApplication converts u into Application.
+func decodeApplication(u *unstructured.Unstructured) (*Application, error) {
+	app := new(Application)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), app); err != nil {
+		return nil, fmt.Errorf("failed to decode application %s: %w", u.GetName(), err)
+	}
+	return app, nil
+}
+
+// ready returns true if app is Synced and Healthy at the expected revision without operations.
+func (w *appWaiter) ready(name string, app *Application) bool {
+	if app == nil {
+		return false
+	}
+	if w.Revision != "" && !w.SkipRevision[name] && app.Status.Sync.ComparedTo.Source.TargetRevision != w.Revision {
+		return false
+	}
+	return app.Status.Sync.Status == SyncStatusCodeSynced &&
+		app.Status.Health.Status == HealthStatusHealthy &&
+		app.Operation == nil
+}
+
+// stuck returns true if the operation of app keeps running even though app is Synced and Healthy.
+func stuck(app *Application) bool {
+	return app.Status.Sync.Status == SyncStatusCodeSynced &&
+		app.Status.Health.Status == HealthStatusHealthy &&
+		app.Operation != nil &&
+		app.Status.OperationState != nil &&
+		app.Status.OperationState.Phase == OperationRunning
+}
+
+// recover terminates the stuck operation of app and syncs it again as directed by the recovery policy.
+func (w *appWaiter) recover(ctx context.Context, app *Application, p *appProgress) {
+	if !w.Recovery.TerminateStuckOperations || !stuck(app) {
+		p.stuckSince = time.Time{}
+		return
+	}
+	if p.stuckSince.IsZero() {
+		p.stuckSince = time.Now()
+	}
+	if time.Since(p.stuckSince) < w.Recovery.StuckAfter {
+		return
+	}
+	if w.Recovery.MaxAttempts > 0 && p.recoveries >= w.Recovery.MaxAttempts {
+		return
+	}
+	p.recoveries++
+	p.stuckSince = time.Time{}
+
+	fmt.Fprintf(w.Out, "%s terminate unexpected operation: app=%s\n", time.Now().Format(time.RFC3339), app.Name)
+	res, err := ExecContext(ctx, cfg.Boot0, "argocd", "app", "terminate-op", app.Name)
+	if err != nil {
+		fmt.Fprintf(w.Out, "failed to terminate operation: %s: %v\n", res, err)
+		return
+	}
+	syncCtx, cancel := context.WithTimeout(ctx, argoCDSyncTimeout)
+	defer cancel()
+	res, err = ExecContextStream(syncCtx, cfg.Boot0, w.Out, "argocd", "app", "sync", app.Name)
+	if err != nil {
+		fmt.Fprintf(w.Out, "failed to sync application: %s: %v\n", res, err)
+	}
+}
+
+// summary returns a one-line status of app.
+func (w *appWaiter) summary(name string, app *Application) string {
+	if app == nil {
+		return name + ": not found"
+	}
+	phase := "-"
+	if app.Status.OperationState != nil {
+		phase = string(app.Status.OperationState.Phase)
+	}
+	return fmt.Sprintf("%s: sync=%s health=%s operation=%s revision=%s",
+		name, app.Status.Sync.Status, app.Status.Health.Status, phase, app.Status.Sync.ComparedTo.Source.TargetRevision)
+}
+
+// report describes the applications that are not ready and their resources that are OutOfSync, Degraded or Missing.
+func (w *appWaiter) report(apps map[string]*Application) string {
+	names := append([]string(nil), w.Apps...)
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		app := apps[name]
+		if w.ready(name, app) {
+			continue
+		}
+		fmt.Fprintln(&sb, w.summary(name, app))
+		if app == nil {
+			continue
+		}
+		if st := app.Status.OperationState; st != nil && st.Message != "" {
+			fmt.Fprintf(&sb, "  operation: %s\n", st.Message)
+		}
+		for _, r := range app.Status.Resources {
+			var health HealthStatus
+			if r.Health != nil {
+				health = *r.Health
+			}
+			if r.Status != SyncStatusCodeOutOfSync && health.Status != HealthStatusDegraded && health.Status != HealthStatusMissing {
+				continue
+			}
+			kind := r.Kind
+			if r.Group != "" {
+				kind += "." + r.Group
+			}
+			fmt.Fprintf(&sb, "  %s %s/%s: sync=%s health=%s", kind, r.Namespace, r.Name, r.Status, health.Status)
+			if health.Message != "" {
+				fmt.Fprintf(&sb, " (%s)", health.Message)
+			}
+			fmt.Fprintln(&sb)
+		}
+	}
+	return sb.String()
+}
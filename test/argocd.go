@@ -19,9 +19,20 @@ type ApplicationSpec struct {
 }
 
 type ApplicationStatus struct {
-	Sync           SyncStatus      `json:"sync,omitempty" protobuf:"bytes,2,opt,name=sync"`
-	Health         HealthStatus    `json:"health,omitempty" protobuf:"bytes,3,opt,name=health"`
-	OperationState *OperationState `json:"operationState,omitempty" protobuf:"bytes,7,opt,name=operationState"`
+	Sync           SyncStatus       `json:"sync,omitempty" protobuf:"bytes,2,opt,name=sync"`
+	Health         HealthStatus     `json:"health,omitempty" protobuf:"bytes,3,opt,name=health"`
+	OperationState *OperationState  `json:"operationState,omitempty" protobuf:"bytes,7,opt,name=operationState"`
+	Resources      []ResourceStatus `json:"resources,omitempty" protobuf:"bytes,1,opt,name=resources"`
+}
+
+type ResourceStatus struct {
+	Group     string         `json:"group,omitempty" protobuf:"bytes,1,opt,name=group"`
+	Version   string         `json:"version,omitempty" protobuf:"bytes,2,opt,name=version"`
+	Kind      string         `json:"kind,omitempty" protobuf:"bytes,3,opt,name=kind"`
+	Namespace string         `json:"namespace,omitempty" protobuf:"bytes,4,opt,name=namespace"`
+	Name      string         `json:"name,omitempty" protobuf:"bytes,5,opt,name=name"`
+	Status    SyncStatusCode `json:"status,omitempty" protobuf:"bytes,6,opt,name=status"`
+	Health    *HealthStatus  `json:"health,omitempty" protobuf:"bytes,7,opt,name=health"`
 }
 
 type Operation struct {
@@ -51,7 +62,8 @@ type ApplicationSource struct {
 }
 
 type HealthStatus struct {
-	Status HealthStatusCode `json:"status,omitempty" protobuf:"bytes,1,opt,name=status"`
+	Status  HealthStatusCode `json:"status,omitempty" protobuf:"bytes,1,opt,name=status"`
+	Message string           `json:"message,omitempty" protobuf:"bytes,2,opt,name=message"`
 }
 
 type HealthStatusCode string
@@ -74,7 +86,9 @@ const (
 )
 
 type OperationState struct {
-	Phase OperationPhase `json:"phase" protobuf:"bytes,2,opt,name=phase"`
+	Phase     OperationPhase `json:"phase" protobuf:"bytes,2,opt,name=phase"`
+	Message   string         `json:"message,omitempty" protobuf:"bytes,3,opt,name=message"`
+	StartedAt metav1.Time    `json:"startedAt" protobuf:"bytes,6,opt,name=startedAt"`
 }
 
 type OperationPhase string
@@ -19,7 +19,7 @@ func testBMCReverseProxy() {
 	It("should be accessed via https", func() {
 		By("confirming it has be successfully deployed")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=bmc-reverse-proxy",
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=bmc-reverse-proxy",
 				"get", "deployment", "bmc-reverse-proxy", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -40,13 +40,13 @@ func testBMCReverseProxy() {
 
 		By("confirming ConfigMap has been created")
 		// check consistency between "sabactl machines get" and bmc-reverse-proxy ConfigMap.
-		stdout, _, err := ExecAt(boot0, "sabactl", "machines", "get")
+		stdout, _, err := ExecAt(cfg.Boot0, "sabactl", "machines", "get")
 		Expect(err).ShouldNot(HaveOccurred())
 		err = json.Unmarshal(stdout, &machines)
 		Expect(err).ShouldNot(HaveOccurred())
 
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=bmc-reverse-proxy",
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=bmc-reverse-proxy",
 				"get", "configmap", "bmc-reverse-proxy", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -89,7 +89,7 @@ func testBMCReverseProxy() {
 
 		By("confirming HTTPS access")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "bmc-reverse-proxy", "get", "service", "bmc-reverse-proxy",
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "bmc-reverse-proxy", "get", "service", "bmc-reverse-proxy",
 				"--output=jsonpath={.status.loadBalancer.ingress[0].ip}")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -72,13 +72,13 @@ spec:
         ports:
           - 8000
 `
-		_, stderr, err := ExecAtWithInput(boot0, []byte(deployYAML), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(deployYAML), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 
 		By("creating HTTPProxy")
-		fqdnHTTP := testID + "-http.test-ingress.gcp0.dev-ne.co"
-		fqdnHTTPS := testID + "-https.test-ingress.gcp0.dev-ne.co"
-		fqdnBastion := testID + "-bastion.test-ingress.gcp0.dev-ne.co"
+		fqdnHTTP := cfg.TestID + "-http.test-ingress.gcp0.dev-ne.co"
+		fqdnHTTPS := cfg.TestID + "-https.test-ingress.gcp0.dev-ne.co"
+		fqdnBastion := cfg.TestID + "-bastion.test-ingress.gcp0.dev-ne.co"
 		ingressRoute := fmt.Sprintf(`
 apiVersion: projectcontour.io/v1
 kind: HTTPProxy
@@ -140,7 +140,7 @@ spec:
         - name: testhttpd
           port: 80
 `, fqdnHTTPS, fqdnHTTP, fqdnBastion)
-		_, stderr, err = ExecAtWithInput(boot0, []byte(ingressRoute), "kubectl", "apply", "-f", "-")
+		_, stderr, err = ExecAtWithInput(cfg.Boot0, []byte(ingressRoute), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 	})
 }
@@ -149,7 +149,7 @@ func testContour() {
 	It("should deploy contour successfully", func() {
 		Eventually(func() error {
 			for _, ns := range ingressNamespaces {
-				stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace="+ns,
+				stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 					"get", "deployment/contour", "-o=json")
 				if err != nil {
 					return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -172,7 +172,7 @@ func testContour() {
 	It("should deploy envoy successfully", func() {
 		Eventually(func() error {
 			for _, ns := range ingressNamespaces {
-				stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace="+ns,
+				stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 					"get", "deployment/envoy", "-o=json")
 				if err != nil {
 					return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -195,7 +195,7 @@ func testContour() {
 	It("should deploy HTTPProxy", func() {
 		By("waiting pods are ready")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "-n", "test-ingress", "get", "deployments/testhttpd", "-o", "json")
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "-n", "test-ingress", "get", "deployments/testhttpd", "-o", "json")
 			if err != nil {
 				return err
 			}
@@ -216,7 +216,7 @@ func testContour() {
 		Eventually(func() error {
 			for _, ns := range ingressNamespaces {
 				pdb := policyv1beta1.PodDisruptionBudget{}
-				stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "poddisruptionbudgets", "contour-pdb", "-n", ns, "-o", "json")
+				stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "poddisruptionbudgets", "contour-pdb", "-n", ns, "-o", "json")
 				if err != nil {
 					return fmt.Errorf("failed to get %s/contour-pdb: %s: %w", ns, stderr, err)
 				}
@@ -233,7 +233,7 @@ func testContour() {
 		By("checking PodDisruptionBudget for envoy Deployment")
 		for _, ns := range ingressNamespaces {
 			pdb := policyv1beta1.PodDisruptionBudget{}
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "poddisruptionbudgets", "envoy-pdb", "-n", ns, "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "poddisruptionbudgets", "envoy-pdb", "-n", ns, "-o", "json")
 			if err != nil {
 				Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 			}
@@ -242,14 +242,14 @@ func testContour() {
 			Expect(pdb.Status.CurrentHealthy).Should(Equal(int32(3)), "namespace=%s", ns)
 		}
 
-		fqdnHTTP := testID + "-http.test-ingress.gcp0.dev-ne.co"
-		fqdnHTTPS := testID + "-https.test-ingress.gcp0.dev-ne.co"
-		fqdnBastion := testID + "-bastion.test-ingress.gcp0.dev-ne.co"
+		fqdnHTTP := cfg.TestID + "-http.test-ingress.gcp0.dev-ne.co"
+		fqdnHTTPS := cfg.TestID + "-https.test-ingress.gcp0.dev-ne.co"
+		fqdnBastion := cfg.TestID + "-bastion.test-ingress.gcp0.dev-ne.co"
 
 		By("getting contour service")
 		var targetIP string
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "get", "-n", "ingress-global", "service/envoy", "-o", "json")
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "get", "-n", "ingress-global", "service/envoy", "-o", "json")
 			if err != nil {
 				return err
 			}
@@ -272,7 +272,7 @@ func testContour() {
 
 		By("confirming generated DNSEndpoint")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "get", "-n", "test-ingress", "dnsendpoint/root", "-o", "json")
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "get", "-n", "test-ingress", "dnsendpoint/root", "-o", "json")
 			if err != nil {
 				return err
 			}
@@ -306,16 +306,16 @@ func testContour() {
 
 		By("accessing with curl: http")
 		Eventually(func() error {
-			_, _, err := ExecAt(boot0, "curl", "--resolve", fqdnHTTP+":80:"+targetIP,
+			_, _, err := ExecAt(cfg.Boot0, "curl", "--resolve", fqdnHTTP+":80:"+targetIP,
 				"http://"+fqdnHTTP+"/testhttpd", "-m", "5", "--fail")
 			return err
 		}).Should(Succeed())
 
 		By("accessing with curl: https")
-		ExecSafeAt(boot0, "HTTPS_PROXY=http://10.0.49.3:3128",
+		ExecSafeAt(cfg.Boot0, "HTTPS_PROXY=http://10.0.49.3:3128",
 			"curl", "-sfL", "-o", "lets.crt", "https://letsencrypt.org/certs/fakelerootx1.pem")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "curl", "-v", "--resolve", fqdnHTTPS+":443:"+targetIP,
+			stdout, stderr, err := ExecAt(cfg.Boot0, "curl", "-v", "--resolve", fqdnHTTPS+":443:"+targetIP,
 				"https://"+fqdnHTTPS+"/",
 				"-m", "5",
 				"--fail",
@@ -329,7 +329,7 @@ func testContour() {
 
 		By("redirecting to https")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "curl", "-I", "--resolve", fqdnHTTPS+":80:"+targetIP,
+			stdout, _, err := ExecAt(cfg.Boot0, "curl", "-I", "--resolve", fqdnHTTPS+":80:"+targetIP,
 				"http://"+fqdnHTTPS+"/",
 				"-m", "5",
 				"--fail",
@@ -349,7 +349,7 @@ func testContour() {
 
 		By("permitting insecure access")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "curl", "-I", "--resolve", fqdnHTTPS+":80:"+targetIP,
+			stdout, _, err := ExecAt(cfg.Boot0, "curl", "-I", "--resolve", fqdnHTTPS+":80:"+targetIP,
 				"http://"+fqdnHTTPS+"/insecure",
 				"-m", "5",
 				"--fail",
@@ -371,7 +371,7 @@ func testContour() {
 		// So at first, access through the valid IP address and expect 200.
 		var bastionIP string
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "get", "-n", "ingress-bastion", "service/envoy", "-o", "json")
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "get", "-n", "ingress-bastion", "service/envoy", "-o", "json")
 			if err != nil {
 				return err
 			}
@@ -393,7 +393,7 @@ func testContour() {
 		}).Should(Succeed())
 
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "curl", "-I", "--resolve", fqdnBastion+":80:"+bastionIP,
+			stdout, _, err := ExecAt(cfg.Boot0, "curl", "-I", "--resolve", fqdnBastion+":80:"+bastionIP,
 				"http://"+fqdnBastion+"/testhttpd",
 				"-m", "5",
 				"--fail",
@@ -410,7 +410,7 @@ func testContour() {
 			return nil
 		}).Should(Succeed())
 
-		stdout, _, err := ExecAt(boot0, "curl", "-I", "--resolve", fqdnBastion+":80:"+targetIP,
+		stdout, _, err := ExecAt(cfg.Boot0, "curl", "-I", "--resolve", fqdnBastion+":80:"+targetIP,
 			"http://"+fqdnBastion+"/testhttpd",
 			"-m", "5",
 			"--fail",
@@ -427,7 +427,7 @@ func getCertificateRequest(cert Certificate, namespace string) (*CertificateRequ
 	var certReqList CertificateRequestList
 	var targetCertReq *CertificateRequest
 
-	stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "-n", namespace, "certificaterequest", "-o", "json")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "-n", namespace, "certificaterequest", "-o", "json")
 	if err != nil {
 		return nil, fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 	}
@@ -453,7 +453,7 @@ OUTER:
 }
 
 func checkCertificate(name, namespace string) error {
-	stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "-n", namespace, "certificate", name, "-o", "json")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "-n", namespace, "certificate", name, "-o", "json")
 	if err != nil {
 		return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 	}
@@ -496,7 +496,7 @@ func checkCertificate(name, namespace string) error {
 				"reason":             st.Reason,
 				"message":            st.Message,
 			})
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "delete", "-n", namespace, "certificates", name)
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "delete", "-n", namespace, "certificates", name)
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
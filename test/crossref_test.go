@@ -0,0 +1,595 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/neco-apps/test/manifest"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// argocdTrackingLabel is added to the top-level objects by Argo CD.
+// Its value is the name of the application.
+const argocdTrackingLabel = "app.kubernetes.io/instance"
+
+// crossRefAllowed allows a dangling reference.
+// Either target or source should be specified.
+type crossRefAllowed struct {
+	// target is the referenced object, e.g. "Secret teleport/teleport-auth-secret".
+	target string
+	// source is the referring object, e.g. "VMServiceScrape monitoring/kubernetes".
+	// This is used for references by label selectors.
+	source string
+	reason string
+}
+
+// crossRefAllowlist lists references to objects that are not rendered from neco-apps.
+var crossRefAllowlist = []crossRefAllowed{
+	// neco-apps-secret
+	{target: "Secret external-dns/clouddns", reason: "provided by neco-apps-secret"},
+	{target: "Secret teleport/teleport-auth-secret", reason: "provided by neco-apps-secret"},
+	{target: "Secret teleport/teleport-proxy-secret", reason: "provided by neco-apps-secret"},
+
+	// Kubernetes
+	{target: "ServiceAccount kube-system/horizontal-pod-autoscaler", reason: "created by kube-controller-manager"},
+	{source: "VMServiceScrape monitoring/kubernetes", reason: "Service default/kubernetes is created by kube-apiserver"},
+
+	// neco
+	{source: "Service internet-egress/unbound-bastion", reason: "unbound Pods are deployed by neco"},
+
+	// operators
+	{target: "Service monitoring/grafana-service", reason: "created by grafana-operator"},
+	{target: "ConfigMap ceph-hdd/rook-ceph-mon-endpoints", reason: "created by Rook"},
+	{target: "ConfigMap ceph-ssd/rook-ceph-mon-endpoints", reason: "created by Rook"},
+	{target: "Service ceph-hdd/rook-ceph-rgw-ceph-hdd-object-store", reason: "created by Rook"},
+	{source: "VMServiceScrape monitoring/rook", reason: "Services of ceph-mgr are created by Rook"},
+	{source: "VMServiceScrape monitoring/vmagent-largeset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vmagent-smallset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vmalert-largeset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vmalert-smallset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vmalertmanager-largeset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vmalertmanager-smallset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vminsert-largeset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vmselect-largeset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vmsingle-smallset", reason: "created by VictoriaMetrics operator"},
+	{source: "VMServiceScrape monitoring/vmstorage-largeset", reason: "created by VictoriaMetrics operator"},
+
+	// upstream manifests
+	{target: "ClusterRole rook-ceph-system-psp-user", reason: "not defined by the Rook chart either"},
+	{target: "ServiceAccount monitoring-system/monitoring-system", reason: "placeholder in the upstream manifests of VictoriaMetrics operator"},
+}
+
+func isAllowedCrossRef(source, target string) bool {
+	for _, a := range crossRefAllowlist {
+		if a.target != "" && a.target == target {
+			return true
+		}
+		if a.source != "" && a.source == source {
+			return true
+		}
+	}
+	return false
+}
+
+func objectRef(kind, namespace, name string) string {
+	if namespace == "" {
+		return kind + " " + name
+	}
+	return kind + " " + namespace + "/" + name
+}
+
+// shrinked version of github.com/projectcontour/contour/apis/projectcontour/v1.HTTPProxy
+type HTTPProxy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Routes []struct {
+			Services []HTTPProxyService `json:"services,omitempty"`
+		} `json:"routes,omitempty"`
+		TCPProxy *struct {
+			Services []HTTPProxyService `json:"services,omitempty"`
+		} `json:"tcpproxy,omitempty"`
+	} `json:"spec"`
+}
+
+type HTTPProxyService struct {
+	Name string `json:"name"`
+	Port int32  `json:"port"`
+}
+
+// shrinked version of github.com/VictoriaMetrics/operator/api/v1beta1.VMServiceScrape
+type VMServiceScrape struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Selector          metav1.LabelSelector `json:"selector"`
+		NamespaceSelector struct {
+			Any        bool     `json:"any,omitempty"`
+			MatchNames []string `json:"matchNames,omitempty"`
+		} `json:"namespaceSelector,omitempty"`
+	} `json:"spec"`
+}
+
+// podTemplatePaths are the paths to the pod templates in workloads.
+var podTemplatePaths = map[string][]string{
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"Deployment":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+}
+
+// podTemplate returns the pod template of a workload.
+func podTemplate(obj *manifest.Object) (*corev1.PodTemplateSpec, error) {
+	var m map[string]interface{}
+	if obj.GetKind() == "Pod" {
+		m = obj.Object
+	} else {
+		path, ok := podTemplatePaths[obj.GetKind()]
+		if !ok {
+			return nil, nil
+		}
+		var err error
+		m, _, err = unstructured.NestedMap(obj.Object, path...)
+		if err != nil || m == nil {
+			return nil, err
+		}
+	}
+	var tmpl corev1.PodTemplateSpec
+	if err := manifest.FromUnstructured(&unstructured.Unstructured{Object: m}, &tmpl); err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// crossRefChecker resolves references between objects deployed to a cluster.
+type crossRefChecker struct {
+	idx *manifest.Index
+
+	// app is the name of the application from which each source was rendered.
+	app map[string]string
+
+	// provided holds objects created by controllers from objects in idx.
+	provided map[string]bool
+
+	// podLabels holds the labels of pod templates in each namespace.
+	podLabels map[string][]labels.Set
+}
+
+func newCrossRefChecker(apps []overlayApp, idx *manifest.Index) (*crossRefChecker, error) {
+	c := &crossRefChecker{
+		idx:       idx,
+		app:       make(map[string]string),
+		provided:  make(map[string]bool),
+		podLabels: make(map[string][]labels.Set),
+	}
+	for _, app := range apps {
+		if app.Dir != "" {
+			c.app[app.Dir] = app.Name
+		}
+	}
+
+	for _, obj := range idx.All() {
+		ns := obj.GetNamespace()
+		switch obj.GetKind() {
+		case "Certificate":
+			secretName, _, _ := unstructured.NestedString(obj.Object, "spec", "secretName")
+			c.provided[objectRef("Secret", ns, secretName)] = true
+		case "SealedSecret":
+			c.provided[objectRef("Secret", ns, obj.GetName())] = true
+		case "ObjectBucketClaim":
+			c.provided[objectRef("Secret", ns, obj.GetName())] = true
+			c.provided[objectRef("ConfigMap", ns, obj.GetName())] = true
+		}
+
+		tmpl, err := podTemplate(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode pod template of %s: %w", objectRef(obj.GetKind(), ns, obj.GetName()), err)
+		}
+		if tmpl != nil {
+			c.podLabels[ns] = append(c.podLabels[ns], labels.Set(tmpl.Labels))
+		}
+	}
+	return c, nil
+}
+
+// labelsOf returns the labels of obj in the cluster.
+func (c *crossRefChecker) labelsOf(obj *manifest.Object) labels.Set {
+	ret := labels.Set{}
+	for k, v := range obj.GetLabels() {
+		ret[k] = v
+	}
+	if app, ok := c.app[obj.Source]; ok {
+		ret[argocdTrackingLabel] = app
+	}
+	return ret
+}
+
+func (c *crossRefChecker) exists(kind, namespace, name string) bool {
+	if c.provided[objectRef(kind, namespace, name)] {
+		return true
+	}
+	return len(c.idx.Lookup(kind, namespace, name)) > 0
+}
+
+func isBuiltinRole(name string) bool {
+	switch name {
+	case "admin", "cluster-admin", "edit", "view", "extension-apiserver-authentication-reader":
+		return true
+	}
+	return strings.HasPrefix(name, "system:")
+}
+
+// check returns the dangling references from obj.
+func (c *crossRefChecker) check(obj *manifest.Object) []string {
+	var problems []string
+	source := objectRef(obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	ns := obj.GetNamespace()
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s: %s (kustomization: %s)", source, fmt.Sprintf(format, args...), obj.Source))
+	}
+	dangling := func(target, format string, args ...interface{}) {
+		if isAllowedCrossRef(source, target) {
+			return
+		}
+		report(format, args...)
+	}
+	requireObject := func(kind, namespace, name, field string) {
+		if c.exists(kind, namespace, name) {
+			return
+		}
+		target := objectRef(kind, namespace, name)
+		dangling(target, "%s refers to %s which does not exist", field, target)
+	}
+
+	tmpl, err := podTemplate(obj)
+	if err != nil {
+		report("%v", err)
+		return problems
+	}
+	if tmpl != nil {
+		for _, vol := range tmpl.Spec.Volumes {
+			field := "volume " + vol.Name
+			switch {
+			case vol.ConfigMap != nil:
+				if vol.ConfigMap.Optional == nil || !*vol.ConfigMap.Optional {
+					requireObject("ConfigMap", ns, vol.ConfigMap.Name, field)
+				}
+			case vol.Secret != nil:
+				if vol.Secret.Optional == nil || !*vol.Secret.Optional {
+					requireObject("Secret", ns, vol.Secret.SecretName, field)
+				}
+			case vol.PersistentVolumeClaim != nil:
+				requireObject("PersistentVolumeClaim", ns, vol.PersistentVolumeClaim.ClaimName, field)
+			case vol.Projected != nil:
+				for _, src := range vol.Projected.Sources {
+					if src.ConfigMap != nil && (src.ConfigMap.Optional == nil || !*src.ConfigMap.Optional) {
+						requireObject("ConfigMap", ns, src.ConfigMap.Name, field)
+					}
+					if src.Secret != nil && (src.Secret.Optional == nil || !*src.Secret.Optional) {
+						requireObject("Secret", ns, src.Secret.Name, field)
+					}
+				}
+			}
+		}
+	}
+
+	switch obj.GetKind() {
+	case "Service":
+		var svc corev1.Service
+		if err := obj.Decode(&svc); err != nil {
+			report("%v", err)
+			return problems
+		}
+		if len(svc.Spec.Selector) == 0 {
+			return problems
+		}
+		sel := labels.SelectorFromSet(svc.Spec.Selector)
+		for _, l := range c.podLabels[ns] {
+			if sel.Matches(l) {
+				return problems
+			}
+		}
+		dangling("", "selector %s matches no pod template", sel)
+
+	case "RoleBinding", "ClusterRoleBinding":
+		var binding rbacv1.RoleBinding
+		if err := obj.Decode(&binding); err != nil {
+			report("%v", err)
+			return problems
+		}
+		switch binding.RoleRef.Kind {
+		case "Role":
+			if !isBuiltinRole(binding.RoleRef.Name) {
+				requireObject("Role", ns, binding.RoleRef.Name, "roleRef")
+			}
+		case "ClusterRole":
+			if !isBuiltinRole(binding.RoleRef.Name) {
+				requireObject("ClusterRole", "", binding.RoleRef.Name, "roleRef")
+			}
+		}
+		for _, s := range binding.Subjects {
+			if s.Kind != "ServiceAccount" || s.Name == "default" {
+				continue
+			}
+			saNamespace := s.Namespace
+			if saNamespace == "" {
+				saNamespace = ns
+			}
+			requireObject("ServiceAccount", saNamespace, s.Name, "subject")
+		}
+
+	case "HTTPProxy":
+		var proxy HTTPProxy
+		if err := obj.Decode(&proxy); err != nil {
+			report("%v", err)
+			return problems
+		}
+		services := []HTTPProxyService{}
+		for _, r := range proxy.Spec.Routes {
+			services = append(services, r.Services...)
+		}
+		if proxy.Spec.TCPProxy != nil {
+			services = append(services, proxy.Spec.TCPProxy.Services...)
+		}
+		for _, s := range services {
+			target := objectRef("Service", ns, s.Name)
+			found := c.idx.Lookup("Service", ns, s.Name)
+			if len(found) == 0 {
+				requireObject("Service", ns, s.Name, "route")
+				continue
+			}
+			var svc corev1.Service
+			if err := found[0].Decode(&svc); err != nil {
+				report("%v", err)
+				continue
+			}
+			hasPort := false
+			for _, p := range svc.Spec.Ports {
+				if p.Port == s.Port {
+					hasPort = true
+				}
+			}
+			if !hasPort {
+				dangling(target, "route refers to port %d of %s which does not exist", s.Port, target)
+			}
+		}
+
+	case "VMServiceScrape":
+		var scrape VMServiceScrape
+		if err := obj.Decode(&scrape); err != nil {
+			report("%v", err)
+			return problems
+		}
+		sel, err := metav1.LabelSelectorAsSelector(&scrape.Spec.Selector)
+		if err != nil {
+			report("%v", err)
+			return problems
+		}
+		namespaces := scrape.Spec.NamespaceSelector.MatchNames
+		if len(namespaces) == 0 {
+			namespaces = []string{ns}
+		}
+		for _, svc := range c.idx.ByKind("Service") {
+			if !scrape.Spec.NamespaceSelector.Any && !containsString(namespaces, svc.GetNamespace()) {
+				continue
+			}
+			if sel.Matches(c.labelsOf(svc)) {
+				return problems
+			}
+		}
+		dangling("", "selector %s matches no Service in %s", sel, strings.Join(namespaces, ","))
+	}
+	return problems
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// testCrossReferences checks references between objects deployed to each cluster.
+// Objects are resolved across all applications of the overlay because some references
+// cross applications, e.g. HTTPProxy in argocd-ingress refers to Service in argocd.
+func testCrossReferences(t *testing.T) {
+	overlays, err := findOverlays()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Parallel()
+	for _, overlay := range overlays {
+		overlay := overlay
+		t.Run(overlay, func(t *testing.T) {
+			t.Parallel()
+
+			apps, idx := loadOverlay(t, overlay)
+			for _, app := range apps {
+				if app.Dir == "" {
+					continue
+				}
+				if err := idx.Err(app.Dir); err != nil {
+					t.Fatalf("failed to render %s: %v", app.Dir, err)
+				}
+			}
+			c, err := newCrossRefChecker(apps, idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, app := range apps {
+				if app.Dir == "" {
+					continue
+				}
+				sub := idx.Source(app.Dir)
+				t.Run(app.Name, func(t *testing.T) {
+					for _, obj := range sub.All() {
+						for _, p := range c.check(obj) {
+							t.Error(p)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestCrossRefChecker(t *testing.T) {
+	const manifests = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+  namespace: foo
+spec:
+  template:
+    metadata:
+      labels:
+        app: foo
+    spec:
+      volumes:
+      - name: config
+        configMap:
+          name: foo-config
+      - name: missing-config
+        configMap:
+          name: missing
+      - name: missing-secret
+        secret:
+          secretName: missing
+      - name: optional-secret
+        secret:
+          secretName: optional
+          optional: true
+      - name: missing-pvc
+        persistentVolumeClaim:
+          claimName: missing
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: external-dns
+  namespace: external-dns
+spec:
+  template:
+    spec:
+      volumes:
+      - name: credentials
+        secret:
+          secretName: clouddns
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo-config
+  namespace: foo
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+  namespace: foo
+spec:
+  selector:
+    app: foo
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: bar
+  namespace: foo
+spec:
+  selector:
+    app: bar
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: foo
+  namespace: foo
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: foo
+  namespace: foo
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: missing
+subjects:
+- kind: ServiceAccount
+  name: foo
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: foo
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: ServiceAccount
+  name: foo
+  namespace: foo
+---
+apiVersion: projectcontour.io/v1
+kind: HTTPProxy
+metadata:
+  name: foo
+  namespace: foo
+spec:
+  routes:
+  - services:
+    - name: foo
+      port: 80
+  - services:
+    - name: foo
+      port: 8080
+`
+	var objs []*unstructured.Unstructured
+	for _, doc := range strings.Split(manifests, "\n---\n") {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(doc), &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		objs = append(objs, obj)
+	}
+	idx := manifest.NewIndex()
+	idx.Add("foo/base", objs)
+	c, err := newCrossRefChecker(nil, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, obj := range idx.All() {
+		actual = append(actual, c.check(obj)...)
+	}
+	expected := []string{
+		"Deployment foo/foo: volume missing-config refers to ConfigMap foo/missing which does not exist (kustomization: foo/base)",
+		"Deployment foo/foo: volume missing-secret refers to Secret foo/missing which does not exist (kustomization: foo/base)",
+		"Deployment foo/foo: volume missing-pvc refers to PersistentVolumeClaim foo/missing which does not exist (kustomization: foo/base)",
+		"Service foo/bar: selector app=bar matches no pod template (kustomization: foo/base)",
+		"RoleBinding foo/foo: roleRef refers to Role foo/missing which does not exist (kustomization: foo/base)",
+		"HTTPProxy foo/foo: route refers to port 8080 of Service foo/foo which does not exist (kustomization: foo/base)",
+	}
+	if !cmp.Equal(actual, expected) {
+		t.Error(cmp.Diff(expected, actual))
+	}
+}
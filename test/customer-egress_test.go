@@ -36,7 +36,7 @@ spec:
         image: quay.io/cybozu/ubuntu-debug:20.04
         name: ubuntu
 `
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(podYAML), "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(podYAML), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 	})
 
@@ -67,7 +67,7 @@ spec:
         image: quay.io/cybozu/ubuntu-debug:20.04
         name: ubuntu
 `
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(podYAMLWIthAnnotation), "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(podYAMLWIthAnnotation), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 	})
 }
@@ -75,7 +75,7 @@ spec:
 func testCustomerEgress() {
 	It("should deploy squid successfully", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=customer-egress",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=customer-egress",
 				"get", "deployment/squid", "-o=json")
 			if err != nil {
 				return err
@@ -96,7 +96,7 @@ func testCustomerEgress() {
 	It("should serve proxy to the Internet", func() {
 		By("executing curl to web page on the Internet with squid")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-nsandbox", "get", "pods", "-l", "custom-egress-test=non-nat", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-nsandbox", "get", "pods", "-l", "custom-egress-test=non-nat", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("stderr: %s: %w", string(stderr), err)
 			}
@@ -108,7 +108,7 @@ func testCustomerEgress() {
 				return fmt.Errorf("podList length is not 1: %d", len(podList.Items))
 			}
 			podName := podList.Items[0].Name
-			stdout, stderr, err = ExecAt(boot0, "kubectl", "-nsandbox", "exec", podName, "--", "curl", "-sf", "--proxy", "http://squid.customer-egress.svc:3128", "cybozu.com")
+			stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "-nsandbox", "exec", podName, "--", "curl", "-sf", "--proxy", "http://squid.customer-egress.svc:3128", "cybozu.com")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -118,7 +118,7 @@ func testCustomerEgress() {
 
 	It("should deploy coil egress successfully", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=customer-egress",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=customer-egress",
 				"get", "deployment/nat", "-o=json")
 			if err != nil {
 				return err
@@ -137,7 +137,7 @@ func testCustomerEgress() {
 
 		By("executing curl to web page on the Internet without squid")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-nsandbox", "get", "pods", "-l", "custom-egress-test=nat", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-nsandbox", "get", "pods", "-l", "custom-egress-test=nat", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("stderr: %s: %w", string(stderr), err)
 			}
@@ -149,7 +149,7 @@ func testCustomerEgress() {
 				return fmt.Errorf("podList length is not 1: %d", len(podList.Items))
 			}
 			podName := podList.Items[0].Name
-			stdout, stderr, err = ExecAt(boot0, "kubectl", "-nsandbox", "exec", podName, "--", "curl", "-sf", "cybozu.com")
+			stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "-nsandbox", "exec", podName, "--", "curl", "-sf", "cybozu.com")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
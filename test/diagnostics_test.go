@@ -0,0 +1,213 @@
+// +build !kind
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	diagnosticsTimeout = 5 * time.Minute
+	diagnosticsLogTail = 200
+)
+
+// diagnosticsCommand is a command run at boot0 to collect the state of a component.
+// The output is saved as <name>.txt in the bundle.
+type diagnosticsCommand struct {
+	name string
+	args []string
+}
+
+// diagnosticsTarget is what is collected when a spec in a test area fails.
+type diagnosticsTarget struct {
+	namespaces []string
+	commands   []diagnosticsCommand
+}
+
+var (
+	diagnosticsMu      sync.Mutex
+	diagnosticsTargets = make(map[string]*diagnosticsTarget)
+)
+
+// registerDiagnostics registers the namespaces and the commands to be collected when a spec in area fails.
+// area is the text of the Context in suite_test.go, such as "rook-ceph".
+// The Context for preparation, such as "preparing rook-ceph", shares the registration.
+// registerDiagnostics can be called multiple times for the same area.
+func registerDiagnostics(area string, namespaces []string, commands ...diagnosticsCommand) {
+	diagnosticsMu.Lock()
+	defer diagnosticsMu.Unlock()
+
+	t := diagnosticsTargets[area]
+	if t == nil {
+		t = &diagnosticsTarget{}
+		diagnosticsTargets[area] = t
+	}
+	t.namespaces = append(t.namespaces, namespaces...)
+	t.commands = append(t.commands, commands...)
+}
+
+// lookupDiagnostics returns the registration for the Context text.
+func lookupDiagnostics(area string) diagnosticsTarget {
+	diagnosticsMu.Lock()
+	defer diagnosticsMu.Unlock()
+
+	t := diagnosticsTargets[strings.TrimPrefix(area, "preparing ")]
+	if t == nil {
+		return diagnosticsTarget{}
+	}
+	return *t
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// collectDiagnostics saves a diagnostics bundle for the current spec if it has failed.
+// Errors in collection are printed and ignored not to hide the original failure.
+func collectDiagnostics() {
+	desc := CurrentGinkgoTestDescription()
+	if !desc.Failed {
+		return
+	}
+
+	// ComponentTexts is ["Test applications", <Context>, ..., <It>].
+	var area string
+	if len(desc.ComponentTexts) > 1 {
+		area = desc.ComponentTexts[1]
+	}
+	target := lookupDiagnostics(area)
+
+	name := fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), unsafeFileChars.ReplaceAllString(desc.FullTestText, "_"))
+	if len(name) > 128 {
+		name = name[:128]
+	}
+	dir := filepath.Join(cfg.DiagnosticsDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(GinkgoWriter, "failed to create diagnostics directory %s: %v\n", dir, err)
+		return
+	}
+	fmt.Printf("collecting diagnostics into %s\n", dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	d := &diagnostics{dir: dir}
+	d.client, d.clientErr = getKube()
+	d.write("failure.txt", []byte(fmt.Sprintf("%s\n%s:%d\n", desc.FullTestText, desc.FileName, desc.LineNumber)))
+	d.command(ctx, diagnosticsCommand{"nodes", []string{"kubectl", "describe", "nodes"}})
+	d.applications(ctx)
+	for _, ns := range target.namespaces {
+		d.namespace(ctx, ns)
+	}
+	for _, c := range target.commands {
+		d.command(ctx, c)
+	}
+}
+
+// diagnostics writes the files of a diagnostics bundle.
+type diagnostics struct {
+	dir       string
+	client    *clusterClient
+	clientErr error
+}
+
+func (d *diagnostics) write(name string, data []byte) {
+	if err := ioutil.WriteFile(filepath.Join(d.dir, name), data, 0644); err != nil {
+		fmt.Fprintf(GinkgoWriter, "failed to write %s: %v\n", name, err)
+	}
+}
+
+// command runs c at boot0 and saves its output.  The output is saved even if c fails.
+func (d *diagnostics) command(ctx context.Context, c diagnosticsCommand) {
+	res, err := ExecContext(ctx, cfg.Boot0, c.args...)
+	data := append(res.Stdout, res.Stderr...)
+	if err != nil {
+		data = append(data, fmt.Sprintf("\n%v\n", err)...)
+	}
+	d.write(c.name+".txt", data)
+}
+
+// applications saves the status of Argo CD applications and the resources that are not ready.
+func (d *diagnostics) applications(ctx context.Context) {
+	d.command(ctx, diagnosticsCommand{"applications", []string{"kubectl", "get", "applications", "-n", "argocd", "-o", "wide"}})
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(applicationGVK)
+	if d.clientErr != nil {
+		d.write("applications-report.txt", []byte(d.clientErr.Error()))
+		return
+	}
+	if err := d.client.List(ctx, "argocd", list, metav1.ListOptions{}); err != nil {
+		d.write("applications-report.txt", []byte(err.Error()))
+		return
+	}
+	w := &appWaiter{}
+	apps := make(map[string]*Application)
+	for i := range list.Items {
+		app, err := decodeApplication(&list.Items[i])
+		if err != nil {
+			continue
+		}
+		apps[app.Name] = app
+		w.Apps = append(w.Apps, app.Name)
+	}
+	d.write("applications-report.txt", []byte(w.report(apps)))
+}
+
+// namespace saves the events, the pods and the recent container logs in ns.
+func (d *diagnostics) namespace(ctx context.Context, ns string) {
+	d.command(ctx, diagnosticsCommand{ns + "-events", []string{"kubectl", "get", "events", "-n", ns, "--sort-by=.lastTimestamp"}})
+	d.command(ctx, diagnosticsCommand{ns + "-pods", []string{"kubectl", "get", "pods", "-n", ns, "-o", "wide"}})
+	d.command(ctx, diagnosticsCommand{ns + "-describe-pods", []string{"kubectl", "describe", "pods", "-n", ns}})
+
+	if d.clientErr != nil {
+		d.write(ns+"-logs.txt", []byte(d.clientErr.Error()))
+		return
+	}
+	pods := new(corev1.PodList)
+	if err := d.client.List(ctx, ns, pods, metav1.ListOptions{}); err != nil {
+		d.write(ns+"-logs.txt", []byte(err.Error()))
+		return
+	}
+
+	logDir := filepath.Join(d.dir, ns+"-logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		fmt.Fprintf(GinkgoWriter, "failed to create %s: %v\n", logDir, err)
+		return
+	}
+	tail := int64(diagnosticsLogTail)
+	for _, pod := range pods.Items {
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, st := range statuses {
+			opts := &corev1.PodLogOptions{Container: st.Name, TailLines: &tail}
+			data, err := d.client.Typed().CoreV1().Pods(ns).GetLogs(pod.Name, opts).DoRaw(ctx)
+			if err != nil {
+				data = append(data, fmt.Sprintf("\n%v\n", err)...)
+			}
+			d.write(filepath.Join(ns+"-logs", pod.Name+"_"+st.Name+".log"), data)
+
+			if st.RestartCount == 0 {
+				continue
+			}
+			opts.Previous = true
+			data, err = d.client.Typed().CoreV1().Pods(ns).GetLogs(pod.Name, opts).DoRaw(ctx)
+			if err != nil {
+				data = append(data, fmt.Sprintf("\n%v\n", err)...)
+			}
+			d.write(filepath.Join(ns+"-logs", pod.Name+"_"+st.Name+".previous.log"), data)
+		}
+	}
+}
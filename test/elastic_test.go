@@ -10,6 +10,10 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
+func init() {
+	registerDiagnostics("elastic", []string{"elastic-system", "sandbox"})
+}
+
 func prepareElastic() {
 	It("should create Elasticsearch cluster", func() {
 		elasticYAML := `
@@ -70,7 +74,7 @@ spec:
         ports:
           - 9200:9400
 `
-		_, stderr, err := ExecAtWithInput(boot0, []byte(elasticYAML), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(elasticYAML), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 	})
 }
@@ -79,7 +83,7 @@ func testElastic() {
 	It("should deploy Elasticsearch cluster", func() {
 		By("confirming elastic-operator is deployed")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=elastic-system",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=elastic-system",
 				"get", "statefulset/elastic-operator", "-o=json")
 			if err != nil {
 				return err
@@ -100,7 +104,7 @@ func testElastic() {
 		By("waiting Elasticsearch resource health becomes green")
 		Eventually(func() error {
 			stdout, stderr, err := ExecAt(
-				boot0,
+				cfg.Boot0,
 				"kubectl", "-n", "sandbox", "get", "elasticsearch/sample",
 				"--template", "'{{ .status.health }}'",
 			)
@@ -114,19 +118,19 @@ func testElastic() {
 		}).Should(Succeed())
 
 		By("accessing to elasticsearch")
-		stdout, stderr, err := ExecAt(boot0,
+		stdout, stderr, err := ExecAt(cfg.Boot0,
 			"kubectl", "get", "secret", "sample-es-elastic-user", "-n", "sandbox", "-o=jsonpath='{.data.elastic}'",
 			"|", "base64", "--decode")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 		password := string(stdout)
 
-		stdout, stderr, err = ExecAt(boot0, "ckecli", "cluster", "get")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "ckecli", "cluster", "get")
 		Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 		cluster := new(ckeCluster)
 		err = yaml.Unmarshal(stdout, cluster)
 		Expect(err).ShouldNot(HaveOccurred())
 		workerAddr := cluster.Nodes[0].Address
-		stdout, stderr, err = ExecAt(boot0,
+		stdout, stderr, err = ExecAt(cfg.Boot0,
 			"ckecli", "ssh", "cybozu@"+workerAddr, "--",
 			"curl", "-u", "elastic:"+password, "-k", "https://sample-es-http.sandbox.svc:9200")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
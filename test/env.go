@@ -1,31 +1,185 @@
 package test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
 	"strconv"
-)
+	"strings"
 
-var (
-	overlayName          = os.Getenv("OVERLAY")
-	doUpgrade            = os.Getenv("UPGRADE") == "1"
-	doReboot             = os.Getenv("REBOOT") == "1"
-	boot0                = os.Getenv("BOOT0")
-	boot1                = os.Getenv("BOOT1")
-	boot2                = os.Getenv("BOOT2")
-	sshKeyFile           = os.Getenv("SSH_PRIVKEY")
-	testID               = os.Getenv("TEST_ID")
-	commitID             = os.Getenv("COMMIT_ID")
-	externalPID          = os.Getenv("EXTERNAL_PID")
-	operationPID         = os.Getenv("OPERATION_PID")
-	numGrafanaDashboard  = 0
-	testSuite            = os.Getenv("SUITE")
-	placematMajorVersion = os.Getenv("PLACEMAT_MAJOR_VERSION")
+	"sigs.k8s.io/yaml"
 )
 
-func init() {
-	var err error
-	numGrafanaDashboard, err = strconv.Atoi(os.Getenv("NUM_DASHBOARD"))
-	if err != nil {
-		panic(err)
+// defaultDiagnosticsDir is placed next to /tmp/junit.xml so that CI can collect both.
+const defaultDiagnosticsDir = "/tmp/diagnostics"
+
+// testConfig is the configuration of the e2e test.
+// It is loaded from the YAML file specified by TEST_CONFIG, then overridden by the environment variables.
+// The field comments show the environment variable for each field.
+type testConfig struct {
+	// Suite is one of "bootstrap", "prepare" and "run".  SUITE
+	Suite string `json:"suite"`
+	// Overlay is the overlay of argocd-config to be deployed.  OVERLAY
+	Overlay string `json:"overlay"`
+	// Upgrade enables the upgrade test.  UPGRADE
+	Upgrade bool `json:"upgrade"`
+	// Reboot enables the reboot test.  REBOOT
+	Reboot bool `json:"reboot"`
+
+	// Boot0, Boot1 and Boot2 are the IP addresses of the boot servers.  BOOT0, BOOT1, BOOT2
+	Boot0 string `json:"boot0"`
+	Boot1 string `json:"boot1"`
+	Boot2 string `json:"boot2"`
+	// SSHPrivKey is the path to the SSH private key for the boot servers.  SSH_PRIVKEY
+	SSHPrivKey string `json:"sshPrivKey"`
+	// PinSSHHostKeys makes the test fail when the SSH host key of a boot server changes.  SSH_PIN_HOST_KEYS
+	PinSSHHostKeys bool `json:"pinSSHHostKeys"`
+
+	// TestID is the prefix of the FQDNs used in the test.  TEST_ID
+	TestID string `json:"testID"`
+	// CommitID is the revision of neco-apps to be deployed.  COMMIT_ID
+	CommitID string `json:"commitID"`
+	// BaseBranch is the revision deployed before the upgrade test.  BASE_BRANCH
+	// If set, the upgrade test waits only for the applications whose manifests differ from it.
+	BaseBranch string `json:"baseBranch"`
+
+	// PlacematMajorVersion is "1" or "2".  PLACEMAT_MAJOR_VERSION
+	PlacematMajorVersion string `json:"placematMajorVersion"`
+	// ExternalPID and OperationPID are the PIDs of the network namespaces for placemat v1.  EXTERNAL_PID, OPERATION_PID
+	ExternalPID  string `json:"externalPID"`
+	OperationPID string `json:"operationPID"`
+
+	// DiagnosticsDir is the directory to save the diagnostics bundles.  DIAGNOSTICS_DIR
+	DiagnosticsDir string `json:"diagnosticsDir"`
+}
+
+// configErrors is the list of problems in the configuration.
+type configErrors []string
+
+func (e configErrors) Error() string {
+	return "invalid test configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// cfg is the configuration of the e2e test.
+// It is loaded at the package initialization because the test containers are built depending on it.
+// cfgErr is reported by Test, so the other tests such as TestValidation are not affected.
+var cfg, cfgErr = loadConfig(os.Getenv)
+
+// loadConfig loads the configuration.  It does not validate the values; call validate for it.
+// Even if it returns an error, the returned configuration is not nil and contains the loaded values.
+func loadConfig(getenv func(string) string) (*testConfig, error) {
+	c := &testConfig{
+		DiagnosticsDir: defaultDiagnosticsDir,
+	}
+	var errs configErrors
+
+	if path := getenv("TEST_CONFIG"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = yaml.UnmarshalStrict(data, c)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("TEST_CONFIG: %v", err))
+		}
+	}
+
+	str := func(name string, p *string) {
+		if v := getenv(name); v != "" {
+			*p = v
+		}
+	}
+	boolean := func(name string, p *bool) {
+		v := getenv(name)
+		if v == "" {
+			return
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %q is not a boolean", name, v))
+			return
+		}
+		*p = b
+	}
+
+	str("SUITE", &c.Suite)
+	str("OVERLAY", &c.Overlay)
+	boolean("UPGRADE", &c.Upgrade)
+	boolean("REBOOT", &c.Reboot)
+	str("BOOT0", &c.Boot0)
+	str("BOOT1", &c.Boot1)
+	str("BOOT2", &c.Boot2)
+	str("SSH_PRIVKEY", &c.SSHPrivKey)
+	boolean("SSH_PIN_HOST_KEYS", &c.PinSSHHostKeys)
+	str("TEST_ID", &c.TestID)
+	str("COMMIT_ID", &c.CommitID)
+	str("BASE_BRANCH", &c.BaseBranch)
+	str("PLACEMAT_MAJOR_VERSION", &c.PlacematMajorVersion)
+	str("EXTERNAL_PID", &c.ExternalPID)
+	str("OPERATION_PID", &c.OperationPID)
+	str("DIAGNOSTICS_DIR", &c.DiagnosticsDir)
+
+	if len(errs) > 0 {
+		return c, errs
+	}
+	return c, nil
+}
+
+// validate checks the values required by the suite.  All problems are reported at once.
+func (c *testConfig) validate() error {
+	var errs configErrors
+	required := func(name, v string) bool {
+		if v == "" {
+			errs = append(errs, name+" is required")
+			return false
+		}
+		return true
+	}
+
+	switch c.Suite {
+	case "bootstrap", "prepare", "run":
+	case "":
+		errs = append(errs, "SUITE is required")
+	default:
+		errs = append(errs, fmt.Sprintf("SUITE: unknown suite %q", c.Suite))
+	}
+
+	for _, b := range []struct {
+		name, value string
+	}{{"BOOT0", c.Boot0}, {"BOOT1", c.Boot1}, {"BOOT2", c.Boot2}} {
+		if required(b.name, b.value) && net.ParseIP(b.value) == nil {
+			errs = append(errs, fmt.Sprintf("%s: %q is not an IP address", b.name, b.value))
+		}
+	}
+	if required("SSH_PRIVKEY", c.SSHPrivKey) {
+		if _, err := os.Stat(c.SSHPrivKey); err != nil {
+			errs = append(errs, fmt.Sprintf("SSH_PRIVKEY: %v", err))
+		}
+	}
+	required("TEST_ID", c.TestID)
+
+	if c.Suite == "bootstrap" || c.Suite == "prepare" {
+		if required("OVERLAY", c.Overlay) {
+			if _, err := os.Stat("../argocd-config/overlays/" + c.Overlay); err != nil {
+				errs = append(errs, fmt.Sprintf("OVERLAY: unknown overlay %q", c.Overlay))
+			}
+		}
+		required("COMMIT_ID", c.CommitID)
+	}
+
+	switch c.PlacematMajorVersion {
+	case "1":
+		if c.Suite == "run" {
+			required("EXTERNAL_PID", c.ExternalPID)
+			required("OPERATION_PID", c.OperationPID)
+		}
+	case "2":
+	default:
+		errs = append(errs, fmt.Sprintf("PLACEMAT_MAJOR_VERSION: unknown version %q", c.PlacematMajorVersion))
+	}
+
+	if len(errs) > 0 {
+		return errs
 	}
+	return nil
 }
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.yaml")
+	err := ioutil.WriteFile(configFile, []byte(`
+suite: run
+boot0: 10.72.48.0
+boot1: 10.72.48.1
+boot2: 10.72.48.2
+testID: test
+placematMajorVersion: "2"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getenv := func(env map[string]string) func(string) string {
+		return func(name string) string { return env[name] }
+	}
+
+	c, err := loadConfig(getenv(map[string]string{
+		"TEST_CONFIG": configFile,
+		"SSH_PRIVKEY": keyFile,
+		"BOOT2":       "10.72.48.3",
+		"REBOOT":      "1",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &testConfig{
+		Suite:                "run",
+		Reboot:               true,
+		Boot0:                "10.72.48.0",
+		Boot1:                "10.72.48.1",
+		Boot2:                "10.72.48.3",
+		SSHPrivKey:           keyFile,
+		TestID:               "test",
+		PlacematMajorVersion: "2",
+		DiagnosticsDir:       defaultDiagnosticsDir,
+	}
+	if !cmp.Equal(c, expected) {
+		t.Error(cmp.Diff(expected, c))
+	}
+	if err := c.validate(); err != nil {
+		t.Error(err)
+	}
+
+	_, err = loadConfig(getenv(map[string]string{
+		"UPGRADE": "yes",
+		"REBOOT":  "no",
+	}))
+	if !cmp.Equal(err, configErrors{`UPGRADE: "yes" is not a boolean`, `REBOOT: "no" is not a boolean`}) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Offline tests must not be affected by the e2e settings.
+	c, err = loadConfig(getenv(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Suite = "prepare"
+	c.Boot0 = "boot-0"
+	c.PlacematMajorVersion = "1"
+	c.Overlay = "no-such-overlay"
+	err = c.validate()
+	expectedErrs := configErrors{
+		`BOOT0: "boot-0" is not an IP address`,
+		"BOOT1 is required",
+		"BOOT2 is required",
+		"SSH_PRIVKEY is required",
+		"TEST_ID is required",
+		`OVERLAY: unknown overlay "no-such-overlay"`,
+		"COMMIT_ID is required",
+	}
+	if !cmp.Equal(err, expectedErrs) {
+		t.Errorf("unexpected error: %s", cmp.Diff(expectedErrs, err))
+	}
+}
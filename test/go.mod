@@ -15,6 +15,7 @@ require (
 	github.com/onsi/gomega v1.10.4
 	github.com/prometheus/client_golang v1.9.0
 	github.com/prometheus/common v0.15.0
+	github.com/prometheus/prometheus v1.8.2-0.20210124145330-b5dfa2414b9e
 	github.com/stretchr/testify v1.6.1 // indirect
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a
@@ -24,7 +25,9 @@ require (
 	gopkg.in/yaml.v3 v3.0.0-20200605160147-a5ece683394c // indirect
 	k8s.io/api v0.19.7
 	k8s.io/apimachinery v0.19.7
+	k8s.io/client-go v0.19.7
 	k8s.io/klog/v2 v2.4.0 // indirect
+	sigs.k8s.io/kustomize/api v0.5.0
 	sigs.k8s.io/structured-merge-diff/v4 v4.0.2 // indirect
 	sigs.k8s.io/yaml v1.2.0
 )
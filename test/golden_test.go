@@ -0,0 +1,48 @@
+package test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+)
+
+// updateGolden makes checkGolden regenerate the golden files instead of comparing with them.
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// vmSelectionGolden lists the custom resources selected by each VMAgent and VMAlert.
+const vmSelectionGolden = "testdata/victoriametrics-selection.yaml"
+
+const goldenHeader = "# Generated by `make update-golden`.  Review the diff before committing.\n"
+
+// checkGolden compares v marshaled in YAML with the golden file at path.
+// If -update is given, it writes v to the file instead.
+func checkGolden(t *testing.T, path string, v interface{}) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := goldenHeader + string(data)
+
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the golden file; run with -update to create it: %v", err)
+	}
+	if string(expected) != actual {
+		t.Errorf("%s mismatch; run with -update if the change is intended: %s", path, cmp.Diff(string(expected), actual))
+	}
+}
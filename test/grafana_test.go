@@ -0,0 +1,508 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// grafanaOperatorDir is the kustomization of the GrafanaDashboards loaded to Grafana in the monitoring namespace.
+const grafanaOperatorDir = "monitoring/base/grafana-operator"
+
+// grafanaDashboard is a dashboard expected to be loaded to Grafana.
+type grafanaDashboard struct {
+	// Name is the name of the GrafanaDashboard.
+	Name string
+	// Title is the title in spec.json.  It is empty if the dashboard is downloaded from spec.url.
+	Title string
+}
+
+func (d grafanaDashboard) String() string {
+	if d.Title == "" {
+		return d.Name
+	}
+	return fmt.Sprintf("%q (%s)", d.Title, d.Name)
+}
+
+// expectedGrafanaDashboards returns the GrafanaDashboards in the rendered manifests of dir relative to manifestDir.
+func expectedGrafanaDashboards(dir string) ([]grafanaDashboard, error) {
+	objs, err := renderer.Objects(filepath.Join(manifestDir, dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var dashboards []grafanaDashboard
+	for _, obj := range objs {
+		if obj.GetKind() != "GrafanaDashboard" {
+			continue
+		}
+		d := grafanaDashboard{Name: obj.GetName()}
+		data, _, err := unstructured.NestedString(obj.Object, "spec", "json")
+		if err != nil {
+			return nil, fmt.Errorf("GrafanaDashboard %s: %w", obj.GetName(), err)
+		}
+		if data != "" {
+			var body struct {
+				Title string `json:"title"`
+			}
+			if err := json.Unmarshal([]byte(data), &body); err != nil {
+				return nil, fmt.Errorf("GrafanaDashboard %s: invalid spec.json: %w", obj.GetName(), err)
+			}
+			if body.Title == "" {
+				return nil, fmt.Errorf("GrafanaDashboard %s: spec.json has no title", obj.GetName())
+			}
+			d.Title = body.Title
+		}
+		dashboards = append(dashboards, d)
+	}
+	sort.Slice(dashboards, func(i, j int) bool { return dashboards[i].Name < dashboards[j].Name })
+	return dashboards, nil
+}
+
+// checkGrafanaDashboards checks that the dashboards titled actual in Grafana are the expected ones.
+// The dashboards downloaded from URLs are only counted because their titles are not known in advance.
+func checkGrafanaDashboards(expected []grafanaDashboard, actual []string) error {
+	remaining := make(map[string]int)
+	for _, title := range actual {
+		remaining[title]++
+	}
+
+	var missing []string
+	var downloaded []string
+	for _, d := range expected {
+		if d.Title == "" {
+			downloaded = append(downloaded, d.Name)
+			continue
+		}
+		if remaining[d.Title] == 0 {
+			missing = append(missing, d.String())
+			continue
+		}
+		remaining[d.Title]--
+	}
+
+	var unknown []string
+	for title, n := range remaining {
+		for i := 0; i < n; i++ {
+			unknown = append(unknown, fmt.Sprintf("%q", title))
+		}
+	}
+	sort.Strings(unknown)
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "not loaded: "+strings.Join(missing, ", "))
+	}
+	switch {
+	case len(downloaded) == 0 && len(unknown) > 0:
+		problems = append(problems, "unexpected: "+strings.Join(unknown, ", "))
+	case len(unknown) != len(downloaded):
+		problems = append(problems, fmt.Sprintf("%d dashboards from URLs (%s) are expected, but found %d other dashboards: [%s]",
+			len(downloaded), strings.Join(downloaded, ", "), len(unknown), strings.Join(unknown, ", ")))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("dashboards mismatch: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func TestCheckGrafanaDashboards(t *testing.T) {
+	expected := []grafanaDashboard{
+		{Name: "argocd", Title: "ArgoCD"},
+		{Name: "coil", Title: "Coil"},
+		{Name: "node-exporter"},
+	}
+
+	testCases := []struct {
+		name     string
+		expected []grafanaDashboard
+		actual   []string
+		err      string
+	}{
+		{"ok", expected, []string{"Coil", "Node Exporter Full", "ArgoCD"}, ""},
+		{"missing", expected, []string{"Coil", "Node Exporter Full"}, `dashboards mismatch: not loaded: "ArgoCD" (argocd)`},
+		{"missing download", expected, []string{"Coil", "ArgoCD"},
+			"dashboards mismatch: 1 dashboards from URLs (node-exporter) are expected, but found 0 other dashboards: []"},
+		{"extra", expected, []string{"Coil", "Node Exporter Full", "ArgoCD", "Extra"},
+			`dashboards mismatch: 1 dashboards from URLs (node-exporter) are expected, but found 2 other dashboards: ["Extra", "Node Exporter Full"]`},
+		{"none", nil, nil, ""},
+		{"unexpected", nil, []string{"Coil"}, `dashboards mismatch: unexpected: "Coil"`},
+	}
+	for _, tc := range testCases {
+		var msg string
+		if err := checkGrafanaDashboards(tc.expected, tc.actual); err != nil {
+			msg = err.Error()
+		}
+		if msg != tc.err {
+			t.Errorf("%s: %s", tc.name, cmp.Diff(tc.err, msg))
+		}
+	}
+}
+
+// grafanaBuiltinVariables are the variables provided by Grafana.
+var grafanaBuiltinVariables = []string{
+	"__interval", "__interval_ms", "__rate_interval", "__range", "__range_s", "__range_ms",
+	"__dashboard", "__from", "__to", "__org", "__user", "__name", "timeFilter",
+}
+
+// grafanaBuiltinDatasources are the special datasources of Grafana.  Their panels are not checked.
+var grafanaBuiltinDatasources = []string{"-- Grafana --", "-- Mixed --", "-- Dashboard --"}
+
+// grafanaVariablePattern matches $var, ${var}, ${var:format} and [[var]].
+// Names starting with a digit are excluded because they are capture group references in label_replace.
+var grafanaVariablePattern = regexp.MustCompile(`\$([A-Za-z_]\w*)|\$\{([A-Za-z_]\w*)(?::[^}]*)?\}|\[\[([A-Za-z_]\w*)(?::[^\]]*)?\]\]`)
+
+// grafanaDataSourceSpec is the spec of GrafanaDataSource.
+type grafanaDataSourceSpec struct {
+	Datasources []struct {
+		Name      string `json:"name"`
+		Type      string `json:"type"`
+		IsDefault bool   `json:"isDefault"`
+	} `json:"datasources"`
+}
+
+// grafanaDashboardSpec is the spec of GrafanaDashboard.
+type grafanaDashboardSpec struct {
+	JSON        string `json:"json"`
+	URL         string `json:"url"`
+	Datasources []struct {
+		InputName      string `json:"inputName"`
+		DatasourceName string `json:"datasourceName"`
+	} `json:"datasources"`
+}
+
+type grafanaVariable struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Query   interface{} `json:"query"`
+	Current struct {
+		Value interface{} `json:"value"`
+	} `json:"current"`
+}
+
+type grafanaTarget struct {
+	Expr       string      `json:"expr"`
+	RefID      string      `json:"refId"`
+	Datasource interface{} `json:"datasource"`
+}
+
+type grafanaPanel struct {
+	Title      string          `json:"title"`
+	Datasource interface{}     `json:"datasource"`
+	Targets    []grafanaTarget `json:"targets"`
+	Panels     []grafanaPanel  `json:"panels"`
+}
+
+// grafanaDashboardBody is the part of the dashboard JSON to be validated.
+type grafanaDashboardBody struct {
+	UID    string         `json:"uid"`
+	Title  string         `json:"title"`
+	Panels []grafanaPanel `json:"panels"`
+	Rows   []struct {
+		Panels []grafanaPanel `json:"panels"`
+	} `json:"rows"`
+	Templating struct {
+		List []grafanaVariable `json:"list"`
+	} `json:"templating"`
+}
+
+// grafanaDashboardChecker validates the dashboard JSON against the datasources.
+type grafanaDashboardChecker struct {
+	// datasources maps the datasource names to their types.
+	datasources map[string]string
+	// defaultType is the type of the default datasource.
+	defaultType string
+}
+
+// check returns the problems of the dashboard JSON data.
+// inputs maps the names in __inputs to the datasource names given by spec.datasources of GrafanaDashboard.
+func (c *grafanaDashboardChecker) check(data string, inputs map[string]string) (*grafanaDashboardBody, []string) {
+	var body grafanaDashboardBody
+	if err := json.Unmarshal([]byte(data), &body); err != nil {
+		return nil, []string{fmt.Sprintf("invalid spec.json: %v", err)}
+	}
+
+	vars := make(map[string]*grafanaVariable)
+	for i := range body.Templating.List {
+		v := &body.Templating.List[i]
+		vars[v.Name] = v
+	}
+
+	var problems []string
+	checkVariables := func(where, query string) {
+		for _, m := range grafanaVariablePattern.FindAllStringSubmatch(query, -1) {
+			name := m[1] + m[2] + m[3]
+			if vars[name] == nil && !containsString(grafanaBuiltinVariables, name) {
+				problems = append(problems, fmt.Sprintf("%s: variable %s is not defined", where, name))
+			}
+		}
+	}
+	for _, v := range body.Templating.List {
+		if q, ok := v.Query.(string); ok && v.Type == "query" {
+			checkVariables(fmt.Sprintf("variable %s", v.Name), q)
+		}
+	}
+
+	var walk func(panels []grafanaPanel)
+	walk = func(panels []grafanaPanel) {
+		for _, p := range panels {
+			walk(p.Panels)
+			if len(p.Targets) == 0 {
+				continue
+			}
+			panelType, err := c.resolve(p.Datasource, vars, inputs)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("panel %q: %v", p.Title, err))
+				continue
+			}
+			for _, t := range p.Targets {
+				where := fmt.Sprintf("panel %q: target %s", p.Title, t.RefID)
+				dsType := panelType
+				if t.Datasource != nil {
+					dsType, err = c.resolve(t.Datasource, vars, inputs)
+					if err != nil {
+						problems = append(problems, fmt.Sprintf("%s: %v", where, err))
+						continue
+					}
+				}
+				if t.Expr == "" {
+					continue
+				}
+				checkVariables(where, t.Expr)
+				if err := parseGrafanaQuery(dsType, expandGrafanaVariables(t.Expr, vars)); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", where, err))
+				}
+			}
+		}
+	}
+	walk(body.Panels)
+	for _, r := range body.Rows {
+		walk(r.Panels)
+	}
+	return &body, problems
+}
+
+// resolve returns the type of the datasource referred by ds.
+// It returns an empty string for the builtin datasources.
+func (c *grafanaDashboardChecker) resolve(ds interface{}, vars map[string]*grafanaVariable, inputs map[string]string) (string, error) {
+	var name string
+	switch ds := ds.(type) {
+	case nil:
+		if c.defaultType == "" {
+			return "", errors.New("no default datasource")
+		}
+		return c.defaultType, nil
+	case string:
+		name = ds
+	case map[string]interface{}:
+		uid, _ := ds["uid"].(string)
+		if uid == "" {
+			typ, _ := ds["type"].(string)
+			return typ, nil
+		}
+		name = uid
+	default:
+		return "", fmt.Errorf("invalid datasource %v", ds)
+	}
+
+	if name == "" {
+		return c.resolve(nil, vars, inputs)
+	}
+	if containsString(grafanaBuiltinDatasources, name) {
+		return "", nil
+	}
+	if m := grafanaVariablePattern.FindStringSubmatch(name); m != nil && m[0] == name {
+		v := m[1] + m[2] + m[3]
+		if ds, ok := inputs[v]; ok {
+			name = ds
+		} else if vars[v] != nil && vars[v].Type == "datasource" {
+			typ, _ := vars[v].Query.(string)
+			return typ, nil
+		} else {
+			return "", fmt.Errorf("datasource %s is neither a datasource variable nor an input in spec.datasources", name)
+		}
+	}
+	typ, ok := c.datasources[name]
+	if !ok {
+		return "", fmt.Errorf("datasource %q is not defined by GrafanaDataSource", name)
+	}
+	return typ, nil
+}
+
+// expandGrafanaVariables replaces the variables in expr with dummy values so that expr can be parsed.
+// The value depends on the context: a string in quotes, a duration in brackets, or the current value of the variable.
+func expandGrafanaVariables(expr string, vars map[string]*grafanaVariable) string {
+	var sb strings.Builder
+	var quote rune
+	depth := 0
+	last := 0
+	for _, loc := range grafanaVariablePattern.FindAllStringSubmatchIndex(expr, -1) {
+		for _, r := range expr[last:loc[0]] {
+			switch {
+			case quote != 0 && r == quote:
+				quote = 0
+			case quote != 0:
+			case r == '"' || r == '\'' || r == '`':
+				quote = r
+			case r == '[':
+				depth++
+			case r == ']':
+				depth--
+			}
+		}
+		sb.WriteString(expr[last:loc[0]])
+
+		value := "x"
+		switch {
+		case quote != 0:
+		case depth > 0:
+			value = "5m"
+		default:
+			var name string
+			for i := 2; i < len(loc); i += 2 {
+				if loc[i] >= 0 {
+					name = expr[loc[i]:loc[i+1]]
+				}
+			}
+			if v := vars[name]; v != nil {
+				if cur, ok := v.Current.Value.(string); ok && cur != "" && !strings.Contains(cur, "$") {
+					value = cur
+				}
+			}
+		}
+		sb.WriteString(value)
+		last = loc[1]
+	}
+	sb.WriteString(expr[last:])
+	return sb.String()
+}
+
+// parseGrafanaQuery parses query for the datasource type.
+// For Loki, only the stream selector is checked because the LogQL parser is not vendored.
+func parseGrafanaQuery(dsType, query string) error {
+	switch dsType {
+	case "prometheus":
+		if _, err := parser.ParseExpr(query); err != nil {
+			return fmt.Errorf("invalid PromQL: %w", err)
+		}
+	case "loki":
+		start := strings.Index(query, "{")
+		end := strings.Index(query, "}")
+		if start < 0 || end < start {
+			return errors.New("invalid LogQL: no stream selector")
+		}
+		if _, err := parser.ParseMetricSelector(query[start : end+1]); err != nil {
+			return fmt.Errorf("invalid LogQL stream selector: %w", err)
+		}
+	}
+	return nil
+}
+
+func testGrafanaDashboardContents(t *testing.T) {
+	objs, err := renderer.Objects(filepath.Join(manifestDir, grafanaOperatorDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := &grafanaDashboardChecker{datasources: make(map[string]string)}
+	var dashboards []*unstructured.Unstructured
+	for _, obj := range objs {
+		switch obj.GetKind() {
+		case "GrafanaDataSource":
+			var spec grafanaDataSourceSpec
+			if err := decodeGrafanaSpec(obj, &spec); err != nil {
+				t.Fatal(err)
+			}
+			for _, ds := range spec.Datasources {
+				checker.datasources[ds.Name] = ds.Type
+				if ds.IsDefault {
+					checker.defaultType = ds.Type
+				}
+			}
+		case "GrafanaDashboard":
+			dashboards = append(dashboards, obj)
+		}
+	}
+	sort.Slice(dashboards, func(i, j int) bool { return dashboards[i].GetName() < dashboards[j].GetName() })
+
+	uids := make(map[string]string)
+	titles := make(map[string]string)
+	for _, obj := range dashboards {
+		name := obj.GetName()
+		var spec grafanaDashboardSpec
+		if err := decodeGrafanaSpec(obj, &spec); err != nil {
+			t.Error(err)
+			continue
+		}
+		if spec.JSON == "" {
+			continue
+		}
+		inputs := make(map[string]string)
+		for _, ds := range spec.Datasources {
+			inputs[ds.InputName] = ds.DatasourceName
+		}
+
+		body, problems := checker.check(spec.JSON, inputs)
+		for _, p := range problems {
+			t.Errorf("GrafanaDashboard %s: %s", name, p)
+		}
+		if body == nil {
+			continue
+		}
+		if other, ok := uids[body.UID]; ok && body.UID != "" {
+			t.Errorf("GrafanaDashboard %s: uid %q is also used by %s", name, body.UID, other)
+		}
+		uids[body.UID] = name
+		if other, ok := titles[body.Title]; ok {
+			t.Errorf("GrafanaDashboard %s: title %q is also used by %s", name, body.Title, other)
+		}
+		titles[body.Title] = name
+	}
+}
+
+// decodeGrafanaSpec decodes the spec of obj into spec.
+func decodeGrafanaSpec(obj *unstructured.Unstructured, spec interface{}) error {
+	data, err := json.Marshal(obj.Object["spec"])
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return nil
+}
+
+func TestExpandGrafanaVariables(t *testing.T) {
+	vars := map[string]*grafanaVariable{
+		"grouping":  {Name: "grouping", Type: "custom"},
+		"namespace": {Name: "namespace", Type: "query"},
+		"quantile":  {Name: "quantile", Type: "custom"},
+	}
+	vars["grouping"].Current.Value = "namespace"
+	vars["namespace"].Current.Value = "$__all"
+	vars["quantile"].Current.Value = "0.99"
+
+	testCases := []struct {
+		expr     string
+		expected string
+	}{
+		{`sum(rate(foo{namespace=~"$namespace"}[$__rate_interval])) by ($grouping)`, `sum(rate(foo{namespace=~"x"}[5m])) by (namespace)`},
+		{`histogram_quantile($quantile, rate(foo{job='${namespace:regex}'}[[[__interval]]]))`, `histogram_quantile(0.99, rate(foo{job='x'}[5m]))`},
+		{`label_replace(foo, "dst", "$1", "src", "(.*)") > $namespace`, `label_replace(foo, "dst", "$1", "src", "(.*)") > x`},
+	}
+	for _, tc := range testCases {
+		actual := expandGrafanaVariables(tc.expr, vars)
+		if actual != tc.expected {
+			t.Errorf("%s: %s", tc.expr, cmp.Diff(tc.expected, actual))
+		}
+	}
+}
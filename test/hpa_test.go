@@ -153,7 +153,7 @@ spec:
 `
 
 	It("should prepare resources for HPA tests", func() {
-		_, stderr, err := ExecAtWithInput(boot0, []byte(manifests), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(manifests), "kubectl", "apply", "-f", "-")
 		Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 	})
 }
@@ -161,7 +161,7 @@ spec:
 func testHPA() {
 	It("should work for standard resources (CPU)", func() {
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "sandbox", "get", "deployments", "hpa-resource", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "sandbox", "get", "deployments", "hpa-resource", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("failed to get hpa-resource deployment: %s: %w", stderr, err)
 			}
@@ -175,7 +175,7 @@ func testHPA() {
 			return nil
 		}).Should(Succeed())
 
-		ExecSafeAt(boot0, "kubectl", "-n", "sandbox", "delete", "deployments", "hpa-resource")
+		ExecSafeAt(cfg.Boot0, "kubectl", "-n", "sandbox", "delete", "deployments", "hpa-resource")
 	})
 
 	It("should work for custom resources provided by prometheus-adapter", func() {
@@ -183,7 +183,7 @@ func testHPA() {
 		var pod *corev1.Pod
 		Eventually(func() error {
 			pods := &corev1.PodList{}
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "sandbox", "get", "pods", "-l", "run=hpa-custom", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "sandbox", "get", "pods", "-l", "run=hpa-custom", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("failed to get pod list: %s: %w", stderr, err)
 			}
@@ -202,11 +202,11 @@ func testHPA() {
 
 		By("checking the number of replicas increases")
 		Eventually(func() error {
-			_, stderr, err := ExecAtWithInput(boot0, []byte(metric), "curl", "-sf", "--data-binary", "@-", url)
+			_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(metric), "curl", "-sf", "--data-binary", "@-", url)
 			if err != nil {
 				return fmt.Errorf("failed to push a metrics to pushgateway: %s: %w", stderr, err)
 			}
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "sandbox", "get", "deployments", "hpa-custom", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "sandbox", "get", "deployments", "hpa-custom", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("failed to get hpa-custom deployment: %s: %w", stderr, err)
 			}
@@ -220,18 +220,18 @@ func testHPA() {
 			return nil
 		}).Should(Succeed())
 
-		ExecSafeAt(boot0, "kubectl", "-n", "sandbox", "delete", "deployments", "hpa-custom")
+		ExecSafeAt(cfg.Boot0, "kubectl", "-n", "sandbox", "delete", "deployments", "hpa-custom")
 	})
 
 	It("should work for external resources provided by kube-metrics-adapter", func() {
 		metric := "test_hpa_external 23\n"
 		url := fmt.Sprintf("http://%s/metrics/job/some_job", bastionPushgatewayFQDN)
 		Eventually(func() error {
-			_, stderr, err := ExecAtWithInput(boot0, []byte(metric), "curl", "-sf", "--data-binary", "@-", url)
+			_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(metric), "curl", "-sf", "--data-binary", "@-", url)
 			if err != nil {
 				return fmt.Errorf("failed to push a metrics to pushgateway: %s: %w", stderr, err)
 			}
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "sandbox", "get", "deployments", "hpa-external", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "sandbox", "get", "deployments", "hpa-external", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("failed to get hpa-external deployment: %s: %w", stderr, err)
 			}
@@ -245,6 +245,6 @@ func testHPA() {
 			return nil
 		}).Should(Succeed())
 
-		ExecSafeAt(boot0, "kubectl", "-n", "sandbox", "delete", "deployments", "hpa-external")
+		ExecSafeAt(cfg.Boot0, "kubectl", "-n", "sandbox", "delete", "deployments", "hpa-external")
 	})
 }
@@ -0,0 +1,292 @@
+package test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// imageInventoryFile is where the inventory of images is written for the vulnerability scanning pipeline.
+var imageInventoryFile = flag.String("image-inventory", "", "write the inventory of container images in JSON to this file")
+
+// allowedImagePrefixes is the repository prefixes from which images may be pulled.
+// The value is the reason.
+var allowedImagePrefixes = map[string]string{
+	"quay.io/cybozu/":        "images built by neco-containers",
+	"quay.io/topolvm/":       "TopoLVM and pvc-autoresizer are released by the TopoLVM project",
+	"ghcr.io/cybozu-go/":     "MOCO is released by cybozu-go",
+	"quay.io/gravitational/": "Teleport Enterprise is distributed only by Gravitational",
+	"docker.elastic.co/eck/": "ECK operator is distributed only by Elastic",
+}
+
+// imageRef is a parsed image reference.
+type imageRef struct {
+	// Repository includes the registry, e.g. quay.io/cybozu/ubuntu.
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+func (r imageRef) String() string {
+	s := r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// parseImage parses an image reference.  Images on Docker Hub are normalized to docker.io/library/NAME or docker.io/USER/NAME.
+func parseImage(image string) imageRef {
+	var ref imageRef
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	parts := strings.SplitN(name, "/", 2)
+	switch {
+	case len(parts) == 1:
+		name = "docker.io/library/" + name
+	case !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost":
+		name = "docker.io/" + name
+	}
+	ref.Repository = name
+	return ref
+}
+
+// checkImage returns the problems of ref against the pinning policy.
+func checkImage(ref imageRef) []string {
+	var problems []string
+	switch {
+	case ref.Tag == "" && ref.Digest == "":
+		problems = append(problems, "is not tagged")
+	case ref.Tag == "latest":
+		problems = append(problems, "uses the latest tag")
+	}
+
+	allowed := false
+	for prefix := range allowedImagePrefixes {
+		if strings.HasPrefix(ref.Repository, prefix) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		problems = append(problems, "is not from an allowed registry")
+	}
+	return problems
+}
+
+// imageField is an image found in an object.
+type imageField struct {
+	Path  string
+	Image string
+}
+
+// findImages returns the images in obj.
+// It looks for "image" fields of strings, such as those of containers and spec.image of Elasticsearch and CephCluster,
+// and "image" fields of objects with "repository" and "tag", such as those of VictoriaMetrics CRs.
+func findImages(obj map[string]interface{}) []imageField {
+	var images []imageField
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				p := path + "." + k
+				if k == "image" {
+					switch image := v[k].(type) {
+					case string:
+						if image != "" {
+							images = append(images, imageField{Path: p, Image: image})
+						}
+						continue
+					case map[string]interface{}:
+						if repo, ok := image["repository"].(string); ok {
+							if tag, ok := image["tag"].(string); ok && tag != "" {
+								repo += ":" + tag
+							}
+							images = append(images, imageField{Path: p, Image: repo})
+							continue
+						}
+					}
+				}
+				walk(p, v[k])
+			}
+		case []interface{}:
+			for i, e := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), e)
+			}
+		}
+	}
+	walk("", obj)
+	return images
+}
+
+// imageInventoryEntry is an entry of the image inventory.
+type imageInventoryEntry struct {
+	Image    string   `json:"image"`
+	Tag      string   `json:"tag,omitempty"`
+	Digest   string   `json:"digest,omitempty"`
+	Apps     []string `json:"apps"`
+	Overlays []string `json:"overlays"`
+}
+
+// addSorted adds s to the sorted list if not present.
+func addSorted(list []string, s string) []string {
+	i := sort.SearchStrings(list, s)
+	if i < len(list) && list[i] == s {
+		return list
+	}
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = s
+	return list
+}
+
+// testImages checks the images of the applications deployed to each cluster against the pinning policy,
+// and writes the inventory if -image-inventory is given.
+func testImages(t *testing.T) {
+	overlays, err := findOverlays()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inventory := make(map[string]*imageInventoryEntry)
+	// violations maps the violations to the overlays where they are found.
+	violations := make(map[string][]string)
+	for _, overlay := range overlays {
+		apps, idx := loadOverlay(t, overlay)
+		for _, app := range apps {
+			if app.Dir == "" {
+				continue
+			}
+			sub := idx.Source(app.Dir)
+			if sub.Err(app.Dir) != nil {
+				// reported by Overlays
+				continue
+			}
+			for _, obj := range sub.All() {
+				for _, f := range findImages(obj.Object) {
+					ref := parseImage(f.Image)
+					e := inventory[ref.String()]
+					if e == nil {
+						e = &imageInventoryEntry{Image: ref.Repository, Tag: ref.Tag, Digest: ref.Digest}
+						inventory[ref.String()] = e
+					}
+					e.Apps = addSorted(e.Apps, app.Name)
+					e.Overlays = addSorted(e.Overlays, overlay)
+
+					for _, p := range checkImage(ref) {
+						msg := fmt.Sprintf("%s: %s %s/%s: %s: %s %s", app.Name, obj.GetKind(), obj.GetNamespace(), obj.GetName(), f.Path, f.Image, p)
+						violations[msg] = addSorted(violations[msg], overlay)
+					}
+				}
+			}
+		}
+	}
+
+	msgs := make([]string, 0, len(violations))
+	for msg := range violations {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+	for _, msg := range msgs {
+		t.Errorf("%s (overlays: %s)", msg, strings.Join(violations[msg], ", "))
+	}
+
+	if *imageInventoryFile == "" {
+		return
+	}
+	entries := make([]*imageInventoryEntry, 0, len(inventory))
+	for _, e := range inventory {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Image != b.Image {
+			return a.Image < b.Image
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		return a.Digest < b.Digest
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*imageInventoryFile, append(data, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	testCases := []struct {
+		image    string
+		expected imageRef
+		problems []string
+	}{
+		{"quay.io/cybozu/ubuntu:20.04", imageRef{Repository: "quay.io/cybozu/ubuntu", Tag: "20.04"}, nil},
+		{"quay.io/cybozu/ubuntu@sha256:abcd", imageRef{Repository: "quay.io/cybozu/ubuntu", Digest: "sha256:abcd"}, nil},
+		{"localhost:5000/cybozu/ubuntu", imageRef{Repository: "localhost:5000/cybozu/ubuntu"},
+			[]string{"is not tagged", "is not from an allowed registry"}},
+		{"nginx:latest", imageRef{Repository: "docker.io/library/nginx", Tag: "latest"},
+			[]string{"uses the latest tag", "is not from an allowed registry"}},
+		{"grafana/loki:2.1.0", imageRef{Repository: "docker.io/grafana/loki", Tag: "2.1.0"},
+			[]string{"is not from an allowed registry"}},
+	}
+	for _, tc := range testCases {
+		ref := parseImage(tc.image)
+		if ref != tc.expected {
+			t.Errorf("%s: %s", tc.image, cmp.Diff(tc.expected, ref))
+		}
+		if problems := checkImage(ref); !cmp.Equal(problems, tc.problems) {
+			t.Errorf("%s: %s", tc.image, cmp.Diff(tc.problems, problems))
+		}
+	}
+}
+
+func TestFindImages(t *testing.T) {
+	obj := map[string]interface{}{
+		"kind": "CronJob",
+		"spec": map[string]interface{}{
+			"jobTemplate": map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"initContainers": []interface{}{map[string]interface{}{"image": "quay.io/cybozu/ubuntu:20.04"}},
+					"containers":     []interface{}{map[string]interface{}{"image": "quay.io/cybozu/squid:4.14.1"}},
+				},
+			}}},
+			// VictoriaMetrics CRs
+			"image": map[string]interface{}{"repository": "quay.io/cybozu/victoriametrics-vmagent", "tag": "1.53.1.1"},
+			// CRD schemas
+			"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}},
+		},
+	}
+	expected := []imageField{
+		{".spec.image", "quay.io/cybozu/victoriametrics-vmagent:1.53.1.1"},
+		{".spec.jobTemplate.spec.template.spec.containers[0].image", "quay.io/cybozu/squid:4.14.1"},
+		{".spec.jobTemplate.spec.template.spec.initContainers[0].image", "quay.io/cybozu/ubuntu:20.04"},
+	}
+	if actual := findImages(obj); !cmp.Equal(actual, expected) {
+		t.Error(cmp.Diff(expected, actual))
+	}
+}
@@ -0,0 +1,333 @@
+// +build !kind
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+const applyFieldManager = "neco-apps-test"
+
+var (
+	kubeClientMu sync.Mutex
+	kubeClient   *clusterClient
+)
+
+// clusterClient accesses the API server of the test cluster.
+// Connections to the API server are tunnelled through the SSH connection to a boot server,
+// so the API server need not be reachable from the host running the tests.
+type clusterClient struct {
+	typed   kubernetes.Interface
+	dynamic dynamic.Interface
+	mapper  *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// kube returns the clusterClient of the test cluster.
+// The client is created at the first call because the cluster does not exist before the bootstrap.
+func kube() *clusterClient {
+	c, err := getKube()
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return c
+}
+
+// getKube is the same as kube except that it returns an error instead of failing the test.
+func getKube() (*clusterClient, error) {
+	kubeClientMu.Lock()
+	defer kubeClientMu.Unlock()
+
+	if kubeClient == nil {
+		c, err := newClusterClient(cfg.Boot0)
+		if err != nil {
+			return nil, err
+		}
+		kubeClient = c
+	}
+	return kubeClient, nil
+}
+
+// newClusterClient creates a clusterClient from the kubeconfig of host.
+func newClusterClient(host string) (*clusterClient, error) {
+	agent := sshClients[host]
+	if agent == nil {
+		return nil, fmt.Errorf("no SSH connection to %s", host)
+	}
+
+	stdout, stderr, err := ExecAt(host, "kubectl", "config", "view", "--raw", "--minify", "--flatten")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubeconfig: stderr: %s: %w", stderr, err)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(stdout)
+	if err != nil {
+		return nil, err
+	}
+	config.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return agent.DialContext(ctx, network, address)
+	}
+
+	typed, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusterClient{
+		typed:   typed,
+		dynamic: dyn,
+		mapper:  restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc)),
+	}, nil
+}
+
+// Typed returns the clientset of the built-in resources.
+func (c *clusterClient) Typed() kubernetes.Interface {
+	return c.typed
+}
+
+// gvkOf returns the GroupVersionKind of obj.
+// obj is either a type registered to the client-go scheme or an unstructured object with apiVersion and kind.
+// For lists, the kind of the items is returned.
+func gvkOf(obj runtime.Object) (schema.GroupVersionKind, error) {
+	var gvk schema.GroupVersionKind
+	switch o := obj.(type) {
+	case *unstructured.Unstructured:
+		gvk = o.GroupVersionKind()
+	case *unstructured.UnstructuredList:
+		gvk = o.GroupVersionKind()
+	default:
+		gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return gvk, err
+		}
+		gvk = gvks[0]
+	}
+	if gvk.Kind == "" {
+		return gvk, errors.New("kind is not set")
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	return gvk, nil
+}
+
+// resource returns the dynamic client for gvk in namespace.
+func (c *clusterClient) resource(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// CRDs may be installed after the discovery information is cached.
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.dynamic.Resource(mapping.Resource), nil
+	}
+	return c.dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// fromUnstructured converts u into obj.
+func fromUnstructured(u *unstructured.Unstructured, obj runtime.Object) error {
+	if o, ok := obj.(*unstructured.Unstructured); ok {
+		u.DeepCopyInto(o)
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), obj)
+}
+
+// Get gets the object namespace/name into obj.
+// namespace is ignored for cluster-scoped resources.
+func (c *clusterClient) Get(ctx context.Context, namespace, name string, obj runtime.Object) error {
+	gvk, err := gvkOf(obj)
+	if err != nil {
+		return err
+	}
+	ri, err := c.resource(gvk, namespace)
+	if err != nil {
+		return err
+	}
+	u, err := ri.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return fromUnstructured(u, obj)
+}
+
+// List lists the objects in namespace into list, e.g. *corev1.PodList.
+// If namespace is empty, objects in all namespaces are listed.
+func (c *clusterClient) List(ctx context.Context, namespace string, list runtime.Object, opts metav1.ListOptions) error {
+	gvk, err := gvkOf(list)
+	if err != nil {
+		return err
+	}
+	ri, err := c.resource(gvk, namespace)
+	if err != nil {
+		return err
+	}
+	ul, err := ri.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if o, ok := list.(*unstructured.UnstructuredList); ok {
+		ul.DeepCopyInto(o)
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(ul.UnstructuredContent(), list)
+}
+
+// Watch watches the objects of the kind of obj in namespace.
+// The events contain *unstructured.Unstructured.
+func (c *clusterClient) Watch(ctx context.Context, namespace string, obj runtime.Object, opts metav1.ListOptions) (watch.Interface, error) {
+	gvk, err := gvkOf(obj)
+	if err != nil {
+		return nil, err
+	}
+	ri, err := c.resource(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ri.Watch(ctx, opts)
+}
+
+// ListWatch returns a ListWatch of the objects of the kind of obj in namespace for informers.
+// The objects are *unstructured.Unstructured.
+func (c *clusterClient) ListWatch(ctx context.Context, namespace string, obj runtime.Object, selector fields.Selector) (*cache.ListWatch, error) {
+	gvk, err := gvkOf(obj)
+	if err != nil {
+		return nil, err
+	}
+	ri, err := c.resource(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector.String()
+			return ri.List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector.String()
+			return ri.Watch(ctx, opts)
+		},
+	}, nil
+}
+
+// WaitFor watches the object namespace/name until cond returns nil.
+// obj is updated to the latest state of the object before each call of cond.
+// If ctx is done before that, the error returned by the last call of cond is returned.
+func (c *clusterClient) WaitFor(ctx context.Context, namespace, name string, obj runtime.Object, cond func() error) error {
+	gvk, err := gvkOf(obj)
+	if err != nil {
+		return err
+	}
+	lw, err := c.ListWatch(ctx, namespace, obj, fields.OneTermEqualSelector("metadata.name", name))
+	if err != nil {
+		return err
+	}
+
+	lastErr := fmt.Errorf("%s %s/%s is not found", gvk.Kind, namespace, name)
+	_, err = watchtools.UntilWithSync(ctx, lw, &unstructured.Unstructured{}, nil, func(ev watch.Event) (bool, error) {
+		switch ev.Type {
+		case watch.Added, watch.Modified:
+		case watch.Deleted:
+			lastErr = fmt.Errorf("%s %s/%s is deleted", gvk.Kind, namespace, name)
+			return false, nil
+		default:
+			return false, nil
+		}
+
+		u, ok := ev.Object.(*unstructured.Unstructured)
+		if !ok {
+			return false, fmt.Errorf("unexpected object: %T", ev.Object)
+		}
+		if err := fromUnstructured(u, obj); err != nil {
+			return false, err
+		}
+		lastErr = cond()
+		return lastErr == nil, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			return fmt.Errorf("%v: %w", lastErr, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Apply applies the objects in manifest with server-side apply.
+// manifest may contain multiple YAML documents.
+func (c *clusterClient) Apply(ctx context.Context, manifest string) error {
+	dec := yaml.NewYAMLOrJSONDecoder(strings.NewReader(manifest), 4096)
+	for {
+		u := &unstructured.Unstructured{}
+		err := dec.Decode(&u.Object)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(u.Object) == 0 {
+			continue
+		}
+
+		ri, err := c.resource(u.GroupVersionKind(), u.GetNamespace())
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		force := true
+		_, err = ri.Patch(ctx, u.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+			FieldManager: applyFieldManager,
+			Force:        &force,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply %s %s/%s: %w", u.GetKind(), u.GetNamespace(), u.GetName(), err)
+		}
+	}
+}
+
+// waitFor waits for the object namespace/name in the test cluster until cond returns nil.
+// It fails the test if cond does not return nil in defaultWaitTimeout.
+func waitFor(namespace, name string, obj runtime.Object, cond func() error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultWaitTimeout)
+	defer cancel()
+	err := kube().WaitFor(ctx, namespace, name, obj, cond)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+}
@@ -75,7 +75,7 @@ spec:
     requests:
       storage: 1Gi
 `
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 	})
 }
@@ -91,7 +91,7 @@ func testLocalPVProvisioner() {
 	It("should have created PV successfully", func() {
 		By("confirming it has be successfully deployed")
 		By("getting SS Nodes")
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "nodes", "--selector=cke.cybozu.com/role=ss", "-o", "json")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "nodes", "--selector=cke.cybozu.com/role=ss", "-o", "json")
 		Expect(err).NotTo(HaveOccurred(), "failed to get SS Nodes. stdout: %s, stderr: %s", stdout, stderr)
 
 		err = json.Unmarshal(stdout, &ssNodes)
@@ -101,7 +101,7 @@ func testLocalPVProvisioner() {
 
 		By("checking the number of available Pods by the state of DaemonSet")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "ds", "local-pv-provisioner", "-n", "kube-system", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "ds", "local-pv-provisioner", "-n", "kube-system", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("failed to get a DaemonSet. stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -121,7 +121,7 @@ func testLocalPVProvisioner() {
 		By("checking the Pods were assigned for Nodes")
 		for _, ssNode := range ssNodes.Items {
 			By("checking the pod on " + ssNode.GetName())
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "pods", "--selector=app.kubernetes.io/name=local-pv-provisioner", "--field-selector=spec.nodeName=="+ssNode.GetName(), "-n", "kube-system", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "pods", "--selector=app.kubernetes.io/name=local-pv-provisioner", "--field-selector=spec.nodeName=="+ssNode.GetName(), "-n", "kube-system", "-o", "json")
 			Expect(err).NotTo(HaveOccurred(), "failed to get a DaemonSet. stdout: %s, stderr: %s", stdout, stderr)
 
 			var lppPods corev1.PodList
@@ -131,7 +131,7 @@ func testLocalPVProvisioner() {
 		}
 
 		By("getting local PVs")
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "get", "pv", "-o", "json")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "get", "pv", "-o", "json")
 		Expect(err).NotTo(HaveOccurred(), "failed to get PVs. stdout: %s, stderr: %s", stdout, stderr)
 
 		var pvs corev1.PersistentVolumeList
@@ -148,7 +148,7 @@ func testLocalPVProvisioner() {
 		for _, ssNode := range ssNodes.Items {
 			By("checking target device files on " + ssNode.GetName())
 			ssNodeIP := ssNode.GetName()
-			stdout, stderr, err := ExecAt(boot0, "ckecli", "ssh", "cybozu@"+ssNodeIP, "ls", cryptPartDir)
+			stdout, stderr, err := ExecAt(cfg.Boot0, "ckecli", "ssh", "cybozu@"+ssNodeIP, "ls", cryptPartDir)
 			Expect(err).NotTo(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 			devices := strings.Fields(strings.TrimSpace(string(stdout)))
 
@@ -168,7 +168,7 @@ func testLocalPVProvisioner() {
 	It("should access a local PV as block device from Pod", func() {
 		By("waiting for the test Pod to get ready")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", "sandbox", "test-local-pv-provisioner", "--", "date")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", "test-local-pv-provisioner", "--", "date")
 			if err != nil {
 				return fmt.Errorf("failed to execute a command. stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -177,11 +177,11 @@ func testLocalPVProvisioner() {
 		}).Should(Succeed())
 
 		By("making a filesystem on the local-pv")
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", "sandbox", "test-local-pv-provisioner", "--", "mkfs.ext4", "-F", "/dev/local-dev")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", "test-local-pv-provisioner", "--", "mkfs.ext4", "-F", "/dev/local-dev")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
 		By("getting used local PV")
-		stdout = ExecSafeAt(boot0, "kubectl", "get", "pvc", "local-pvc", "-n", "sandbox", "-o", "json")
+		stdout = ExecSafeAt(cfg.Boot0, "kubectl", "get", "pvc", "local-pvc", "-n", "sandbox", "-o", "json")
 
 		pvc := new(corev1.PersistentVolumeClaim)
 		err = json.Unmarshal(stdout, pvc)
@@ -189,13 +189,13 @@ func testLocalPVProvisioner() {
 		usedPVName := pvc.Spec.VolumeName
 
 		By("deleting test resources")
-		ExecSafeAt(boot0, "kubectl", "-n", "sandbox", "delete", "pods", "test-local-pv-provisioner")
-		ExecSafeAt(boot0, "kubectl", "-n", "sandbox", "delete", "pvc", "local-pvc")
+		ExecSafeAt(cfg.Boot0, "kubectl", "-n", "sandbox", "delete", "pods", "test-local-pv-provisioner")
+		ExecSafeAt(cfg.Boot0, "kubectl", "-n", "sandbox", "delete", "pvc", "local-pvc")
 
 		var pv corev1.PersistentVolume
 		By("waiting used local PV will be recreated")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "pv", usedPVName, "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "pv", usedPVName, "-o", "json")
 			if err != nil {
 				return fmt.Errorf("failed to get PVs. stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -216,7 +216,7 @@ func testLocalPVProvisioner() {
 		ssNodeIP, err := getNodeIPFromPV(&pv)
 		Expect(err).ShouldNot(HaveOccurred())
 		// read ext4 super block. ref: https://ext4.wiki.kernel.org/index.php/Ext4_Disk_Layout#Layout
-		stdout, stderr, err = ExecAt(boot0, "ckecli", "ssh", "cybozu@"+ssNodeIP, "sudo", "dd", "if="+pv.Spec.Local.Path, "bs=1024", "skip=1", "count=4")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "ckecli", "ssh", "cybozu@"+ssNodeIP, "sudo", "dd", "if="+pv.Spec.Local.Path, "bs=1024", "skip=1", "count=4")
 		Expect(err).NotTo(HaveOccurred(), "stderr=%s", stderr)
 		Expect(stdout).Should(Equal(make([]byte, 4096)))
 	})
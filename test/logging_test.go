@@ -26,7 +26,7 @@ func testLogging() {
 func checkLog(title, query string) {
 	By(title, func() {
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0,
+			stdout, stderr, err := ExecAt(cfg.Boot0,
 				"kubectl", "exec", "-n", "logging", "statefulset/logging-loki", "--", "logcli", "query", query, "-ojsonl")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -59,7 +59,7 @@ func checkLog(title, query string) {
 }
 
 func getNodeName(role string) string {
-	stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "node", "-l", fmt.Sprintf("node-role.kubernetes.io/%s=true", role), "-o=json")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "node", "-l", fmt.Sprintf("node-role.kubernetes.io/%s=true", role), "-o=json")
 	Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
 	nodes := new(corev1.NodeList)
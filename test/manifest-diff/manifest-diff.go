@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cybozu-go/neco-apps/test/manifest"
+)
+
+var (
+	repoDir = flag.String("C", ".", "directory in the neco-apps repository")
+	outFile = flag.String("o", "", "write the diff to this file instead of stdout")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  %[1]s [-C DIR] [-o FILE] BASE [HEAD]
+
+Render every argocd-config overlay and the paths of their Applications at the
+git revisions BASE and HEAD, and print the differences in Markdown.
+HEAD defaults to the working tree.
+
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), flag.Arg(1)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(base, head string) error {
+	top, err := manifest.RepositoryRoot(*repoDir)
+	if err != nil {
+		return err
+	}
+
+	oldClusters, err := manifest.RenderRevision(top, base)
+	if err != nil {
+		return err
+	}
+	var newClusters []*manifest.Cluster
+	if head == "" {
+		newClusters, err = manifest.RenderClusters(manifest.NewRenderer(), top)
+	} else {
+		newClusters, err = manifest.RenderRevision(top, head)
+	}
+	if err != nil {
+		return err
+	}
+	diffs := manifest.DiffClusters(oldClusters, newClusters)
+
+	var w io.Writer = os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if head == "" {
+		head = "working tree"
+	}
+	return writeMarkdown(w, base, head, diffs)
+}
+
+// writeMarkdown writes diffs in the format to be posted as a PR comment.
+// Deletions of PVCs, CRDs and Namespaces are listed first in diff blocks so that GitHub shows them in red.
+func writeMarkdown(w io.Writer, base, head string, diffs []manifest.ClusterDiff) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Rendered manifest diff: `%s`...`%s`\n\n", base, head)
+	if len(diffs) == 0 {
+		sb.WriteString("No changes.\n")
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	var dangers []string
+	for _, c := range diffs {
+		for _, a := range c.Apps {
+			for _, o := range a.Objects {
+				if o.Dangerous() {
+					dangers = append(dangers, fmt.Sprintf("- %s: %s: %s", c.Name, a.Name, o.Key))
+				}
+			}
+		}
+	}
+	if len(dangers) > 0 {
+		sb.WriteString("### :warning: Dangerous deletions\n\n```diff\n")
+		sb.WriteString(strings.Join(dangers, "\n"))
+		sb.WriteString("\n```\n\n")
+	}
+
+	for _, c := range diffs {
+		fmt.Fprintf(&sb, "### %s", c.Name)
+		if c.Change != manifest.Modified {
+			fmt.Fprintf(&sb, " (%s)", c.Change)
+		}
+		sb.WriteString("\n\n")
+		if c.Err != "" {
+			fmt.Fprintf(&sb, "argocd-config %s\n\n", c.Err)
+		}
+
+		for _, a := range c.Apps {
+			fmt.Fprintf(&sb, "#### Application %s", a.Name)
+			if a.Path != "" {
+				fmt.Fprintf(&sb, " (`%s`)", a.Path)
+			}
+			if a.Change != manifest.Modified {
+				fmt.Fprintf(&sb, " %s", a.Change)
+			}
+			sb.WriteString("\n\n")
+			if a.Err != "" {
+				fmt.Fprintf(&sb, "%s\n\n", a.Err)
+			}
+			if a.Application != "" {
+				writeDetails(&sb, "Application", a.Application)
+			}
+
+			for _, o := range a.Objects {
+				switch {
+				case o.Dangerous():
+					fmt.Fprintf(&sb, "```diff\n- %s %s\n```\n\n", o.Change, o.Key)
+				case o.Change == manifest.Modified:
+					writeDetails(&sb, o.Key.String(), o.Diff)
+				default:
+					fmt.Fprintf(&sb, "- %s %s\n\n", o.Change, o.Key)
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeDetails(sb *strings.Builder, summary, diff string) {
+	fmt.Fprintf(sb, "<details><summary>modified %s</summary>\n\n```diff\n%s\n```\n\n</details>\n\n", summary, strings.TrimRight(diff, "\n"))
+}
@@ -0,0 +1,279 @@
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RepoURL is the repository URL of neco-apps in Applications.
+const RepoURL = "https://github.com/cybozu-go/neco-apps.git"
+
+// ObjectKey identifies an object in a cluster.
+type ObjectKey struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (k ObjectKey) String() string {
+	kind := k.Kind
+	if k.Group != "" {
+		kind += "." + k.Group
+	}
+	if k.Namespace == "" {
+		return kind + " " + k.Name
+	}
+	return kind + " " + k.Namespace + "/" + k.Name
+}
+
+// KeyOf returns the key of obj.
+func KeyOf(obj *unstructured.Unstructured) ObjectKey {
+	gvk := obj.GroupVersionKind()
+	return ObjectKey{Group: gvk.Group, Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+}
+
+// App is an Application with the objects rendered from its source path.
+type App struct {
+	Application *unstructured.Unstructured
+	// Path is spec.source.path.  It is empty if the application is not in neco-apps.
+	Path    string
+	Objects map[ObjectKey]*unstructured.Unstructured
+	// Err is the rendering error of Path.
+	Err error
+}
+
+// Cluster is the Applications in an argocd-config overlay.
+type Cluster struct {
+	Name string
+	Err  error
+	Apps map[string]*App
+}
+
+// RenderClusters renders every argocd-config overlay under root and the source paths of their Applications.
+// Rendering errors are recorded in Cluster and App instead of aborting.
+func RenderClusters(r *Renderer, root string) ([]*Cluster, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(root, "argocd-config", "overlays"))
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []*Cluster
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		c := &Cluster{Name: e.Name(), Apps: make(map[string]*App)}
+		clusters = append(clusters, c)
+
+		objs, err := r.Objects(filepath.Join(root, "argocd-config", "overlays", e.Name()))
+		if err != nil {
+			c.Err = err
+			continue
+		}
+		for _, obj := range objs {
+			if obj.GetKind() != "Application" {
+				continue
+			}
+			app := &App{Application: obj}
+			c.Apps[obj.GetName()] = app
+
+			repoURL, _, _ := unstructured.NestedString(obj.Object, "spec", "source", "repoURL")
+			path, _, _ := unstructured.NestedString(obj.Object, "spec", "source", "path")
+			if repoURL != RepoURL || path == "" {
+				continue
+			}
+			app.Path = filepath.Clean(path)
+			rendered, err := r.Objects(filepath.Join(root, app.Path))
+			if err != nil {
+				app.Err = err
+				continue
+			}
+			app.Objects = make(map[ObjectKey]*unstructured.Unstructured)
+			for _, o := range rendered {
+				app.Objects[KeyOf(o)] = o
+			}
+		}
+	}
+	return clusters, nil
+}
+
+// Change is the kind of a change.
+type Change string
+
+const (
+	Added    = Change("added")
+	Removed  = Change("removed")
+	Modified = Change("modified")
+)
+
+// ObjectDiff is a change of an object.
+type ObjectDiff struct {
+	Key    ObjectKey
+	Change Change
+	// Diff is the difference of the contents for Modified.
+	Diff string
+}
+
+// Dangerous returns true if the change deletes an object whose deletion loses data or other objects.
+func (d ObjectDiff) Dangerous() bool {
+	if d.Change != Removed {
+		return false
+	}
+	switch d.Key.Kind {
+	case "PersistentVolumeClaim", "CustomResourceDefinition", "Namespace":
+		return true
+	}
+	return false
+}
+
+// AppDiff is a change of an Application and its objects.
+type AppDiff struct {
+	Name   string
+	Path   string
+	Change Change
+	// Application is the difference of the Application itself.
+	Application string
+	// Err describes the change of rendering errors.
+	Err     string
+	Objects []ObjectDiff
+}
+
+// ClusterDiff is a change of the Applications in a cluster.
+type ClusterDiff struct {
+	Name   string
+	Change Change
+	Err    string
+	Apps   []AppDiff
+}
+
+// DiffClusters returns the changes from old to new.  Unchanged clusters and applications are omitted.
+// Objects are compared by their keys and contents, so the order of objects and fields does not matter.
+func DiffClusters(old, new []*Cluster) []ClusterDiff {
+	oldMap := make(map[string]*Cluster)
+	newMap := make(map[string]*Cluster)
+	var names []string
+	for _, c := range old {
+		oldMap[c.Name] = c
+		names = append(names, c.Name)
+	}
+	for _, c := range new {
+		newMap[c.Name] = c
+		if oldMap[c.Name] == nil {
+			names = append(names, c.Name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []ClusterDiff
+	for _, name := range names {
+		o, n := oldMap[name], newMap[name]
+		d := ClusterDiff{Name: name, Change: Modified}
+		switch {
+		case o == nil:
+			d.Change = Added
+			o = &Cluster{}
+		case n == nil:
+			d.Change = Removed
+			n = &Cluster{}
+		}
+		d.Err = diffErr(o.Err, n.Err)
+		d.Apps = diffApps(o.Apps, n.Apps)
+		if d.Change != Modified || d.Err != "" || len(d.Apps) > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+func diffApps(old, new map[string]*App) []AppDiff {
+	var names []string
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range new {
+		if old[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []AppDiff
+	for _, name := range names {
+		o, n := old[name], new[name]
+		d := AppDiff{Name: name, Change: Modified}
+		switch {
+		case o == nil:
+			d.Change = Added
+			o = &App{}
+		case n == nil:
+			d.Change = Removed
+			n = &App{}
+		}
+		d.Path = n.Path
+		if d.Path == "" {
+			d.Path = o.Path
+		}
+		if o.Application != nil && n.Application != nil {
+			d.Application = cmp.Diff(o.Application.Object, n.Application.Object)
+		}
+		d.Err = diffErr(o.Err, n.Err)
+		d.Objects = diffObjects(o.Objects, n.Objects)
+		if d.Change != Modified || d.Application != "" || d.Err != "" || len(d.Objects) > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+func diffObjects(old, new map[ObjectKey]*unstructured.Unstructured) []ObjectDiff {
+	var keys []ObjectKey
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if old[k] == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	var diffs []ObjectDiff
+	for _, k := range keys {
+		o, n := old[k], new[k]
+		switch {
+		case o == nil:
+			diffs = append(diffs, ObjectDiff{Key: k, Change: Added})
+		case n == nil:
+			diffs = append(diffs, ObjectDiff{Key: k, Change: Removed})
+		default:
+			if diff := cmp.Diff(o.Object, n.Object); diff != "" {
+				diffs = append(diffs, ObjectDiff{Key: k, Change: Modified, Diff: diff})
+			}
+		}
+	}
+	return diffs
+}
+
+func diffErr(old, new error) string {
+	msg := func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return err.Error()
+	}
+	o, n := msg(old), msg(new)
+	switch {
+	case o == n:
+		return ""
+	case n == "":
+		return "fixed: " + o
+	default:
+		return fmt.Sprintf("failed to render: %s", n)
+	}
+}
@@ -0,0 +1,80 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testObject(apiVersion, kind, namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       spec,
+	}}
+	if namespace != "" {
+		obj.SetNamespace(namespace)
+	}
+	return obj
+}
+
+func testApp(objs ...*unstructured.Unstructured) *App {
+	app := &App{
+		Application: testObject("argoproj.io/v1alpha1", "Application", "argocd", "app", map[string]interface{}{"project": "default"}),
+		Path:        "app/overlays/stage0",
+		Objects:     make(map[ObjectKey]*unstructured.Unstructured),
+	}
+	for _, obj := range objs {
+		app.Objects[KeyOf(obj)] = obj
+	}
+	return app
+}
+
+func TestDiffClusters(t *testing.T) {
+	pvc := testObject("v1", "PersistentVolumeClaim", "app", "data", map[string]interface{}{"storageClassName": "topolvm"})
+	cm := testObject("v1", "ConfigMap", "app", "config", nil)
+	deploy := testObject("apps/v1", "Deployment", "app", "app", map[string]interface{}{"replicas": int64(1)})
+	scaled := testObject("apps/v1", "Deployment", "app", "app", map[string]interface{}{"replicas": int64(2)})
+	ns := testObject("v1", "Namespace", "", "app", nil)
+
+	old := []*Cluster{
+		{Name: "stage0", Apps: map[string]*App{"app": testApp(ns, pvc, deploy)}},
+		{Name: "tokyo0", Apps: map[string]*App{"app": testApp(ns, pvc, deploy)}},
+	}
+	new := []*Cluster{
+		{Name: "stage0", Apps: map[string]*App{"app": testApp(cm, scaled)}},
+		// same objects in a different order
+		{Name: "tokyo0", Apps: map[string]*App{"app": testApp(deploy, pvc, ns)}},
+	}
+
+	diffs := DiffClusters(old, new)
+	if len(diffs) != 1 || diffs[0].Name != "stage0" || len(diffs[0].Apps) != 1 {
+		t.Fatalf("unexpected diffs: %#v", diffs)
+	}
+	app := diffs[0].Apps[0]
+	if app.Name != "app" || app.Change != Modified || app.Application != "" || app.Err != "" {
+		t.Errorf("unexpected app diff: %#v", app)
+	}
+
+	type result struct {
+		Key       string
+		Change    Change
+		Dangerous bool
+		Diff      bool
+	}
+	var actual []result
+	for _, o := range app.Objects {
+		actual = append(actual, result{o.Key.String(), o.Change, o.Dangerous(), o.Diff != ""})
+	}
+	expected := []result{
+		{"ConfigMap app/config", Added, false, false},
+		{"Deployment.apps app/app", Modified, false, true},
+		{"Namespace app", Removed, true, false},
+		{"PersistentVolumeClaim app/data", Removed, true, false},
+	}
+	if !cmp.Equal(actual, expected) {
+		t.Error(cmp.Diff(expected, actual))
+	}
+}
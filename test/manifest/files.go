@@ -0,0 +1,98 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileIndex maps objects to the YAML files that define them.
+// kustomize does not record where a rendered object came from, so this is used
+// to point at the file to be fixed when a check reports a problem.
+type FileIndex struct {
+	files map[string][]string
+}
+
+// IndexFiles reads YAML files under root except for the directories in excludes.
+// Files that cannot be decoded as Kubernetes objects are ignored.
+func IndexFiles(root string, excludes []string) (*FileIndex, error) {
+	fi := &FileIndex{
+		files: make(map[string][]string),
+	}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, ex := range excludes {
+			if strings.HasPrefix(path, ex) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		objs, err := Decode(data)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			key := fileKey(obj.GetKind(), obj.GetName())
+			fi.files[key] = append(fi.files[key], rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, files := range fi.files {
+		sort.Strings(files)
+	}
+	return fi, nil
+}
+
+func fileKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// Find returns the file that most likely defines the object of kind and name rendered from source.
+// The file sharing the longest path with source is chosen.
+// An empty string is returned if no file is found, e.g. the object is renamed or generated by kustomize.
+func (fi *FileIndex) Find(source, kind, name string) string {
+	var found string
+	longest := -1
+	for _, f := range fi.files[fileKey(kind, name)] {
+		n := commonPrefixLen(filepath.Dir(f), source)
+		if n > longest {
+			found = f
+			longest = n
+		}
+	}
+	return found
+}
+
+func commonPrefixLen(a, b string) int {
+	as := strings.Split(filepath.ToSlash(a), "/")
+	bs := strings.Split(filepath.ToSlash(b), "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,53 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// RenderRevision renders the clusters at the git revision rev of the repository containing dir.
+// rev is checked out in a temporary worktree, so the working tree of dir is not changed.
+func RenderRevision(dir, rev string) ([]*Cluster, error) {
+	top, err := RepositoryRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempDir("", "neco-apps-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := git(top, "worktree", "add", "--detach", tmp, rev); err != nil {
+		return nil, err
+	}
+	defer git(top, "worktree", "remove", "--force", tmp)
+
+	clusters, err := RenderClusters(NewRenderer(), tmp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rev, err)
+	}
+	return clusters, nil
+}
+
+// RepositoryRoot returns the top directory of the repository containing dir.
+func RepositoryRoot(dir string) (string, error) {
+	return git(dir, "rev-parse", "--show-toplevel")
+}
+
+func git(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,209 @@
+package manifest
+
+import (
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Object is a rendered object annotated with the kustomization that produced it.
+type Object struct {
+	*unstructured.Unstructured
+
+	// Source is the kustomization directory relative to the repository root.
+	Source string
+}
+
+// Decode converts the object into a typed object such as corev1.Service.
+func (o *Object) Decode(v interface{}) error {
+	return FromUnstructured(o.Unstructured, v)
+}
+
+// FromUnstructured converts u into a typed object.
+func FromUnstructured(u *unstructured.Unstructured, v interface{}) error {
+	return k8sruntime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), v)
+}
+
+// Index indexes rendered objects by GVK, namespace, name and source directory.
+// Index is read-only once built, so it is safe to share between parallel tests.
+type Index struct {
+	objects  []*Object
+	sources  []string
+	bySource map[string][]*Object
+	byGVK    map[schema.GroupVersionKind][]*Object
+	byKind   map[string][]*Object
+	errors   map[string]error
+}
+
+// NewIndex creates an empty Index.
+func NewIndex() *Index {
+	return &Index{
+		bySource: make(map[string][]*Object),
+		byGVK:    make(map[schema.GroupVersionKind][]*Object),
+		byKind:   make(map[string][]*Object),
+		errors:   make(map[string]error),
+	}
+}
+
+// BuildIndex renders each kustomization directory under root and indexes the result.
+// dirs must be relative to root.  A rendering failure does not abort the build;
+// it is recorded and can be retrieved with Err.
+func BuildIndex(r *Renderer, root string, dirs []string) *Index {
+	type rendered struct {
+		objs []*unstructured.Unstructured
+		err  error
+	}
+	results := make([]rendered, len(dirs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			objs, err := r.Objects(filepath.Join(root, dir))
+			results[i] = rendered{objs: objs, err: err}
+		}(i, dir)
+	}
+	wg.Wait()
+
+	idx := NewIndex()
+	for i, dir := range dirs {
+		if results[i].err != nil {
+			idx.sources = append(idx.sources, dir)
+			idx.errors[dir] = results[i].err
+			continue
+		}
+		idx.Add(dir, results[i].objs)
+	}
+	return idx
+}
+
+// Add adds objects rendered from source to the index.
+func (idx *Index) Add(source string, objs []*unstructured.Unstructured) {
+	if _, ok := idx.bySource[source]; !ok {
+		idx.sources = append(idx.sources, source)
+		idx.bySource[source] = nil
+	}
+	for _, u := range objs {
+		idx.add(&Object{Unstructured: u, Source: source})
+	}
+}
+
+func (idx *Index) add(o *Object) {
+	gvk := o.GroupVersionKind()
+	idx.objects = append(idx.objects, o)
+	idx.bySource[o.Source] = append(idx.bySource[o.Source], o)
+	idx.byGVK[gvk] = append(idx.byGVK[gvk], o)
+	idx.byKind[gvk.Kind] = append(idx.byKind[gvk.Kind], o)
+}
+
+// Err returns the error occurred while rendering source, if any.
+func (idx *Index) Err(source string) error {
+	return idx.errors[source]
+}
+
+// Sources returns the sorted list of source directories.
+func (idx *Index) Sources() []string {
+	sources := append([]string(nil), idx.sources...)
+	sort.Strings(sources)
+	return sources
+}
+
+// All returns all indexed objects.
+func (idx *Index) All() []*Object {
+	return idx.objects
+}
+
+// Source returns a new Index that contains only objects rendered from source.
+func (idx *Index) Source(source string) *Index {
+	sub := NewIndex()
+	sub.sources = append(sub.sources, source)
+	if err, ok := idx.errors[source]; ok {
+		sub.errors[source] = err
+		return sub
+	}
+	sub.bySource[source] = nil
+	for _, o := range idx.bySource[source] {
+		sub.add(o)
+	}
+	return sub
+}
+
+// ByGVK returns objects of the given GroupVersionKind.
+func (idx *Index) ByGVK(gvk schema.GroupVersionKind) []*Object {
+	return idx.byGVK[gvk]
+}
+
+// ByKind returns objects of the given kind regardless of their API group and version.
+func (idx *Index) ByKind(kind string) []*Object {
+	return idx.byKind[kind]
+}
+
+// Lookup returns objects of the given kind, namespace and name.
+// More than one object may be returned when several sources render the same object.
+func (idx *Index) Lookup(kind, namespace, name string) []*Object {
+	var ret []*Object
+	for _, o := range idx.byKind[kind] {
+		if o.GetNamespace() == namespace && o.GetName() == name {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
+
+// InNamespace returns objects of the given kind in namespace.
+func (idx *Index) InNamespace(kind, namespace string) []*Object {
+	var ret []*Object
+	for _, o := range idx.byKind[kind] {
+		if o.GetNamespace() == namespace {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
+
+// Select returns objects of the given kind whose labels match selector.
+// A nil selector matches nothing, which is consistent with metav1.LabelSelectorAsSelector.
+func (idx *Index) Select(kind string, selector *metav1.LabelSelector) ([]*Object, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*Object
+	for _, o := range idx.byKind[kind] {
+		if sel.Matches(labels.Set(o.GetLabels())) {
+			ret = append(ret, o)
+		}
+	}
+	return ret, nil
+}
+
+// Namespaces returns all Namespace objects.
+func (idx *Index) Namespaces() []*Object {
+	return idx.ByKind("Namespace")
+}
+
+// AppProjects returns all Argo CD AppProject objects.
+func (idx *Index) AppProjects() []*Object {
+	return idx.ByKind("AppProject")
+}
+
+// Applications returns all Argo CD Application objects.
+func (idx *Index) Applications() []*Object {
+	return idx.ByKind("Application")
+}
+
+// CustomResourceDefinitions returns all CustomResourceDefinition objects.
+func (idx *Index) CustomResourceDefinitions() []*Object {
+	return idx.ByKind("CustomResourceDefinition")
+}
@@ -0,0 +1,127 @@
+// Package manifest renders kustomizations of neco-apps in process and
+// provides helpers to inspect the rendered objects.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sYaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/yaml"
+)
+
+// Renderer runs `kustomize build` in process and caches the result for each directory.
+// The version of kustomize is pinned by sigs.k8s.io/kustomize/api in go.mod.
+// It is safe for concurrent use.
+type Renderer struct {
+	mu      sync.Mutex
+	results map[string]*result
+}
+
+type result struct {
+	once    sync.Once
+	yaml    []byte
+	objects []*unstructured.Unstructured
+	err     error
+}
+
+// NewRenderer creates a Renderer.
+func NewRenderer() *Renderer {
+	return &Renderer{
+		results: make(map[string]*result),
+	}
+}
+
+func (r *Renderer) render(dir string) (*result, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	res, ok := r.results[abs]
+	if !ok {
+		res = &result{}
+		r.results[abs] = res
+	}
+	r.mu.Unlock()
+
+	res.once.Do(func() {
+		res.yaml, res.objects, res.err = build(abs)
+	})
+	return res, nil
+}
+
+// Build returns the output of `kustomize build dir`.
+func (r *Renderer) Build(dir string) ([]byte, error) {
+	res, err := r.render(dir)
+	if err != nil {
+		return nil, err
+	}
+	return res.yaml, res.err
+}
+
+// Objects returns the objects rendered from dir.
+// The returned objects are shared between callers, so they must not be modified.
+func (r *Renderer) Objects(dir string) ([]*unstructured.Unstructured, error) {
+	res, err := r.render(dir)
+	if err != nil {
+		return nil, err
+	}
+	return res.objects, res.err
+}
+
+func build(dir string) ([]byte, []*unstructured.Unstructured, error) {
+	k := krusty.MakeKustomizer(filesys.MakeFsOnDisk(), krusty.MakeDefaultOptions())
+	resMap, err := k.Run(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("kustomize build failed. path: %s, err: %w", dir, err)
+	}
+	data, err := resMap.AsYaml()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode objects. path: %s, err: %w", dir, err)
+	}
+	objs, err := Decode(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode objects. path: %s, err: %w", dir, err)
+	}
+	return data, objs, nil
+}
+
+// Decode decodes a multi-document YAML stream into objects.
+// Empty documents are skipped.
+func Decode(data []byte) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	y := k8sYaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := y.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		js, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(bytes.TrimSpace(js), []byte("null")) {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		err = obj.UnmarshalJSON(js)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
@@ -1,7 +1,7 @@
 package test
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -12,6 +12,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
+func init() {
+	registerDiagnostics("metallb", []string{"metallb-system", "default"})
+}
+
 func prepareMetalLB() {
 
 	It("should deploy load balancer type service", func() {
@@ -70,25 +74,15 @@ spec:
   type: LoadBalancer
   externalTrafficPolicy: Local
 `
-		_, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "create", "-f", "-")
-		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
+		err := kube().Apply(context.Background(), manifest)
+		Expect(err).NotTo(HaveOccurred())
 	})
 }
 
 func testMetalLB() {
 	It("should be deployed successfully", func() {
-		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=metallb-system",
-				"get", "daemonsets/speaker", "-o=json")
-			if err != nil {
-				return err
-			}
-			ds := new(appsv1.DaemonSet)
-			err = json.Unmarshal(stdout, ds)
-			if err != nil {
-				return err
-			}
-
+		ds := new(appsv1.DaemonSet)
+		waitFor("metallb-system", "speaker", ds, func() error {
 			if ds.Status.DesiredNumberScheduled <= 0 {
 				return errors.New("speaker daemonset's desiredNumberScheduled is not updated")
 			}
@@ -97,79 +91,47 @@ func testMetalLB() {
 				return fmt.Errorf("not all nodes running speaker daemonset: %d", ds.Status.NumberAvailable)
 			}
 			return nil
-		}).Should(Succeed())
-
-		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=metallb-system",
-				"get", "deployments/controller", "-o=json")
-			if err != nil {
-				return err
-			}
-			deployment := new(appsv1.Deployment)
-			err = json.Unmarshal(stdout, deployment)
-			if err != nil {
-				return err
-			}
+		})
 
+		deployment := new(appsv1.Deployment)
+		waitFor("metallb-system", "controller", deployment, func() error {
 			if int(deployment.Status.AvailableReplicas) != 1 {
 				return fmt.Errorf("AvailableReplicas is not 1: %d", int(deployment.Status.AvailableReplicas))
 			}
 			return nil
-		}).Should(Succeed())
+		})
 
 		By("waiting pods are ready")
-		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "get", "deployments/testhttpd", "-o", "json")
-			if err != nil {
-				return err
-			}
-
-			deployment := new(appsv1.Deployment)
-			err = json.Unmarshal(stdout, deployment)
-			if err != nil {
-				return err
-			}
-
+		deployment = new(appsv1.Deployment)
+		waitFor("default", "testhttpd", deployment, func() error {
 			if deployment.Status.ReadyReplicas != 2 {
 				return errors.New("ReadyReplicas is not 2")
 			}
 			return nil
-		}).Should(Succeed())
+		})
 	})
 
 	It("should work", func() {
 		By("waiting service are ready")
-		var targetIP string
-		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "get", "service/testhttpd", "-o", "json")
-			if err != nil {
-				return err
-			}
-
-			service := new(corev1.Service)
-			err = json.Unmarshal(stdout, service)
-			if err != nil {
-				return err
-			}
-
+		service := new(corev1.Service)
+		waitFor("default", "testhttpd", service, func() error {
 			if len(service.Status.LoadBalancer.Ingress) == 0 {
 				return errors.New("LoadBalancer status is not updated")
 			}
-
-			targetIP = service.Status.LoadBalancer.Ingress[0].IP
 			return nil
-		}).Should(Succeed())
+		})
+		targetIP := service.Status.LoadBalancer.Ingress[0].IP
 
 		By("access service from boot-0")
 		Eventually(func() error {
-			_, _, err := ExecAt(boot0, "curl", targetIP, "-m", "5")
+			_, _, err := ExecAt(cfg.Boot0, "curl", targetIP, "-m", "5")
 			return err
 		}).Should(Succeed())
 
 		By("access service from external")
 		Eventually(func() error {
-			if placematMajorVersion == "1" {
-				return exec.Command("nsenter", "-n", "-t", externalPID, "curl", targetIP, "-m", "5").Run()
+			if cfg.PlacematMajorVersion == "1" {
+				return exec.Command("nsenter", "-n", "-t", cfg.ExternalPID, "curl", targetIP, "-m", "5").Run()
 			} else {
 				return exec.Command("ip", "netns", "exec", "external", "curl", targetIP, "-m", "5").Run()
 			}
@@ -1,15 +1,21 @@
 package test
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+func init() {
+	registerDiagnostics("moco", []string{"moco-system", "test-moco"})
+}
+
 func prepareMoco() {
 	It("should deploy mysqlcluster", func() {
 		// This manifest is based on the this example (https://github.com/cybozu-go/moco/blob/v0.7.0/docs/example_mysql_cluster.md).
@@ -153,48 +159,39 @@ data:
 
 		By("creating mysqlcluster")
 		createNamespaceIfNotExists("test-moco")
-		_, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
-		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
+		err := kube().Apply(context.Background(), manifest)
+		Expect(err).NotTo(HaveOccurred())
 	})
 }
 
 func testMoco() {
 	It("should be deployed successfully", func() {
-		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=moco-system",
-				"get", "deployment/moco-controller-manager", "-o=json")
-			if err != nil {
-				return err
-			}
-			deployment := new(appsv1.Deployment)
-			err = json.Unmarshal(stdout, deployment)
-			if err != nil {
-				return err
-			}
-
+		deployment := new(appsv1.Deployment)
+		waitFor("moco-system", "moco-controller-manager", deployment, func() error {
 			if int(deployment.Status.AvailableReplicas) != 1 {
 				return fmt.Errorf("AvailableReplicas is not 1: %d", int(deployment.Status.AvailableReplicas))
 			}
 			return nil
-		}).Should(Succeed())
+		})
 	})
 
 	It("should work", func() {
 		By("waiting mysqlcluster is ready")
-		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=test-moco", "get", "mysqlcluster/my-cluster", "-o", "jsonpath='{.status.ready}'")
+		cluster := new(unstructured.Unstructured)
+		cluster.SetGroupVersionKind(schema.GroupVersionKind{Group: "moco.cybozu.com", Version: "v1alpha1", Kind: "MySQLCluster"})
+		waitFor("test-moco", "my-cluster", cluster, func() error {
+			ready, _, err := unstructured.NestedString(cluster.Object, "status", "ready")
 			if err != nil {
 				return err
 			}
-
-			if string(stdout) != "True" {
+			if ready != "True" {
 				return errors.New("MySQLCluster is not ready")
 			}
 			return nil
-		}).Should(Succeed())
+		})
 
 		By("running kubectl moco mysql")
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "moco", "-n", "test-moco", "mysql", "-u", "root", "my-cluster", "--", "--version")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "moco", "-n", "test-moco", "mysql", "-u", "root", "my-cluster", "--", "--version")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 		Expect(string(stdout)).Should(ContainSubstring("mysql  Ver 8"))
 	})
@@ -25,21 +25,30 @@ import (
 )
 
 var (
-	globalHealthFQDN  = testID + "-ingress-health-global.gcp0.dev-ne.co"
-	bastionHealthFQDN = testID + "-ingress-health-bastion.gcp0.dev-ne.co"
+	globalHealthFQDN  = cfg.TestID + "-ingress-health-global.gcp0.dev-ne.co"
+	bastionHealthFQDN = cfg.TestID + "-ingress-health-bastion.gcp0.dev-ne.co"
 
-	bastionPushgatewayFQDN = testID + "-pushgateway-bastion.gcp0.dev-ne.co"
-	forestPushgatewayFQDN  = testID + "-pushgateway-forest.gcp0.dev-ne.co"
+	bastionPushgatewayFQDN = cfg.TestID + "-pushgateway-bastion.gcp0.dev-ne.co"
+	forestPushgatewayFQDN  = cfg.TestID + "-pushgateway-forest.gcp0.dev-ne.co"
 )
 
 var (
-	grafanaFQDN = testID + "-grafana.gcp0.dev-ne.co"
+	grafanaFQDN = cfg.TestID + "-grafana.gcp0.dev-ne.co"
 )
 
+func init() {
+	registerDiagnostics("victoriametrics-operator", []string{"monitoring"})
+	for _, name := range []string{"smallset", "largeset"} {
+		registerDiagnostics("vm"+name+"-components", []string{"monitoring"},
+			diagnosticsCommand{"vmalert-" + name + "-groups", []string{"kubectl", "exec", "-n", "monitoring", "deploy/vmalert-vmalert-" + name, "--", "curl", "-s", "http://localhost:8080/api/v1/groups"}},
+		)
+	}
+}
+
 func testMachinesEndpoints() {
 	It("should be deployed successfully", func() {
 		Eventually(func() error {
-			_, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			_, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "cronjob/machines-endpoints-cronjob")
 			if err != nil {
 				return err
@@ -51,7 +60,7 @@ func testMachinesEndpoints() {
 
 	It("should register endpoints", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "endpoints/prometheus-node-targets", "-o=json")
 			if err != nil {
 				return err
@@ -81,7 +90,7 @@ func testMachinesEndpoints() {
 func testKubeStateMetrics() {
 	It("should be deployed successfully", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=kube-system",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=kube-system",
 				"get", "deployment/kube-state-metrics", "-o=json")
 			if err != nil {
 				return err
@@ -139,7 +148,7 @@ spec:
 
 	It("should create HTTPProxy for Pushgateway", func() {
 		manifest := fmt.Sprintf(manifestBase, bastionPushgatewayFQDN, forestPushgatewayFQDN)
-		_, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 	})
 }
@@ -147,7 +156,7 @@ spec:
 func testPushgateway() {
 	It("should be deployed successfully", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "deployment/pushgateway", "-o=json")
 			if err != nil {
 				return err
@@ -167,7 +176,7 @@ func testPushgateway() {
 
 	It("should be accessed from Bastion", func() {
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0,
+			stdout, stderr, err := ExecAt(cfg.Boot0,
 				"curl", "-s", "http://"+bastionPushgatewayFQDN+"/-/healthy", "-o", "/dev/null",
 			)
 			if err != nil {
@@ -192,8 +201,8 @@ func testPushgateway() {
 			return nil
 		}).Should(Succeed())
 		Eventually(func() error {
-			if placematMajorVersion == "1" {
-				return exec.Command("nsenter", "-n", "-t", externalPID, "curl", "--resolve", forestPushgatewayFQDN+":80:"+forestIP, forestPushgatewayFQDN+"/-/healthy", "-m", "5").Run()
+			if cfg.PlacematMajorVersion == "1" {
+				return exec.Command("nsenter", "-n", "-t", cfg.ExternalPID, "curl", "--resolve", forestPushgatewayFQDN+":80:"+forestIP, forestPushgatewayFQDN+"/-/healthy", "-m", "5").Run()
 			} else {
 				return exec.Command("ip", "netns", "exec", "external", "curl", "--resolve", forestPushgatewayFQDN+":80:"+forestIP, forestPushgatewayFQDN+"/-/healthy", "-m", "5").Run()
 			}
@@ -253,7 +262,7 @@ spec:
         idle: 5m
 `, globalHealthFQDN, bastionHealthFQDN)
 
-		_, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "failed to create HTTPProxy. stderr: %s", stderr)
 	})
 }
@@ -262,7 +271,7 @@ func testIngressHealth() {
 	It("should be reported as healthy by ingress-watcher", func() {
 		By("checking ingress-health Deployment")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "deployment/ingress-health", "-o=json")
 			if err != nil {
 				return err
@@ -277,7 +286,7 @@ func testIngressHealth() {
 				return fmt.Errorf("AvailableReplicas is not 2: %d", int(deployment.Status.AvailableReplicas))
 			}
 
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "monitoring", "get", "service", "ingress-health-http")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "monitoring", "get", "service", "ingress-health-http")
 			if err != nil {
 				return fmt.Errorf("unable to get ingress-health-http. stdout: %s, stderr: %s, err: %w", stdout, stderr, err)
 			}
@@ -296,7 +305,7 @@ func testIngressHealth() {
 		By("comfirming ingress-watcher configuration file")
 		ingressWatcherConfPath := "/etc/ingress-watcher/ingress-watcher.yaml"
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "test", "-f", ingressWatcherConfPath)
+			stdout, stderr, err := ExecAt(cfg.Boot0, "test", "-f", ingressWatcherConfPath)
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -317,13 +326,13 @@ pushAddr: %s
 pushInterval: 10s
 permitInsecure: true
 `, bastionHealthFQDN, bastionHealthFQDN, globalHealthFQDN, globalHealthFQDN, bastionPushgatewayFQDN)
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(config), "sudo", "dd", "of="+ingressWatcherConfPath)
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(config), "sudo", "dd", "of="+ingressWatcherConfPath)
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
-		ExecSafeAt(boot0, "sudo", "systemctl", "restart", "ingress-watcher.service")
+		ExecSafeAt(cfg.Boot0, "sudo", "systemctl", "restart", "ingress-watcher.service")
 
 		By("getting metrics from push-gateway server")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "curl", "-s", "http://"+bastionPushgatewayFQDN+"/metrics")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "curl", "-s", "http://"+bastionPushgatewayFQDN+"/metrics")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -350,7 +359,7 @@ permitInsecure: true
 }
 
 func getLoadBalancerIP(namespace, service string) (string, error) {
-	stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", namespace, "get", "service", service, "-o=json")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", namespace, "get", "service", service, "-o=json")
 	if err != nil {
 		return "", fmt.Errorf("unable to get %s/%s. stdout: %s, stderr: %s, err: %w", namespace, service, stdout, stderr, err)
 	}
@@ -392,15 +401,30 @@ spec:
         idle: 5m
 `, grafanaFQDN)
 
-		_, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "failed to create HTTPProxy. stderr: %s", stderr)
 	})
 }
 
+// grafanaDashboardTitles returns the titles in the result of Grafana /api/search API.
+func grafanaDashboardTitles(data []byte) ([]string, error) {
+	var dashboards []struct {
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal(data, &dashboards); err != nil {
+		return nil, err
+	}
+	titles := make([]string, len(dashboards))
+	for i, d := range dashboards {
+		titles[i] = d.Title
+	}
+	return titles, nil
+}
+
 func testGrafanaOperator() {
 	It("should be deployed successfully", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "deployment/grafana-deployment", "-o=json")
 			if err != nil {
 				return err
@@ -426,7 +450,7 @@ func testGrafanaOperator() {
 	It("should have data sources and dashboards", func() {
 		By("getting admin stats from grafana")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "curl", "-kL", "-u", "admin:AUJUl1K2xgeqwMdZ3XlEFc1QhgEQItODMNzJwQme", grafanaFQDN+"/api/admin/stats")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "curl", "-kL", "-u", "admin:AUJUl1K2xgeqwMdZ3XlEFc1QhgEQItODMNzJwQme", grafanaFQDN+"/api/admin/stats")
 			if err != nil {
 				return fmt.Errorf("unable to get admin stats, stderr: %s, err: %v", stderr, err)
 			}
@@ -448,24 +472,19 @@ func testGrafanaOperator() {
 		}).Should(Succeed())
 
 		By("confirming all dashboards are successfully registered")
+		expected, err := expectedGrafanaDashboards(grafanaOperatorDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(expected).NotTo(BeEmpty())
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "curl", "-kL", "-u", "admin:AUJUl1K2xgeqwMdZ3XlEFc1QhgEQItODMNzJwQme", grafanaFQDN+"/api/search?type=dash-db")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "curl", "-kL", "-u", "admin:AUJUl1K2xgeqwMdZ3XlEFc1QhgEQItODMNzJwQme", grafanaFQDN+"/api/search?type=dash-db")
 			if err != nil {
 				return fmt.Errorf("unable to get dashboards, stderr: %s, err: %v", stderr, err)
 			}
-			var dashboards []struct {
-				ID int `json:"id"`
-			}
-			err = json.Unmarshal(stdout, &dashboards)
+			titles, err := grafanaDashboardTitles(stdout)
 			if err != nil {
 				return err
 			}
-
-			// NOTE: expectedNum is the number of files under monitoring/base/grafana/dashboards
-			if len(dashboards) != numGrafanaDashboard {
-				return fmt.Errorf("len(dashboards) should be %d: %d", numGrafanaDashboard, len(dashboards))
-			}
-			return nil
+			return checkGrafanaDashboards(expected, titles)
 		}).Should(Succeed())
 	})
 }
@@ -473,7 +492,7 @@ func testGrafanaOperator() {
 func testVictoriaMetricsOperator() {
 	It("should be deployed successfully", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "deployment/victoriametrics-operator", "-o=json")
 			if err != nil {
 				return err
@@ -529,7 +548,7 @@ type VMAlertAPIV1GroupsResult struct {
 func testVMCommonClusterComponents(setType vmSetType) {
 	It("should be deployed successfully (vmalertmanager)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "statefulset/vmalertmanager-vmalertmanager-"+setType.name, "-o=json")
 			if err != nil {
 				return err
@@ -549,7 +568,7 @@ func testVMCommonClusterComponents(setType vmSetType) {
 
 	It("should reply successfully (vmalertmanager)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "pods", "--selector=app.kubernetes.io/name=vmalertmanager,app.kubernetes.io/instance=vmalertmanager-"+setType.name, "-o=json")
 			if err != nil {
 				return err
@@ -565,7 +584,7 @@ func testVMCommonClusterComponents(setType vmSetType) {
 			for _, pod := range podList.Items {
 				podName := pod.Name
 
-				_, stderr, err := ExecAt(boot0, "kubectl", "--namespace=monitoring", "exec",
+				_, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring", "exec",
 					podName, "curl", "http://localhost:9093/-/healthy")
 				if err != nil {
 					return fmt.Errorf("unable to curl http://%s:9093/-/halthy, stderr: %s, err: %v", podName, stderr, err)
@@ -577,7 +596,7 @@ func testVMCommonClusterComponents(setType vmSetType) {
 
 	It("should be deployed successfully (vmalert)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "deployment/vmalert-vmalert-"+setType.name, "-o=json")
 			if err != nil {
 				return err
@@ -597,7 +616,7 @@ func testVMCommonClusterComponents(setType vmSetType) {
 
 	It("should be deployed successfully (vmagent)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "deployment/vmagent-vmagent-"+setType.name, "-o=json")
 			if err != nil {
 				return err
@@ -659,7 +678,7 @@ func testVMCommonClusterComponents(setType vmSetType) {
 
 		By("checking vmalerts")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "pods", "--selector=app.kubernetes.io/name=vmalert,app.kubernetes.io/instance=vmalert-"+setType.name, "-o=json")
 			if err != nil {
 				return err
@@ -675,7 +694,7 @@ func testVMCommonClusterComponents(setType vmSetType) {
 			for _, pod := range podList.Items {
 				podName := pod.Name
 
-				stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=monitoring", "exec",
+				stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring", "exec",
 					podName, "curl", "http://localhost:8080/api/v1/groups")
 				if err != nil {
 					return fmt.Errorf("unable to curl :8080/api/v1/groups, stderr: %s, err: %v", stderr, err)
@@ -762,7 +781,7 @@ func testVMCommonClusterComponents(setType vmSetType) {
 
 		By("checking vmagents")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "pods", "--selector=app.kubernetes.io/name=vmagent,app.kubernetes.io/instance=vmagent-"+setType.name, "-o=json")
 			if err != nil {
 				return err
@@ -778,7 +797,7 @@ func testVMCommonClusterComponents(setType vmSetType) {
 			for _, pod := range podList.Items {
 				podName := pod.Name
 
-				stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=monitoring", "exec",
+				stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring", "exec",
 					"-c", "vmagent", podName, "--",
 					"curl", "http://localhost:8429/api/v1/targets")
 				if err != nil {
@@ -830,7 +849,7 @@ func testVMSmallsetClusterComponents() {
 
 	It("should be deployed successfully (vmsingle)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "deployment/vmsingle-vmsingle-smallset", "-o=json")
 			if err != nil {
 				return err
@@ -850,7 +869,7 @@ func testVMSmallsetClusterComponents() {
 
 	It("should reply successfully (vmsingle)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "pods", "--selector=app.kubernetes.io/name=vmsingle,app.kubernetes.io/instance=vmsingle-smallset", "-o=json")
 			if err != nil {
 				return err
@@ -865,7 +884,7 @@ func testVMSmallsetClusterComponents() {
 			}
 			podName := podList.Items[0].Name
 
-			_, stderr, err := ExecAt(boot0, "kubectl", "--namespace=monitoring", "exec",
+			_, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring", "exec",
 				podName, "curl", "http://localhost:8429/api/v1/labels")
 			if err != nil {
 				return fmt.Errorf("unable to curl :8429/api/v1/labels, stderr: %s, err: %v", stderr, err)
@@ -890,7 +909,7 @@ func testVMLargesetClusterComponents() {
 
 	It("should be deployed successfully (vmstorage)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "statefulset/vmstorage-vmcluster-largeset", "-o=json")
 			if err != nil {
 				return err
@@ -910,7 +929,7 @@ func testVMLargesetClusterComponents() {
 
 	It("should be deployed successfully (vmselect)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "statefulset/vmselect-vmcluster-largeset", "-o=json")
 			if err != nil {
 				return err
@@ -930,7 +949,7 @@ func testVMLargesetClusterComponents() {
 
 	It("should be deployed successfully (vminsert)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "deployment/vminsert-vmcluster-largeset", "-o=json")
 			if err != nil {
 				return err
@@ -950,7 +969,7 @@ func testVMLargesetClusterComponents() {
 
 	It("should reply successfully (vmselect)", func() {
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=monitoring",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring",
 				"get", "pods", "--selector=app.kubernetes.io/name=vmselect,app.kubernetes.io/instance=vmcluster-largeset", "-o=json")
 			if err != nil {
 				return err
@@ -966,7 +985,7 @@ func testVMLargesetClusterComponents() {
 			for _, pod := range podList.Items {
 				podName := pod.Name
 
-				_, stderr, err := ExecAt(boot0, "kubectl", "--namespace=monitoring", "exec",
+				_, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring", "exec",
 					podName, "curl", "http://localhost:8481/select/0/prometheus/api/v1/labels")
 				if err != nil {
 					return fmt.Errorf("unable to curl http://%s:8429/select/0/prometheus/api/v1/labels, stderr: %s, err: %v", podName, stderr, err)
@@ -0,0 +1,114 @@
+package netpol
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	testCases := []struct {
+		selector string
+		labels   map[string]string
+		expected bool
+	}{
+		{"all()", map[string]string{}, true},
+		{"all()", nil, false},
+		{"global()", nil, true},
+		{"global()", map[string]string{}, false},
+		{"role == 'node'", map[string]string{"role": "node"}, true},
+		{"role == 'node'", map[string]string{"role": "bmc"}, false},
+		{"role != 'node'", map[string]string{}, true},
+		{"has(role)", map[string]string{"role": ""}, true},
+		{"!has(role)", map[string]string{"role": ""}, false},
+		{"a == 'x' && b == \"y\"", map[string]string{"a": "x", "b": "y"}, true},
+		{"a == 'x' && b == 'y'", map[string]string{"a": "x"}, false},
+		{"a == 'x' || b == 'y'", map[string]string{"b": "y"}, true},
+		{"!(a == 'x' || b == 'y')", map[string]string{"b": "y"}, false},
+		{"team in {'neco', 'maneki'}", map[string]string{"team": "maneki"}, true},
+		{"team not in {'neco', 'maneki'}", map[string]string{"team": "maneki"}, false},
+		{"app.kubernetes.io/name starts with 'ingress-'", map[string]string{"app.kubernetes.io/name": "ingress-global"}, true},
+		{"name ends with 'set'", map[string]string{"name": "largeset"}, true},
+		{"name contains 'ge'", map[string]string{"name": "largeset"}, true},
+	}
+
+	for _, tc := range testCases {
+		sel, err := ParseSelector(tc.selector)
+		if err != nil {
+			t.Errorf("failed to parse %s: %v", tc.selector, err)
+			continue
+		}
+		if actual := sel.Matches(tc.labels); actual != tc.expected {
+			t.Errorf("%s for %v: expected %v, actual %v", tc.selector, tc.labels, tc.expected, actual)
+		}
+	}
+
+	for _, s := range []string{"", "a ==", "a == 'x", "a in {'x'", "has(a", "(a == 'x'", "a = 'x'", "a == 'x' b"} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+const testObjects = `[
+  {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "sys", "labels": {"team": "neco"}}},
+  {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "app", "labels": {"team": "maneki"}}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "GlobalNetworkSet", "metadata": {"name": "node", "labels": {"role": "node"}}, "spec": {"nets": ["10.69.0.0/16"]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "GlobalNetworkSet", "metadata": {"name": "cluster", "labels": {"role": "cluster"}}, "spec": {"nets": ["10.0.0.0/8"]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "NetworkSet", "metadata": {"name": "node", "namespace": "sys", "labels": {"role": "node"}}, "spec": {"nets": ["10.69.0.0/16"]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "GlobalNetworkPolicy", "metadata": {"name": "egress-all-allow"}, "spec": {"order": 10000, "types": ["Egress"], "egress": [{"action": "Allow"}]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "GlobalNetworkPolicy", "metadata": {"name": "egress-node-deny"}, "spec": {"order": 900, "types": ["Egress"], "egress": [{"action": "Deny", "destination": {"selector": "role == 'node'"}}]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "GlobalNetworkPolicy", "metadata": {"name": "egress-node-dns-allow"}, "spec": {"order": 500, "types": ["Egress"], "egress": [{"action": "Allow", "protocol": "UDP", "destination": {"selector": "role == 'node'", "ports": [53]}}]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "GlobalNetworkPolicy", "metadata": {"name": "ingress-all-deny"}, "spec": {"order": 10000, "types": ["Ingress"], "ingress": [{"action": "Deny"}]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "GlobalNetworkPolicy", "metadata": {"name": "ingress-cluster-allow"}, "spec": {"order": 9900, "types": ["Ingress"], "ingress": [{"action": "Allow", "source": {"selector": "role == 'cluster'"}}]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "NetworkPolicy", "metadata": {"name": "egress-exporter", "namespace": "sys"}, "spec": {"order": 500, "selector": "app == 'agent'", "types": ["Egress"], "egress": [{"action": "Allow", "protocol": "TCP", "destination": {"selector": "role == 'node'", "ports": ["9100:9105"]}}]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "NetworkPolicy", "metadata": {"name": "egress-global-set", "namespace": "app"}, "spec": {"order": 500, "types": ["Egress"], "egress": [{"action": "Allow", "protocol": "TCP", "destination": {"selector": "role == 'node'", "ports": [9100]}}]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "NetworkPolicy", "metadata": {"name": "ingress-web", "namespace": "app"}, "spec": {"order": 900, "selector": "app == 'web'", "ingress": [{"action": "Allow", "protocol": "TCP", "destination": {"ports": [8080]}}]}},
+  {"apiVersion": "crd.projectcalico.org/v1", "kind": "NetworkPolicy", "metadata": {"name": "ingress-from-neco", "namespace": "app"}, "spec": {"order": 800, "selector": "app == 'db'", "ingress": [{"action": "Allow", "source": {"namespaceSelector": "team == 'neco'"}}, {"action": "Deny"}]}}
+]`
+
+func TestSimulator(t *testing.T) {
+	var objs []map[string]interface{}
+	if err := json.Unmarshal([]byte(testObjects), &objs); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSimulator()
+	if err := s.Load(objs); err != nil {
+		t.Fatal(err)
+	}
+
+	agent := Endpoint{Namespace: "sys", Labels: map[string]string{"app": "agent"}, IP: net.ParseIP("10.64.0.1")}
+	other := Endpoint{Namespace: "sys", Labels: map[string]string{"app": "other"}, IP: net.ParseIP("10.64.0.2")}
+	client := Endpoint{Namespace: "app", Labels: map[string]string{"app": "client"}, IP: net.ParseIP("10.64.0.3")}
+	web := Endpoint{Namespace: "app", Labels: map[string]string{"app": "web"}, IP: net.ParseIP("10.64.0.4")}
+	db := Endpoint{Namespace: "app", Labels: map[string]string{"app": "db"}, IP: net.ParseIP("10.64.0.5")}
+	node := Endpoint{IP: net.ParseIP("10.69.0.4")}
+	external := Endpoint{IP: net.ParseIP("203.0.113.1")}
+
+	testCases := []struct {
+		name     string
+		pkt      Packet
+		expected bool
+	}{
+		{"dns to node", Packet{Source: other, Destination: node, Protocol: "UDP", Port: 53}, true},
+		{"dns over tcp to node", Packet{Source: other, Destination: node, Protocol: "TCP", Port: 53}, false},
+		{"icmp to node", Packet{Source: other, Destination: node, Protocol: "ICMP"}, false},
+		{"exporter by agent", Packet{Source: agent, Destination: node, Protocol: "TCP", Port: 9105}, true},
+		{"exporter out of range", Packet{Source: agent, Destination: node, Protocol: "TCP", Port: 9106}, false},
+		{"exporter by other", Packet{Source: other, Destination: node, Protocol: "TCP", Port: 9100}, false},
+		{"GlobalNetworkSet is not selected by NetworkPolicy", Packet{Source: client, Destination: node, Protocol: "TCP", Port: 9100}, false},
+		{"pod to pod", Packet{Source: agent, Destination: client, Protocol: "TCP", Port: 80}, true},
+		{"external to pod", Packet{Source: external, Destination: client, Protocol: "TCP", Port: 80}, false},
+		{"external to web", Packet{Source: external, Destination: web, Protocol: "TCP", Port: 8080}, true},
+		{"external to web with wrong port", Packet{Source: external, Destination: web, Protocol: "TCP", Port: 80}, false},
+		{"neco to db", Packet{Source: other, Destination: db, Protocol: "TCP", Port: 3306}, true},
+		{"maneki to db", Packet{Source: client, Destination: db, Protocol: "TCP", Port: 3306}, false},
+	}
+
+	for _, tc := range testCases {
+		v := s.Check(tc.pkt)
+		if v.Allowed != tc.expected {
+			t.Errorf("%s: %s: expected %v, actual %v (%s)", tc.name, tc.pkt, tc.expected, v.Allowed, v.Reason)
+		}
+	}
+}
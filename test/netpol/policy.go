@@ -0,0 +1,385 @@
+// Package netpol simulates Calico network policies offline.
+//
+// It loads GlobalNetworkPolicy, NetworkPolicy, GlobalNetworkSet and NetworkSet
+// objects of crd.projectcalico.org/v1 and decides whether a packet between two
+// endpoints is allowed.  Only the features used in neco-apps are implemented;
+// tiers, host endpoints, service accounts and named ports are not supported.
+package netpol
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Direction of policies.
+const (
+	Ingress = "Ingress"
+	Egress  = "Egress"
+)
+
+// Actions of rules.
+const (
+	ActionAllow = "Allow"
+	ActionDeny  = "Deny"
+	ActionPass  = "Pass"
+	ActionLog   = "Log"
+)
+
+type rawEntityRule struct {
+	Nets              []string      `json:"nets,omitempty"`
+	NotNets           []string      `json:"notNets,omitempty"`
+	Selector          string        `json:"selector,omitempty"`
+	NotSelector       string        `json:"notSelector,omitempty"`
+	NamespaceSelector string        `json:"namespaceSelector,omitempty"`
+	Ports             []interface{} `json:"ports,omitempty"`
+	NotPorts          []interface{} `json:"notPorts,omitempty"`
+}
+
+type rawRule struct {
+	Action      string        `json:"action"`
+	Protocol    interface{}   `json:"protocol,omitempty"`
+	NotProtocol interface{}   `json:"notProtocol,omitempty"`
+	Source      rawEntityRule `json:"source,omitempty"`
+	Destination rawEntityRule `json:"destination,omitempty"`
+}
+
+type rawPolicy struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Order             *float64  `json:"order,omitempty"`
+		Selector          string    `json:"selector,omitempty"`
+		NamespaceSelector string    `json:"namespaceSelector,omitempty"`
+		Types             []string  `json:"types,omitempty"`
+		Ingress           []rawRule `json:"ingress,omitempty"`
+		Egress            []rawRule `json:"egress,omitempty"`
+		Nets              []string  `json:"nets,omitempty"`
+	} `json:"spec"`
+}
+
+type portRange struct {
+	min, max int
+}
+
+type entityRule struct {
+	nets              []*net.IPNet
+	notNets           []*net.IPNet
+	selector          Selector
+	notSelector       Selector
+	namespaceSelector Selector
+	ports             []portRange
+	notPorts          []portRange
+}
+
+type rule struct {
+	action      string
+	protocol    string
+	notProtocol string
+	source      entityRule
+	destination entityRule
+}
+
+type policy struct {
+	// name is "namespace/name" for NetworkPolicy.
+	name string
+	// namespace is empty for GlobalNetworkPolicy.
+	namespace         string
+	order             float64
+	selector          Selector
+	namespaceSelector Selector
+	ingress           []rule
+	egress            []rule
+	types             map[string]bool
+}
+
+type networkSet struct {
+	name string
+	// namespace is empty for GlobalNetworkSet.
+	namespace string
+	labels    map[string]string
+	nets      []*net.IPNet
+}
+
+// Simulator decides whether packets are allowed by the loaded policies.
+type Simulator struct {
+	policies    []*policy
+	networkSets []*networkSet
+	namespaces  map[string]map[string]string
+}
+
+// NewSimulator creates a Simulator without any policies.
+// Without policies, all packets are allowed.
+func NewSimulator() *Simulator {
+	return &Simulator{
+		namespaces: make(map[string]map[string]string),
+	}
+}
+
+// Load loads objects decoded from JSON or YAML.
+// Namespace objects are used to evaluate namespaceSelector.
+// Objects of other kinds are ignored.
+func (s *Simulator) Load(objs []map[string]interface{}) error {
+	for _, obj := range objs {
+		kind, _ := obj["kind"].(string)
+		switch kind {
+		case "GlobalNetworkPolicy", "NetworkPolicy", "GlobalNetworkSet", "NetworkSet", "Namespace":
+		default:
+			continue
+		}
+		if kind == "NetworkPolicy" {
+			// Kubernetes NetworkPolicy is not supported.
+			apiVersion, _ := obj["apiVersion"].(string)
+			if !strings.HasPrefix(apiVersion, "crd.projectcalico.org/") {
+				continue
+			}
+		}
+
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		var raw rawPolicy
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("failed to decode %s %s: %w", kind, raw.Metadata.Name, err)
+		}
+
+		switch kind {
+		case "Namespace":
+			labels := map[string]string{}
+			for k, v := range raw.Metadata.Labels {
+				labels[k] = v
+			}
+			s.namespaces[raw.Metadata.Name] = labels
+		case "GlobalNetworkSet", "NetworkSet":
+			set := &networkSet{
+				name:      raw.Metadata.Name,
+				namespace: raw.Metadata.Namespace,
+				labels:    raw.Metadata.Labels,
+			}
+			if set.labels == nil {
+				set.labels = map[string]string{}
+			}
+			set.nets, err = parseNets(raw.Spec.Nets)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", kind, raw.Metadata.Name, err)
+			}
+			s.networkSets = append(s.networkSets, set)
+		default:
+			p, err := newPolicy(&raw)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", kind, raw.Metadata.Name, err)
+			}
+			s.policies = append(s.policies, p)
+		}
+	}
+
+	sort.SliceStable(s.policies, func(i, j int) bool {
+		if s.policies[i].order != s.policies[j].order {
+			return s.policies[i].order < s.policies[j].order
+		}
+		return s.policies[i].name < s.policies[j].name
+	})
+	return nil
+}
+
+func newPolicy(raw *rawPolicy) (*policy, error) {
+	p := &policy{
+		name:      raw.Metadata.Name,
+		namespace: raw.Metadata.Namespace,
+		order:     math.Inf(1),
+		types:     make(map[string]bool),
+	}
+	if p.namespace != "" {
+		p.name = p.namespace + "/" + p.name
+	}
+	if raw.Spec.Order != nil {
+		p.order = *raw.Spec.Order
+	}
+
+	var err error
+	if raw.Spec.Selector == "" {
+		p.selector = allSelector{}
+	} else if p.selector, err = ParseSelector(raw.Spec.Selector); err != nil {
+		return nil, err
+	}
+	if raw.Spec.NamespaceSelector != "" {
+		if p.namespaceSelector, err = ParseSelector(raw.Spec.NamespaceSelector); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range raw.Spec.Ingress {
+		rr, err := newRule(&r)
+		if err != nil {
+			return nil, err
+		}
+		p.ingress = append(p.ingress, rr)
+	}
+	for _, r := range raw.Spec.Egress {
+		rr, err := newRule(&r)
+		if err != nil {
+			return nil, err
+		}
+		p.egress = append(p.egress, rr)
+	}
+
+	if len(raw.Spec.Types) == 0 {
+		// Same as the defaulting of Calico.
+		if len(p.ingress) > 0 || len(p.egress) == 0 {
+			p.types[Ingress] = true
+		}
+		if len(p.egress) > 0 {
+			p.types[Egress] = true
+		}
+	}
+	for _, t := range raw.Spec.Types {
+		if t != Ingress && t != Egress {
+			return nil, fmt.Errorf("unknown type %s", t)
+		}
+		p.types[t] = true
+	}
+	return p, nil
+}
+
+func newRule(raw *rawRule) (rule, error) {
+	r := rule{action: raw.Action}
+	switch r.action {
+	case ActionAllow, ActionDeny, ActionPass, ActionLog:
+	default:
+		return r, fmt.Errorf("unknown action %q", r.action)
+	}
+
+	var err error
+	if r.protocol, err = parseProtocol(raw.Protocol); err != nil {
+		return r, err
+	}
+	if r.notProtocol, err = parseProtocol(raw.NotProtocol); err != nil {
+		return r, err
+	}
+	if len(raw.Source.Ports) > 0 || len(raw.Source.NotPorts) > 0 {
+		return r, fmt.Errorf("source ports are not supported")
+	}
+	if r.source, err = newEntityRule(&raw.Source); err != nil {
+		return r, err
+	}
+	if r.destination, err = newEntityRule(&raw.Destination); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func newEntityRule(raw *rawEntityRule) (entityRule, error) {
+	var e entityRule
+	var err error
+	if e.nets, err = parseNets(raw.Nets); err != nil {
+		return e, err
+	}
+	if e.notNets, err = parseNets(raw.NotNets); err != nil {
+		return e, err
+	}
+	if raw.Selector != "" {
+		if e.selector, err = ParseSelector(raw.Selector); err != nil {
+			return e, err
+		}
+	}
+	if raw.NotSelector != "" {
+		if e.notSelector, err = ParseSelector(raw.NotSelector); err != nil {
+			return e, err
+		}
+	}
+	if raw.NamespaceSelector != "" {
+		if e.namespaceSelector, err = ParseSelector(raw.NamespaceSelector); err != nil {
+			return e, err
+		}
+	}
+	if e.ports, err = parsePorts(raw.Ports); err != nil {
+		return e, err
+	}
+	if e.notPorts, err = parsePorts(raw.NotPorts); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// parseProtocol normalizes a protocol given by name or number.
+func parseProtocol(v interface{}) (string, error) {
+	switch p := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return normalizeProtocol(p), nil
+	case float64:
+		return normalizeProtocol(strconv.Itoa(int(p))), nil
+	}
+	return "", fmt.Errorf("invalid protocol %v", v)
+}
+
+var protocolNumbers = map[string]string{
+	"1":   "ICMP",
+	"6":   "TCP",
+	"17":  "UDP",
+	"58":  "ICMPV6",
+	"132": "SCTP",
+}
+
+func normalizeProtocol(p string) string {
+	p = strings.ToUpper(p)
+	if name, ok := protocolNumbers[p]; ok {
+		return name
+	}
+	return p
+}
+
+func parseNets(nets []string) ([]*net.IPNet, error) {
+	var ret []*net.IPNet
+	for _, n := range nets {
+		if !strings.Contains(n, "/") {
+			if strings.Contains(n, ":") {
+				n += "/128"
+			} else {
+				n += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ipnet)
+	}
+	return ret, nil
+}
+
+func parsePorts(ports []interface{}) ([]portRange, error) {
+	var ret []portRange
+	for _, p := range ports {
+		switch v := p.(type) {
+		case float64:
+			ret = append(ret, portRange{min: int(v), max: int(v)})
+		case string:
+			fields := strings.SplitN(v, ":", 2)
+			min, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("named port %q is not supported", v)
+			}
+			max := min
+			if len(fields) == 2 {
+				if max, err = strconv.Atoi(fields[1]); err != nil {
+					return nil, fmt.Errorf("invalid port range %q", v)
+				}
+			}
+			ret = append(ret, portRange{min: min, max: max})
+		default:
+			return nil, fmt.Errorf("invalid port %v", p)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,306 @@
+package netpol
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Selector is a parsed Calico selector expression such as `app == 'foo' && has(bar)`.
+//
+// Labels passed to Matches must be non-nil for endpoints and namespaces.
+// A nil map represents the global scope, which only `global()` matches.
+type Selector interface {
+	Matches(labels map[string]string) bool
+	String() string
+}
+
+// ParseSelector parses a Calico selector.
+// The following expressions are supported:
+// all(), global(), has(k), k == 'v', k != 'v', k in {'v1', 'v2'}, k not in {...},
+// k starts with 'v', k ends with 'v', k contains 'v', !, &&, || and parentheses.
+func ParseSelector(s string) (Selector, error) {
+	p := &selectorParser{src: s}
+	sel, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+	}
+	p.skipSpaces()
+	if p.pos != len(p.src) {
+		return nil, fmt.Errorf("invalid selector %q: unexpected %q", s, p.src[p.pos:])
+	}
+	return sel, nil
+}
+
+type allSelector struct{}
+
+func (allSelector) Matches(labels map[string]string) bool { return labels != nil }
+func (allSelector) String() string                        { return "all()" }
+
+type globalSelector struct{}
+
+func (globalSelector) Matches(labels map[string]string) bool { return labels == nil }
+func (globalSelector) String() string                        { return "global()" }
+
+type hasSelector struct{ key string }
+
+func (s hasSelector) Matches(labels map[string]string) bool {
+	_, ok := labels[s.key]
+	return ok
+}
+func (s hasSelector) String() string { return "has(" + s.key + ")" }
+
+type compareSelector struct {
+	key    string
+	op     string
+	values []string
+}
+
+func (s compareSelector) Matches(labels map[string]string) bool {
+	v, ok := labels[s.key]
+	switch s.op {
+	case "==":
+		return ok && v == s.values[0]
+	case "!=":
+		return !ok || v != s.values[0]
+	case "in":
+		return ok && containsString(s.values, v)
+	case "not in":
+		return !ok || !containsString(s.values, v)
+	case "starts with":
+		return ok && strings.HasPrefix(v, s.values[0])
+	case "ends with":
+		return ok && strings.HasSuffix(v, s.values[0])
+	case "contains":
+		return ok && strings.Contains(v, s.values[0])
+	}
+	return false
+}
+
+func (s compareSelector) String() string {
+	quoted := make([]string, len(s.values))
+	for i, v := range s.values {
+		quoted[i] = "'" + v + "'"
+	}
+	if s.op == "in" || s.op == "not in" {
+		return s.key + " " + s.op + " {" + strings.Join(quoted, ", ") + "}"
+	}
+	return s.key + " " + s.op + " " + quoted[0]
+}
+
+type notSelector struct{ sel Selector }
+
+func (s notSelector) Matches(labels map[string]string) bool { return !s.sel.Matches(labels) }
+func (s notSelector) String() string                        { return "!(" + s.sel.String() + ")" }
+
+type andSelector []Selector
+
+func (s andSelector) Matches(labels map[string]string) bool {
+	for _, sel := range s {
+		if !sel.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s andSelector) String() string { return joinSelectors(s, " && ") }
+
+type orSelector []Selector
+
+func (s orSelector) Matches(labels map[string]string) bool {
+	for _, sel := range s {
+		if sel.Matches(labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s orSelector) String() string { return joinSelectors(s, " || ") }
+
+func joinSelectors(sels []Selector, sep string) string {
+	strs := make([]string, len(sels))
+	for i, sel := range sels {
+		strs[i] = sel.String()
+	}
+	return "(" + strings.Join(strs, sep) + ")"
+}
+
+type selectorParser struct {
+	src string
+	pos int
+}
+
+func (p *selectorParser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume consumes tok if the rest of the input starts with it.
+func (p *selectorParser) consume(tok string) bool {
+	p.skipSpaces()
+	if strings.HasPrefix(p.src[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *selectorParser) parseOr() (Selector, error) {
+	sel, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	sels := orSelector{sel}
+	for p.consume("||") {
+		sel, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 1 {
+		return sels[0], nil
+	}
+	return sels, nil
+}
+
+func (p *selectorParser) parseAnd() (Selector, error) {
+	sel, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	sels := andSelector{sel}
+	for p.consume("&&") {
+		sel, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 1 {
+		return sels[0], nil
+	}
+	return sels, nil
+}
+
+func (p *selectorParser) parseUnary() (Selector, error) {
+	if p.consume("!") {
+		sel, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notSelector{sel}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *selectorParser) parsePrimary() (Selector, error) {
+	switch {
+	case p.consume("("):
+		sel, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing ) at %d", p.pos)
+		}
+		return sel, nil
+	case p.consume("all()"):
+		return allSelector{}, nil
+	case p.consume("global()"):
+		return globalSelector{}, nil
+	case p.consume("has("):
+		key := p.parseKey()
+		if key == "" || !p.consume(")") {
+			return nil, fmt.Errorf("invalid has() at %d", p.pos)
+		}
+		return hasSelector{key: key}, nil
+	}
+
+	key := p.parseKey()
+	if key == "" {
+		return nil, fmt.Errorf("label key is expected at %d", p.pos)
+	}
+	for _, op := range []string{"==", "!=", "not in", "in", "starts with", "ends with", "contains"} {
+		if !p.consume(op) {
+			continue
+		}
+		if op == "in" || op == "not in" {
+			values, err := p.parseSet()
+			if err != nil {
+				return nil, err
+			}
+			return compareSelector{key: key, op: op, values: values}, nil
+		}
+		v, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return compareSelector{key: key, op: op, values: []string{v}}, nil
+	}
+	return nil, fmt.Errorf("operator is expected at %d", p.pos)
+}
+
+func isKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '/' || c == '-'
+}
+
+func (p *selectorParser) parseKey() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.src) && isKeyChar(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *selectorParser) parseString() (string, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.src) || (p.src[p.pos] != '\'' && p.src[p.pos] != '"') {
+		return "", fmt.Errorf("quoted string is expected at %d", p.pos)
+	}
+	quote := p.src[p.pos]
+	end := strings.IndexByte(p.src[p.pos+1:], quote)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string at %d", p.pos)
+	}
+	v := p.src[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return v, nil
+}
+
+func (p *selectorParser) parseSet() ([]string, error) {
+	if !p.consume("{") {
+		return nil, fmt.Errorf("{ is expected at %d", p.pos)
+	}
+	var values []string
+	if p.consume("}") {
+		return values, nil
+	}
+	for {
+		v, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if p.consume("}") {
+			return values, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf(", or } is expected at %d", p.pos)
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package netpol
+
+import (
+	"fmt"
+	"net"
+)
+
+// Endpoint is a source or destination of packets.
+type Endpoint struct {
+	// Namespace is the namespace of a Pod.
+	// It must be empty for endpoints outside of Kubernetes, e.g. nodes and BMCs.
+	Namespace string
+	// Labels are the labels of a Pod.
+	Labels map[string]string
+	IP     net.IP
+}
+
+// Packet is a packet sent from Source to Destination.
+type Packet struct {
+	Source      Endpoint
+	Destination Endpoint
+	// Protocol is a protocol name such as "TCP", "UDP" and "ICMP".
+	Protocol string
+	// Port is the destination port.  It is ignored for ICMP.
+	Port int
+}
+
+func (p Packet) String() string {
+	src := p.Source.IP.String()
+	if p.Source.Namespace != "" {
+		src = p.Source.Namespace + "(" + src + ")"
+	}
+	dst := p.Destination.IP.String()
+	if p.Destination.Namespace != "" {
+		dst = p.Destination.Namespace + "(" + dst + ")"
+	}
+	if p.Port == 0 {
+		return fmt.Sprintf("%s -> %s %s", src, dst, p.Protocol)
+	}
+	return fmt.Sprintf("%s -> %s %s/%d", src, dst, p.Protocol, p.Port)
+}
+
+// Verdict is the result of Check.
+type Verdict struct {
+	Allowed bool
+	// Reason describes the policy that decided the verdict.
+	Reason string
+}
+
+// Check decides whether pkt is allowed.
+// A packet is allowed if it is allowed by both the egress policies of the source
+// and the ingress policies of the destination.
+func (s *Simulator) Check(pkt Packet) Verdict {
+	pkt.Protocol = normalizeProtocol(pkt.Protocol)
+	if pkt.Source.Namespace != "" {
+		if v := s.evaluate(Egress, pkt.Source, pkt); !v.Allowed {
+			return v
+		}
+	}
+	if pkt.Destination.Namespace != "" {
+		if v := s.evaluate(Ingress, pkt.Destination, pkt); !v.Allowed {
+			return v
+		}
+	}
+	return Verdict{Allowed: true, Reason: "allowed"}
+}
+
+func (s *Simulator) namespaceLabels(name string) map[string]string {
+	labels := map[string]string{}
+	for k, v := range s.namespaces[name] {
+		labels[k] = v
+	}
+	labels["projectcalico.org/name"] = name
+	return labels
+}
+
+func endpointLabels(ep Endpoint) map[string]string {
+	labels := map[string]string{}
+	for k, v := range ep.Labels {
+		labels[k] = v
+	}
+	labels["projectcalico.org/namespace"] = ep.Namespace
+	labels["projectcalico.org/orchestrator"] = "k8s"
+	return labels
+}
+
+func (s *Simulator) applies(p *policy, direction string, ep Endpoint) bool {
+	if !p.types[direction] {
+		return false
+	}
+	if p.namespace != "" && p.namespace != ep.Namespace {
+		return false
+	}
+	if p.namespaceSelector != nil && !p.namespaceSelector.Matches(s.namespaceLabels(ep.Namespace)) {
+		return false
+	}
+	return p.selector.Matches(endpointLabels(ep))
+}
+
+// evaluate evaluates the policies of direction applied to ep.
+func (s *Simulator) evaluate(direction string, ep Endpoint, pkt Packet) Verdict {
+	applied := false
+	for _, p := range s.policies {
+		if !s.applies(p, direction, ep) {
+			continue
+		}
+		applied = true
+
+		rules := p.ingress
+		if direction == Egress {
+			rules = p.egress
+		}
+		for i, r := range rules {
+			if !s.ruleMatches(p, &r, pkt) {
+				continue
+			}
+			reason := fmt.Sprintf("%s rule %d of %s", direction, i, p.name)
+			switch r.action {
+			case ActionAllow:
+				return Verdict{Allowed: true, Reason: "allowed by " + reason}
+			case ActionDeny:
+				return Verdict{Allowed: false, Reason: "denied by " + reason}
+			case ActionPass:
+				// There is only one tier, so the profile of Kubernetes allows the packet.
+				return Verdict{Allowed: true, Reason: "passed by " + reason}
+			}
+		}
+	}
+	if !applied {
+		return Verdict{Allowed: true, Reason: "no " + direction + " policy"}
+	}
+	return Verdict{Allowed: false, Reason: "no " + direction + " rule matched"}
+}
+
+func (s *Simulator) ruleMatches(p *policy, r *rule, pkt Packet) bool {
+	if r.protocol != "" && r.protocol != pkt.Protocol {
+		return false
+	}
+	if r.notProtocol != "" && r.notProtocol == pkt.Protocol {
+		return false
+	}
+	if !s.entityMatches(p, &r.source, pkt.Source) {
+		return false
+	}
+	if !s.entityMatches(p, &r.destination, pkt.Destination) {
+		return false
+	}
+	if pkt.Protocol == "TCP" || pkt.Protocol == "UDP" || pkt.Protocol == "SCTP" {
+		if len(r.destination.ports) > 0 && !portIn(r.destination.ports, pkt.Port) {
+			return false
+		}
+		if portIn(r.destination.notPorts, pkt.Port) {
+			return false
+		}
+	} else if len(r.destination.ports) > 0 {
+		return false
+	}
+	return true
+}
+
+func (s *Simulator) entityMatches(p *policy, e *entityRule, ep Endpoint) bool {
+	if len(e.nets) > 0 && !netsContain(e.nets, ep.IP) {
+		return false
+	}
+	if netsContain(e.notNets, ep.IP) {
+		return false
+	}
+	if e.selector != nil || e.namespaceSelector != nil {
+		if !s.selectorMatches(p, e.namespaceSelector, e.selector, ep) {
+			return false
+		}
+	}
+	if e.notSelector != nil && s.selectorMatches(p, e.namespaceSelector, e.notSelector, ep) {
+		return false
+	}
+	return true
+}
+
+// selectorMatches returns true if ep is selected by the selectors in a rule of p.
+// Like Calico, selectors select the IP addresses of the matching Pods and network sets.
+//
+// In NetworkPolicy, selectors select Pods and NetworkSets in the same namespace unless
+// namespaceSelector is specified.  GlobalNetworkSets are selected only by `global()`.
+// In GlobalNetworkPolicy, selectors select all Pods and network sets.
+func (s *Simulator) selectorMatches(p *policy, nsSel, sel Selector, ep Endpoint) bool {
+	inScope := func(namespace string) bool {
+		var nsLabels map[string]string
+		if namespace != "" {
+			nsLabels = s.namespaceLabels(namespace)
+		}
+		if nsSel != nil {
+			return nsSel.Matches(nsLabels)
+		}
+		if p.namespace != "" {
+			return namespace == p.namespace
+		}
+		return true
+	}
+
+	if ep.Namespace != "" && inScope(ep.Namespace) {
+		if sel == nil || sel.Matches(endpointLabels(ep)) {
+			return true
+		}
+	}
+	for _, set := range s.networkSets {
+		if !netsContain(set.nets, ep.IP) || !inScope(set.namespace) {
+			continue
+		}
+		if sel == nil || sel.Matches(set.labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func netsContain(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func portIn(ports []portRange, port int) bool {
+	for _, r := range ports {
+		if r.min <= port && port <= r.max {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/cybozu-go/neco-apps/test/netpol"
+)
+
+// netpolPod returns a Pod endpoint labeled with app.kubernetes.io/name.
+func netpolPod(namespace, name string) netpol.Endpoint {
+	return netpol.Endpoint{
+		Namespace: namespace,
+		Labels:    map[string]string{"app.kubernetes.io/name": name},
+		IP:        net.ParseIP("10.64.1.1"),
+	}
+}
+
+// testNetworkPolicySimulation checks the expectations of testNetworkPolicy offline
+// by simulating the Calico policies in network-policy/base.
+func testNetworkPolicySimulation(t *testing.T) {
+	t.Parallel()
+
+	sim := netpol.NewSimulator()
+	for _, dir := range []string{"namespaces/base", "network-policy/base"} {
+		var objs []map[string]interface{}
+		for _, obj := range loadSourceIndex(t, dir).All() {
+			objs = append(objs, obj.Object)
+		}
+		if err := sim.Load(objs); err != nil {
+			t.Fatalf("failed to load %s: %v", dir, err)
+		}
+	}
+
+	// sample addresses in the networks of neco
+	ubuntu := netpol.Endpoint{Namespace: "default", Labels: map[string]string{"run": "ubuntu"}, IP: net.ParseIP("10.64.2.1")}
+	testhttpd := netpol.Endpoint{Namespace: "test-netpol", Labels: map[string]string{"run": "testhttpd"}, IP: net.ParseIP("10.64.0.10")}
+	node := netpol.Endpoint{IP: net.ParseIP("10.69.0.4")}
+	bmc := netpol.Endpoint{IP: net.ParseIP("10.72.16.5")}
+	bastion := netpol.Endpoint{IP: net.ParseIP("10.72.48.1")}
+	external := netpol.Endpoint{IP: net.ParseIP("203.0.113.10")}
+
+	testCases := []struct {
+		name     string
+		pkt      netpol.Packet
+		expected bool
+	}{
+		{"internet-egress squid to pod", netpol.Packet{Source: netpolPod("internet-egress", "squid"), Destination: testhttpd, Protocol: "TCP", Port: 80}, false},
+		{"internet-egress unbound to pod", netpol.Packet{Source: netpolPod("internet-egress", "unbound"), Destination: testhttpd, Protocol: "TCP", Port: 80}, false},
+		{"internet-egress squid to node DNS", netpol.Packet{Source: netpolPod("internet-egress", "squid"), Destination: node, Protocol: "TCP", Port: 53}, false},
+		{"internet-egress unbound to node DNS", netpol.Packet{Source: netpolPod("internet-egress", "unbound"), Destination: node, Protocol: "TCP", Port: 53}, false},
+		{"internet-egress squid to internet", netpol.Packet{Source: netpolPod("internet-egress", "squid"), Destination: external, Protocol: "TCP", Port: 443}, true},
+		{"customer-egress squid to pod", netpol.Packet{Source: netpolPod("customer-egress", "squid"), Destination: testhttpd, Protocol: "TCP", Port: 80}, false},
+		{"customer-egress squid to node DNS", netpol.Packet{Source: netpolPod("customer-egress", "squid"), Destination: node, Protocol: "TCP", Port: 53}, false},
+		{"customer-egress squid to internet", netpol.Packet{Source: netpolPod("customer-egress", "squid"), Destination: external, Protocol: "TCP", Port: 443}, true},
+		{"pod to node DNS over TCP", netpol.Packet{Source: ubuntu, Destination: node, Protocol: "TCP", Port: 53}, true},
+		{"pod to node DNS over UDP", netpol.Packet{Source: ubuntu, Destination: node, Protocol: "UDP", Port: 53}, true},
+		{"pod to API server", netpol.Packet{Source: ubuntu, Destination: node, Protocol: "TCP", Port: 6443}, true},
+		{"pod to node SSH", netpol.Packet{Source: ubuntu, Destination: node, Protocol: "TCP", Port: 22}, false},
+		{"pod to pod in another namespace", netpol.Packet{Source: ubuntu, Destination: testhttpd, Protocol: "TCP", Port: 80}, true},
+		{"vmagent to node-exporter", netpol.Packet{Source: netpolPod("monitoring", "vmagent"), Destination: node, Protocol: "TCP", Port: 9100}, true},
+		{"vmagent to etcd metrics", netpol.Packet{Source: netpolPod("monitoring", "vmagent"), Destination: node, Protocol: "TCP", Port: 2381}, true},
+		{"pod to node-exporter", netpol.Packet{Source: ubuntu, Destination: node, Protocol: "TCP", Port: 9100}, false},
+		{"ping to BMC", netpol.Packet{Source: ubuntu, Destination: bmc, Protocol: "ICMP"}, false},
+		{"ping to node", netpol.Packet{Source: ubuntu, Destination: node, Protocol: "ICMP"}, false},
+		{"ping to bastion", netpol.Packet{Source: ubuntu, Destination: bastion, Protocol: "ICMP"}, false},
+		{"bmc-reverse-proxy to BMC", netpol.Packet{Source: netpolPod("bmc-reverse-proxy", "bmc-reverse-proxy"), Destination: bmc, Protocol: "TCP", Port: 443}, true},
+		{"pod to BMC", netpol.Packet{Source: ubuntu, Destination: bmc, Protocol: "TCP", Port: 443}, false},
+		{"internet to pod", netpol.Packet{Source: external, Destination: testhttpd, Protocol: "TCP", Port: 80}, false},
+		{"internet to envoy", netpol.Packet{Source: external, Destination: netpolPod("ingress-global", "envoy"), Protocol: "TCP", Port: 8080}, true},
+		{"internet to envoy with wrong port", netpol.Packet{Source: external, Destination: netpolPod("ingress-global", "envoy"), Protocol: "TCP", Port: 80}, false},
+	}
+
+	for _, tc := range testCases {
+		v := sim.Check(tc.pkt)
+		if v.Allowed != tc.expected {
+			t.Errorf("%s: %s: expected allowed=%v, but %s", tc.name, tc.pkt, tc.expected, v.Reason)
+		}
+	}
+}
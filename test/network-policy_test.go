@@ -18,6 +18,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
+func init() {
+	registerDiagnostics("network-policy", []string{"test-netpol", "internet-egress"})
+}
+
 func prepareNetworkPolicy() {
 	It("should prepare test pods in test-netpol namespace", func() {
 		By("preparing namespace")
@@ -58,7 +62,7 @@ spec:
   selector:
     app.kubernetes.io/name: testhttpd
 `
-		_, stderr, err := ExecAtWithInput(boot0, []byte(deployYAML), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(deployYAML), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 
 		By("creating ubuntu-debug pod")
@@ -76,13 +80,13 @@ spec:
     image: quay.io/cybozu/ubuntu-debug:20.04
     command: ["/usr/local/bin/pause"]
 `
-		_, stderr, err = ExecAtWithInput(boot0, []byte(debugYAML), "kubectl", "apply", "-n", "default", "-f", "-")
+		_, stderr, err = ExecAtWithInput(cfg.Boot0, []byte(debugYAML), "kubectl", "apply", "-n", "default", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 	})
 
 	It("should wait for patched pods to become ready", func() {
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=internet-egress", "get", "deployment/squid", "-o=json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=internet-egress", "get", "deployment/squid", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -104,7 +108,7 @@ spec:
 		}).Should(Succeed())
 
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=customer-egress", "get", "deployment/squid", "-o=json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=customer-egress", "get", "deployment/squid", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -126,7 +130,7 @@ spec:
 		}).Should(Succeed())
 
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=customer-egress", "get", "deployment/squid", "-o=json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=customer-egress", "get", "deployment/squid", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -148,7 +152,7 @@ spec:
 		}).Should(Succeed())
 
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=internet-egress", "get", "deployment/unbound", "-o=json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=internet-egress", "get", "deployment/unbound", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -170,7 +174,7 @@ spec:
 		}).Should(Succeed())
 
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=monitoring", "get", "deployments/vmagent-vmagent-smallset", "-o=json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring", "get", "deployments/vmagent-vmagent-smallset", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -190,7 +194,7 @@ spec:
 
 		const vmagentLargesetCount = 3
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=monitoring", "get", "deployments/vmagent-vmagent-largeset", "-o=json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=monitoring", "get", "deployments/vmagent-vmagent-largeset", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -214,7 +218,7 @@ func testNetworkPolicy() {
 	It("should pass/block packets appropriately", func() {
 		By("waiting for testhttpd pods")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "-n", "test-netpol", "get", "deployments/testhttpd", "-o", "json")
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "-n", "test-netpol", "get", "deployments/testhttpd", "-o", "json")
 			if err != nil {
 				return err
 			}
@@ -233,7 +237,7 @@ func testNetworkPolicy() {
 
 		By("waiting for ubuntu pod")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "default", "exec", "ubuntu", "--", "date")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "default", "exec", "ubuntu", "--", "date")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -246,13 +250,13 @@ func testNetworkPolicy() {
 		var apiServerIP string
 
 		By("getting httpd pod list")
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "pods", "-n", "test-netpol", "-o=json")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "pods", "-n", "test-netpol", "-o=json")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		err = json.Unmarshal(stdout, testhttpdPodList)
 		Expect(err).NotTo(HaveOccurred())
 
 		By("getting all node list")
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "get", "node", "-o=json")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "get", "node", "-o=json")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		err = json.Unmarshal(stdout, nodeList)
 		Expect(err).NotTo(HaveOccurred())
@@ -269,7 +273,7 @@ func testNetworkPolicy() {
 		}
 		Expect(nodeIP).NotTo(BeEmpty())
 
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "config", "view", "--output=jsonpath={.clusters[0].cluster.server}")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "config", "view", "--output=jsonpath={.clusters[0].cluster.server}")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		u, err := url.Parse(string(stdout))
 		Expect(err).NotTo(HaveOccurred(), "server: %s", stdout)
@@ -278,7 +282,7 @@ func testNetworkPolicy() {
 
 		By("resolving hostname inside cluster by cluster-dns")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "ubuntu", "--", "nslookup", "-timeout=10", "testhttpd.test-netpol")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "ubuntu", "--", "nslookup", "-timeout=10", "testhttpd.test-netpol")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -287,7 +291,7 @@ func testNetworkPolicy() {
 
 		By("resolving hostname outside cluster by unbound")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "ubuntu", "--", "nslookup", "-timeout=10", "cybozu.com")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "ubuntu", "--", "nslookup", "-timeout=10", "cybozu.com")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -304,20 +308,20 @@ func testNetworkPolicy() {
 
 		By("checking if it passes packets to node network for system services")
 		By("accessing DNS port of some node")
-		stdout, stderr, err = ExecAtWithInput(boot0, []byte("Xclose"), "kubectl", "exec", "-i", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "53", "-e", "X")
+		stdout, stderr, err = ExecAtWithInput(cfg.Boot0, []byte("Xclose"), "kubectl", "exec", "-i", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "53", "-e", "X")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 
 		By("accessing API server port of control plane node")
-		stdout, stderr, err = ExecAtWithInput(boot0, []byte("Xclose"), "kubectl", "exec", "-i", "ubuntu", "--", "timeout", "3s", "telnet", apiServerIP, "6443", "-e", "X")
+		stdout, stderr, err = ExecAtWithInput(cfg.Boot0, []byte("Xclose"), "kubectl", "exec", "-i", "ubuntu", "--", "timeout", "3s", "telnet", apiServerIP, "6443", "-e", "X")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 
 		By("getting vmagent-smallset pod name")
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "get", "pods", "-n=monitoring", "-l=app.kubernetes.io/name=vmagent,app.kubernetes.io/instance=vmagent-smallset", "-o", "go-template='{{ (index .items 0).metadata.name }}'")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "get", "pods", "-n=monitoring", "-l=app.kubernetes.io/name=vmagent,app.kubernetes.io/instance=vmagent-smallset", "-o", "go-template='{{ (index .items 0).metadata.name }}'")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		podName := string(stdout)
 
 		By("adding an ubuntu-debug container as an ephemeral container to vmagent-smallset")
-		stdout, stderr, err = ExecAt(boot0,
+		stdout, stderr, err = ExecAt(cfg.Boot0,
 			"kubectl", "alpha", "debug", podName,
 			"-n=monitoring",
 			"--container=ubuntu",
@@ -329,7 +333,7 @@ func testNetworkPolicy() {
 
 		By("accessing node-expoter port of some node as vmagent-smallset")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAtWithInput(boot0, []byte("Xclose"), "kubectl", "-n", "monitoring", "exec", "-i", podName, "-c", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "9100", "-e", "X")
+			stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte("Xclose"), "kubectl", "-n", "monitoring", "exec", "-i", podName, "-c", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "9100", "-e", "X")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -337,12 +341,12 @@ func testNetworkPolicy() {
 		}).Should(Succeed())
 
 		By("getting vmagent-largeset pod name")
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "get", "pods", "-n=monitoring", "-l=app.kubernetes.io/name=vmagent,app.kubernetes.io/instance=vmagent-largeset", "-o", "go-template='{{ (index .items 0).metadata.name }}'")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "get", "pods", "-n=monitoring", "-l=app.kubernetes.io/name=vmagent,app.kubernetes.io/instance=vmagent-largeset", "-o", "go-template='{{ (index .items 0).metadata.name }}'")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		podName = string(stdout)
 
 		By("adding an ubuntu-debug container as an ephemeral container to vmagent-largeset")
-		stdout, stderr, err = ExecAt(boot0,
+		stdout, stderr, err = ExecAt(cfg.Boot0,
 			"kubectl", "alpha", "debug", podName,
 			"-n=monitoring",
 			"--container=ubuntu",
@@ -354,7 +358,7 @@ func testNetworkPolicy() {
 
 		By("accessing node-expoter port of some node as vmagent-largeset")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAtWithInput(boot0, []byte("Xclose"), "kubectl", "-n", "monitoring", "exec", "-i", podName, "-c", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "9100", "-e", "X")
+			stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte("Xclose"), "kubectl", "-n", "monitoring", "exec", "-i", podName, "-c", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "9100", "-e", "X")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -362,7 +366,7 @@ func testNetworkPolicy() {
 		}).Should(Succeed())
 
 		By("checking if it filters icmp packets to BMC/Node/Bastion/switch networks")
-		stdout, stderr, err = ExecAt(boot0, "sabactl", "machines", "get")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "sabactl", "machines", "get")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 
 		var machines []sabakan.Machine
@@ -371,7 +375,7 @@ func testNetworkPolicy() {
 
 		eg := errgroup.Group{}
 		ping := func(addr string) error {
-			_, _, err := ExecAt(boot0, "kubectl", "exec", "ubuntu", "--", "ping", "-c", "1", "-W", "3", addr)
+			_, _, err := ExecAt(cfg.Boot0, "kubectl", "exec", "ubuntu", "--", "ping", "-c", "1", "-W", "3", addr)
 			if err != nil {
 				return err
 			}
@@ -392,7 +396,7 @@ func testNetworkPolicy() {
 		}
 		// Bastion
 		eg.Go(func() error {
-			return ping(boot0)
+			return ping(cfg.Boot0)
 		})
 		Expect(eg.Wait()).Should(HaveOccurred())
 		// switch -- not tested for now because address range for switches is 10.0.1.0/24 in placemat env, not 10.72.0.0/20.
@@ -401,7 +405,7 @@ func testNetworkPolicy() {
 
 func testFiltersForInternetEgress(namespace string, localPodIP, nodeIP string, includeUnbound bool) {
 	By("adding an ubuntu-debug container as an ephemeral container to squid")
-	stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "pods", "-n="+namespace, "-l=app.kubernetes.io/name=squid", "-o", "json")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "pods", "-n="+namespace, "-l=app.kubernetes.io/name=squid", "-o", "json")
 	Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 
 	squidPodList := new(corev1.PodList)
@@ -409,7 +413,7 @@ func testFiltersForInternetEgress(namespace string, localPodIP, nodeIP string, i
 	Expect(err).NotTo(HaveOccurred())
 
 	for _, pod := range squidPodList.Items {
-		stdout, stderr, err := ExecAt(boot0,
+		stdout, stderr, err := ExecAt(cfg.Boot0,
 			"kubectl", "alpha", "debug", pod.Name,
 			"-n="+namespace,
 			"--container=ubuntu",
@@ -421,20 +425,20 @@ func testFiltersForInternetEgress(namespace string, localPodIP, nodeIP string, i
 	}
 
 	By("accessing to local IP")
-	stdout, stderr, err = ExecAt(boot0, "kubectl", "-n="+namespace, "get", "pods", "-o=json")
+	stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "-n="+namespace, "get", "pods", "-o=json")
 	Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 	podList := new(corev1.PodList)
 	err = json.Unmarshal(stdout, podList)
 	Expect(err).NotTo(HaveOccurred())
 
 	for _, pod := range podList.Items {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", pod.Namespace, pod.Name, "--", "curl", localPodIP, "-m", "5")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", pod.Namespace, pod.Name, "--", "curl", localPodIP, "-m", "5")
 		Expect(err).To(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 	}
 
 	By("accessing DNS port of some node as squid")
 	Eventually(func() error {
-		stdout, _, err = ExecAt(boot0, "kubectl", "get", "pods", "-n="+namespace, "-l=app.kubernetes.io/name=squid", "-o", "json")
+		stdout, _, err = ExecAt(cfg.Boot0, "kubectl", "get", "pods", "-n="+namespace, "-l=app.kubernetes.io/name=squid", "-o", "json")
 		if err != nil {
 			return err
 		}
@@ -459,7 +463,7 @@ func testFiltersForInternetEgress(namespace string, localPodIP, nodeIP string, i
 			return errors.New("podName should not be blank")
 		}
 
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte("Xclose"), "kubectl", "-n="+namespace, "exec", "-i", podName, "-c", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "53", "-e", "X")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte("Xclose"), "kubectl", "-n="+namespace, "exec", "-i", podName, "-c", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "53", "-e", "X")
 		var sshError *ssh.ExitError
 		var execError *exec.ExitError
 		switch {
@@ -482,7 +486,7 @@ func testFiltersForInternetEgress(namespace string, localPodIP, nodeIP string, i
 	}
 
 	By("adding an ubuntu-debug container as an ephemeral container to unbound")
-	stdout, stderr, err = ExecAt(boot0, "kubectl", "get", "pods", "-n="+namespace, "-l=app.kubernetes.io/name=unbound", "-o", "json")
+	stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "get", "pods", "-n="+namespace, "-l=app.kubernetes.io/name=unbound", "-o", "json")
 	Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 
 	unboundPodList := new(corev1.PodList)
@@ -490,7 +494,7 @@ func testFiltersForInternetEgress(namespace string, localPodIP, nodeIP string, i
 	Expect(err).NotTo(HaveOccurred())
 
 	for _, pod := range unboundPodList.Items {
-		stdout, stderr, err := ExecAt(boot0,
+		stdout, stderr, err := ExecAt(cfg.Boot0,
 			"kubectl", "alpha", "debug", pod.Name,
 			"-n="+namespace,
 			"--container=ubuntu",
@@ -502,13 +506,13 @@ func testFiltersForInternetEgress(namespace string, localPodIP, nodeIP string, i
 	}
 
 	By("getting unbound pod name")
-	stdout, stderr, err = ExecAt(boot0, "kubectl", "get", "pods", "-n="+namespace, "-l=app.kubernetes.io/name=unbound", "-o", "go-template='{{ (index .items 0).metadata.name }}'")
+	stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "get", "pods", "-n="+namespace, "-l=app.kubernetes.io/name=unbound", "-o", "go-template='{{ (index .items 0).metadata.name }}'")
 	Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 	unboundPodName := string(stdout)
 
 	By("accessing DNS port of some node as unbound")
 	Eventually(func() error {
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte("Xclose"), "kubectl", "-n="+namespace, "exec", "-i", unboundPodName, "-c", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "53", "-e", "X")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte("Xclose"), "kubectl", "-n="+namespace, "exec", "-i", unboundPodName, "-c", "ubuntu", "--", "timeout", "3s", "telnet", nodeIP, "53", "-e", "X")
 		var sshError *ssh.ExitError
 		var execError *exec.ExitError
 		switch {
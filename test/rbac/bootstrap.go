@@ -0,0 +1,157 @@
+package rbac
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The verbs and the rules below are taken from the bootstrap policy of Kubernetes 1.19.
+// https://github.com/kubernetes/kubernetes/blob/release-1.19/plugin/pkg/auth/authorizer/rbac/bootstrappolicy/policy.go
+var (
+	readVerbs      = []string{"get", "list", "watch"}
+	writeVerbs     = []string{"create", "delete", "deletecollection", "patch", "update"}
+	readWriteVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}
+)
+
+const (
+	aggregateToAdmin = "rbac.authorization.k8s.io/aggregate-to-admin"
+	aggregateToEdit  = "rbac.authorization.k8s.io/aggregate-to-edit"
+	aggregateToView  = "rbac.authorization.k8s.io/aggregate-to-view"
+)
+
+func newRule(verbs []string, group string, resources ...string) rbacv1.PolicyRule {
+	return rbacv1.PolicyRule{
+		Verbs:     verbs,
+		APIGroups: []string{group},
+		Resources: resources,
+	}
+}
+
+func aggregationRule(label string) *rbacv1.AggregationRule {
+	return &rbacv1.AggregationRule{
+		ClusterRoleSelectors: []metav1.LabelSelector{
+			{MatchLabels: map[string]string{label: "true"}},
+		},
+	}
+}
+
+// BootstrapClusterRoles returns the ClusterRoles that kube-apiserver creates on its startup.
+// Only the roles that can be bound to unprivileged users are included.
+func BootstrapClusterRoles() []rbacv1.ClusterRole {
+	return []rbacv1.ClusterRole{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin"},
+			Rules: []rbacv1.PolicyRule{
+				{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}},
+				{Verbs: []string{"*"}, NonResourceURLs: []string{"*"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "system:discovery"},
+			Rules: []rbacv1.PolicyRule{
+				{Verbs: []string{"get"}, NonResourceURLs: []string{
+					"/api", "/api/*", "/apis", "/apis/*", "/healthz", "/livez",
+					"/openapi", "/openapi/*", "/readyz", "/version", "/version/",
+				}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "system:public-info-viewer"},
+			Rules: []rbacv1.PolicyRule{
+				{Verbs: []string{"get"}, NonResourceURLs: []string{
+					"/healthz", "/livez", "/readyz", "/version", "/version/",
+				}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "system:basic-user"},
+			Rules: []rbacv1.PolicyRule{
+				newRule([]string{"create"}, "authorization.k8s.io", "selfsubjectaccessreviews", "selfsubjectrulesreviews"),
+			},
+		},
+		{
+			ObjectMeta:      metav1.ObjectMeta{Name: "admin"},
+			AggregationRule: aggregationRule(aggregateToAdmin),
+		},
+		{
+			ObjectMeta:      metav1.ObjectMeta{Name: "edit", Labels: map[string]string{aggregateToAdmin: "true"}},
+			AggregationRule: aggregationRule(aggregateToEdit),
+		},
+		{
+			ObjectMeta:      metav1.ObjectMeta{Name: "view", Labels: map[string]string{aggregateToEdit: "true"}},
+			AggregationRule: aggregationRule(aggregateToView),
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "system:aggregate-to-admin", Labels: map[string]string{aggregateToAdmin: "true"}},
+			Rules: []rbacv1.PolicyRule{
+				newRule([]string{"create"}, "authorization.k8s.io", "localsubjectaccessreviews"),
+				newRule(readWriteVerbs, "rbac.authorization.k8s.io", "roles", "rolebindings"),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "system:aggregate-to-edit", Labels: map[string]string{aggregateToEdit: "true"}},
+			Rules: []rbacv1.PolicyRule{
+				newRule([]string{"impersonate"}, "", "serviceaccounts"),
+				newRule(writeVerbs, "", "pods", "pods/attach", "pods/proxy", "pods/exec", "pods/portforward"),
+				newRule(writeVerbs, "", "replicationcontrollers", "replicationcontrollers/scale", "serviceaccounts",
+					"services", "services/proxy", "endpoints", "persistentvolumeclaims", "configmaps", "secrets", "events"),
+				newRule(writeVerbs, "apps", "statefulsets", "statefulsets/scale", "daemonsets", "deployments",
+					"deployments/scale", "deployments/rollback", "replicasets", "replicasets/scale"),
+				newRule(writeVerbs, "autoscaling", "horizontalpodautoscalers"),
+				newRule(writeVerbs, "batch", "jobs", "cronjobs"),
+				newRule(writeVerbs, "extensions", "daemonsets", "deployments", "deployments/scale", "deployments/rollback",
+					"ingresses", "replicasets", "replicasets/scale", "replicationcontrollers/scale", "networkpolicies"),
+				newRule(writeVerbs, "policy", "poddisruptionbudgets"),
+				newRule(writeVerbs, "networking.k8s.io", "networkpolicies", "ingresses"),
+				newRule(readVerbs, "", "pods/attach", "pods/proxy", "pods/exec", "pods/portforward", "secrets", "services/proxy"),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "system:aggregate-to-view", Labels: map[string]string{aggregateToView: "true"}},
+			Rules: []rbacv1.PolicyRule{
+				newRule(readVerbs, "", "pods", "replicationcontrollers", "replicationcontrollers/scale", "serviceaccounts",
+					"services", "services/status", "endpoints", "persistentvolumeclaims", "persistentvolumeclaims/status", "configmaps"),
+				newRule(readVerbs, "", "limitranges", "resourcequotas", "bindings", "events", "pods/status",
+					"resourcequotas/status", "namespaces/status", "replicationcontrollers/status", "pods/log"),
+				newRule(readVerbs, "", "namespaces"),
+				newRule(readVerbs, "discovery.k8s.io", "endpointslices"),
+				newRule(readVerbs, "apps", "controllerrevisions", "statefulsets", "statefulsets/scale", "statefulsets/status",
+					"daemonsets", "daemonsets/status", "deployments", "deployments/scale", "deployments/status",
+					"replicasets", "replicasets/scale", "replicasets/status"),
+				newRule(readVerbs, "autoscaling", "horizontalpodautoscalers", "horizontalpodautoscalers/status"),
+				newRule(readVerbs, "batch", "jobs", "cronjobs", "cronjobs/status", "jobs/status"),
+				newRule(readVerbs, "extensions", "daemonsets", "daemonsets/status", "deployments", "deployments/scale",
+					"deployments/status", "ingresses", "ingresses/status", "replicasets", "replicasets/scale",
+					"replicasets/status", "replicationcontrollers/scale", "networkpolicies"),
+				newRule(readVerbs, "policy", "poddisruptionbudgets", "poddisruptionbudgets/status"),
+				newRule(readVerbs, "networking.k8s.io", "networkpolicies", "ingresses", "ingresses/status"),
+			},
+		},
+	}
+}
+
+func groupSubject(name string) rbacv1.Subject {
+	return rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: name}
+}
+
+// BootstrapClusterRoleBindings returns the ClusterRoleBindings that kube-apiserver creates on its startup.
+// Only the bindings to the roles of BootstrapClusterRoles are included.
+func BootstrapClusterRoleBindings() []rbacv1.ClusterRoleBinding {
+	newBinding := func(role string, groups ...string) rbacv1.ClusterRoleBinding {
+		b := rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: role},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: role},
+		}
+		for _, g := range groups {
+			b.Subjects = append(b.Subjects, groupSubject(g))
+		}
+		return b
+	}
+
+	return []rbacv1.ClusterRoleBinding{
+		newBinding("cluster-admin", "system:masters"),
+		newBinding("system:discovery", "system:authenticated"),
+		newBinding("system:public-info-viewer", "system:authenticated", "system:unauthenticated"),
+		newBinding("system:basic-user", "system:authenticated"),
+	}
+}
@@ -0,0 +1,247 @@
+// Package rbac evaluates Kubernetes RBAC offline.
+//
+// It computes the permissions of a user from Roles, ClusterRoles and their bindings
+// in the same way as the RBAC authorizer of kube-apiserver, including the aggregation
+// of ClusterRoles done by kube-controller-manager.
+package rbac
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// User represents a user authenticated by kube-apiserver.
+type User struct {
+	Name   string
+	Groups []string
+}
+
+// Evaluator evaluates the permissions of users.
+type Evaluator struct {
+	roles               map[string]*rbacv1.Role
+	clusterRoles        map[string]*rbacv1.ClusterRole
+	roleBindings        []rbacv1.RoleBinding
+	clusterRoleBindings []rbacv1.ClusterRoleBinding
+}
+
+// NewEvaluator creates an Evaluator.
+// BootstrapClusterRoles and BootstrapClusterRoleBindings are added unless the given
+// objects have the same names.  Aggregated ClusterRoles are resolved here.
+func NewEvaluator(roles []rbacv1.Role, clusterRoles []rbacv1.ClusterRole,
+	roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding) (*Evaluator, error) {
+
+	e := &Evaluator{
+		roles:        make(map[string]*rbacv1.Role),
+		clusterRoles: make(map[string]*rbacv1.ClusterRole),
+		roleBindings: roleBindings,
+	}
+	for i := range roles {
+		r := roles[i].DeepCopy()
+		e.roles[r.Namespace+"/"+r.Name] = r
+	}
+	for _, cr := range append(BootstrapClusterRoles(), clusterRoles...) {
+		e.clusterRoles[cr.Name] = cr.DeepCopy()
+	}
+
+	names := map[string]bool{}
+	for _, b := range clusterRoleBindings {
+		names[b.Name] = true
+	}
+	for _, b := range BootstrapClusterRoleBindings() {
+		if !names[b.Name] {
+			e.clusterRoleBindings = append(e.clusterRoleBindings, b)
+		}
+	}
+	e.clusterRoleBindings = append(e.clusterRoleBindings, clusterRoleBindings...)
+
+	if err := e.aggregate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// aggregate fills the rules of aggregated ClusterRoles.
+// Aggregated roles may be aggregated again (e.g. view -> edit -> admin),
+// so this repeats until the rules converge.
+func (e *Evaluator) aggregate() error {
+	selectors := map[string][]labels.Selector{}
+	for name, cr := range e.clusterRoles {
+		if cr.AggregationRule == nil {
+			continue
+		}
+		for i := range cr.AggregationRule.ClusterRoleSelectors {
+			sel, err := metav1.LabelSelectorAsSelector(&cr.AggregationRule.ClusterRoleSelectors[i])
+			if err != nil {
+				return fmt.Errorf("invalid aggregation rule of ClusterRole %s: %w", name, err)
+			}
+			selectors[name] = append(selectors[name], sel)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for name, sels := range selectors {
+			target := e.clusterRoles[name]
+			for _, cr := range e.clusterRoles {
+				if cr.Name == name || !matchesAny(sels, cr.Labels) {
+					continue
+				}
+				for _, r := range cr.Rules {
+					if !containsRule(target.Rules, r) {
+						target.Rules = append(target.Rules, r)
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func matchesAny(sels []labels.Selector, l map[string]string) bool {
+	for _, sel := range sels {
+		if sel.Matches(labels.Set(l)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRule(rules []rbacv1.PolicyRule, r rbacv1.PolicyRule) bool {
+	for _, rr := range rules {
+		if reflect.DeepEqual(rr, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterRole returns the ClusterRole named name after aggregation, or nil if not found.
+func (e *Evaluator) ClusterRole(name string) *rbacv1.ClusterRole {
+	return e.clusterRoles[name]
+}
+
+// Rules returns the rules granted to user in namespace.
+// If namespace is empty, only the rules granted by ClusterRoleBindings are returned.
+func (e *Evaluator) Rules(user User, namespace string) []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	for _, b := range e.clusterRoleBindings {
+		if !appliesTo(user, b.Subjects, "") || b.RoleRef.Kind != "ClusterRole" {
+			continue
+		}
+		if cr, ok := e.clusterRoles[b.RoleRef.Name]; ok {
+			rules = append(rules, cr.Rules...)
+		}
+	}
+	if namespace == "" {
+		return rules
+	}
+
+	for _, b := range e.roleBindings {
+		if b.Namespace != namespace || !appliesTo(user, b.Subjects, namespace) {
+			continue
+		}
+		switch b.RoleRef.Kind {
+		case "ClusterRole":
+			if cr, ok := e.clusterRoles[b.RoleRef.Name]; ok {
+				rules = append(rules, cr.Rules...)
+			}
+		case "Role":
+			if r, ok := e.roles[namespace+"/"+b.RoleRef.Name]; ok {
+				rules = append(rules, r.Rules...)
+			}
+		}
+	}
+	return rules
+}
+
+// Verbs returns the sorted verbs that user can do for all objects of resource in namespace.
+// resource is given in the form of `kubectl auth can-i --list`, e.g. "pods", "pods/exec",
+// "deployments.apps" or "deployments.apps/scale".
+// Rules limited by resourceNames are ignored.  "*" is returned as is.
+func (e *Evaluator) Verbs(user User, namespace, resource string) []string {
+	var subresource string
+	if i := strings.Index(resource, "/"); i >= 0 {
+		resource, subresource = resource[:i], resource[i+1:]
+	}
+	var group string
+	if i := strings.Index(resource, "."); i >= 0 {
+		resource, group = resource[:i], resource[i+1:]
+	}
+
+	found := map[string]bool{}
+	for _, r := range e.Rules(user, namespace) {
+		if len(r.ResourceNames) > 0 {
+			continue
+		}
+		if !matchesString(r.APIGroups, group) || !resourceMatches(r.Resources, resource, subresource) {
+			continue
+		}
+		for _, v := range r.Verbs {
+			found[v] = true
+		}
+	}
+
+	verbs := make([]string, 0, len(found))
+	for v := range found {
+		verbs = append(verbs, v)
+	}
+	sort.Strings(verbs)
+	return verbs
+}
+
+func appliesTo(user User, subjects []rbacv1.Subject, namespace string) bool {
+	for _, s := range subjects {
+		switch s.Kind {
+		case rbacv1.UserKind:
+			if s.Name == user.Name {
+				return true
+			}
+		case rbacv1.GroupKind:
+			if matchesString(user.Groups, s.Name) {
+				return true
+			}
+		case rbacv1.ServiceAccountKind:
+			ns := s.Namespace
+			if ns == "" {
+				ns = namespace
+			}
+			if user.Name == "system:serviceaccount:"+ns+":"+s.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesString returns true if list contains s or "*".
+func matchesString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s || v == rbacv1.ResourceAll {
+			return true
+		}
+	}
+	return false
+}
+
+func resourceMatches(ruleResources []string, resource, subresource string) bool {
+	combined := resource
+	if subresource != "" {
+		combined += "/" + subresource
+	}
+	for _, r := range ruleResources {
+		if r == rbacv1.ResourceAll || r == combined {
+			return true
+		}
+		if subresource != "" && r == "*/"+subresource {
+			return true
+		}
+	}
+	return false
+}
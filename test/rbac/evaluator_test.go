@@ -0,0 +1,99 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvaluator(t *testing.T) {
+	clusterRoles := []rbacv1.ClusterRole{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-view", Labels: map[string]string{aggregateToView: "true"}},
+			Rules:      []rbacv1.PolicyRule{newRule(readVerbs, "example.com", "foos")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-admin", Labels: map[string]string{aggregateToAdmin: "true"}},
+			Rules:      []rbacv1.PolicyRule{newRule(writeVerbs, "example.com", "foos")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "psp"},
+			Rules: []rbacv1.PolicyRule{{
+				Verbs: []string{"use"}, APIGroups: []string{"policy"},
+				Resources: []string{"podsecuritypolicies"}, ResourceNames: []string{"restricted"},
+			}},
+		},
+	}
+	roles := []rbacv1.Role{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "team-a"},
+			Rules:      []rbacv1.PolicyRule{newRule([]string{"update"}, "*", "*/scale")},
+		},
+	}
+	roleBindings := []rbacv1.RoleBinding{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin", Namespace: "team-a"},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "admin"},
+			Subjects:   []rbacv1.Subject{groupSubject("a")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "team-a"},
+			RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "scaler"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "default"}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "psp", Namespace: "team-a"},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "psp"},
+			Subjects:   []rbacv1.Subject{groupSubject("a")},
+		},
+	}
+	clusterRoleBindings := []rbacv1.ClusterRoleBinding{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "view"},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "view"},
+			Subjects:   []rbacv1.Subject{groupSubject("system:authenticated")},
+		},
+	}
+
+	e, err := NewEvaluator(roles, clusterRoles, roleBindings, clusterRoleBindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	teamA := User{Name: "alice", Groups: []string{"a", "system:authenticated"}}
+	teamB := User{Name: "bob", Groups: []string{"b", "system:authenticated"}}
+	sa := User{Name: "system:serviceaccount:team-a:default", Groups: []string{"system:serviceaccounts", "system:authenticated"}}
+	all := []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}
+
+	testCases := []struct {
+		name      string
+		user      User
+		namespace string
+		resource  string
+		expected  []string
+	}{
+		{"admin aggregates view and edit", teamA, "team-a", "foos.example.com", all},
+		{"admin can read secrets", teamA, "team-a", "secrets", all},
+		{"admin can manage roles", teamA, "team-a", "roles.rbac.authorization.k8s.io", all},
+		{"view in other namespace", teamA, "team-b", "foos.example.com", []string{"get", "list", "watch"}},
+		{"view cannot read secrets", teamB, "team-a", "secrets", []string{}},
+		{"cluster scope", teamA, "", "foos.example.com", []string{"get", "list", "watch"}},
+		{"basic user", teamB, "", "selfsubjectaccessreviews.authorization.k8s.io", []string{"create"}},
+		{"resourceNames are ignored", teamA, "team-a", "podsecuritypolicies.policy", []string{}},
+		{"service account with wildcard subresource", sa, "team-a", "deployments.apps/scale", []string{"get", "list", "update", "watch"}},
+		{"service account in other namespace", sa, "team-b", "deployments.apps/scale", []string{"get", "list", "watch"}},
+	}
+
+	for _, tc := range testCases {
+		actual := e.Verbs(tc.user, tc.namespace, tc.resource)
+		if !cmp.Equal(actual, tc.expected) {
+			t.Errorf("%s: %s", tc.name, cmp.Diff(tc.expected, actual))
+		}
+	}
+
+	if admin := e.ClusterRole("admin"); !containsRule(admin.Rules, newRule(readVerbs, "", "namespaces")) {
+		t.Error("admin should aggregate view")
+	}
+}
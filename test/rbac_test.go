@@ -0,0 +1,153 @@
+package test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/cybozu-go/neco-apps/test/manifest"
+	"github.com/cybozu-go/neco-apps/test/rbac"
+	"github.com/google/go-cmp/cmp"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// externalRBACResources are the resources whose RBAC is installed by neco, not by neco-apps.
+// They cannot be evaluated offline, so only testTeamManagement checks them.
+var externalRBACResources = map[string]bool{
+	"addressblocks.coil.cybozu.com": true,
+	"addresspools.coil.cybozu.com":  true,
+	"egresses.coil.cybozu.com":      true,
+}
+
+// newRBACEvaluator creates an evaluator of the RBAC objects in idx.
+func newRBACEvaluator(t *testing.T, idx *manifest.Index) *rbac.Evaluator {
+	var roles []rbacv1.Role
+	var clusterRoles []rbacv1.ClusterRole
+	var roleBindings []rbacv1.RoleBinding
+	var clusterRoleBindings []rbacv1.ClusterRoleBinding
+
+	decode := func(obj *manifest.Object, v interface{}) {
+		if err := obj.Decode(v); err != nil {
+			t.Fatalf("failed to decode %s %s/%s: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+	for _, obj := range idx.ByKind("Role") {
+		var r rbacv1.Role
+		decode(obj, &r)
+		roles = append(roles, r)
+	}
+	for _, obj := range idx.ByKind("ClusterRole") {
+		var cr rbacv1.ClusterRole
+		decode(obj, &cr)
+		clusterRoles = append(clusterRoles, cr)
+	}
+	for _, obj := range idx.ByKind("RoleBinding") {
+		var b rbacv1.RoleBinding
+		decode(obj, &b)
+		roleBindings = append(roleBindings, b)
+	}
+	for _, obj := range idx.ByKind("ClusterRoleBinding") {
+		var b rbacv1.ClusterRoleBinding
+		decode(obj, &b)
+		clusterRoleBindings = append(clusterRoleBindings, b)
+	}
+
+	e, err := rbac.NewEvaluator(roles, clusterRoles, roleBindings, clusterRoleBindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// checkTeamClusterRules checks that the rules granted to user in the cluster scope are read-only.
+// This is the offline version of the check of cluster resources in testTeamManagement.
+func checkTeamClusterRules(t *testing.T, team string, rules []rbacv1.PolicyRule) {
+	for _, r := range rules {
+		if len(r.NonResourceURLs) > 0 || len(r.ResourceNames) > 0 {
+			continue
+		}
+		var extra []string
+		for _, v := range normalizeVerbs(r.Verbs) {
+			if !containsString(viewVerbs, v) {
+				extra = append(extra, v)
+			}
+		}
+		if len(extra) == 0 {
+			continue
+		}
+		if cmp.Equal(extra, []string{"create"}) && cmp.Equal(r.APIGroups, []string{"authorization.k8s.io"}) &&
+			cmp.Equal(r.Resources, []string{"selfsubjectaccessreviews", "selfsubjectrulesreviews"}) {
+			continue
+		}
+		t.Errorf("%s can %v %v in groups %v in the cluster scope", team, extra, r.Resources, r.APIGroups)
+	}
+}
+
+// testTeamPermissions evaluates the expectations of testTeamManagement against the RBAC objects
+// deployed to each cluster, without kube-apiserver.
+func testTeamPermissions(t *testing.T) {
+	overlays, err := findOverlays()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Parallel()
+	for _, overlay := range overlays {
+		overlay := overlay
+		t.Run(overlay, func(t *testing.T) {
+			t.Parallel()
+
+			apps, idx := loadOverlay(t, overlay)
+			for _, app := range apps {
+				if app.Dir == "" {
+					continue
+				}
+				if err := idx.Err(app.Dir); err != nil {
+					t.Fatalf("failed to render %s: %v", app.Dir, err)
+				}
+			}
+			e := newRBACEvaluator(t, idx)
+
+			// Same as testTeamManagement, namespaces without a team label are considered as managed by the Neco team.
+			nsOwner := map[string]string{}
+			for ns := range builtinNamespaces {
+				nsOwner[ns] = "neco"
+			}
+			for _, obj := range idx.Namespaces() {
+				nsOwner[obj.GetName()] = "neco"
+				if team := obj.GetLabels()["team"]; team != "" {
+					nsOwner[obj.GetName()] = team
+				}
+			}
+			var namespaceList []string
+			tenantTeamSet := map[string]bool{}
+			for ns, team := range nsOwner {
+				namespaceList = append(namespaceList, ns)
+				if team != "neco" {
+					tenantTeamSet[team] = true
+				}
+			}
+			sort.Strings(namespaceList)
+			var tenantTeamList []string
+			for team := range tenantTeamSet {
+				tenantTeamList = append(tenantTeamList, team)
+			}
+			sort.Strings(tenantTeamList)
+
+			for _, team := range tenantTeamList {
+				user := rbac.User{Name: "test", Groups: []string{team, "system:authenticated"}}
+				for _, ns := range namespaceList {
+					for resource, expected := range expectedTeamVerbs(team, ns, nsOwner) {
+						if externalRBACResources[resource] {
+							continue
+						}
+						actual := normalizeVerbs(e.Verbs(user, ns, resource))
+						if !cmp.Equal(actual, expected) {
+							t.Errorf("%s:%s/%s: expected %v, actual %v", team, ns, resource, expected, actual)
+						}
+					}
+				}
+				checkTeamClusterRules(t, team, e.Rules(user, ""))
+			}
+		})
+	}
+}
@@ -45,7 +45,7 @@ type serfMemberContainer struct {
 }
 
 func fetchClusterNodes() (map[string]bool, error) {
-	stdout, stderr, err := ExecAt(boot0, "ckecli", "cluster", "get")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "ckecli", "cluster", "get")
 	if err != nil {
 		return nil, fmt.Errorf("stdout=%s, stderr=%s err=%v", stdout, stderr, err)
 	}
@@ -64,7 +64,7 @@ func fetchClusterNodes() (map[string]bool, error) {
 }
 
 func getSerfMembers() (*serfMemberContainer, error) {
-	stdout, stderr, err := ExecAt(boot0, "serf", "members", "-format", "json")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "serf", "members", "-format", "json")
 	if err != nil {
 		return nil, fmt.Errorf("stdout=%s, stderr=%s err=%v", stdout, stderr, err)
 	}
@@ -90,28 +90,28 @@ func testRebootAllNodes() {
 	})
 
 	It("stop CKE sabakan integration", func() {
-		ExecSafeAt(boot0, "ckecli", "sabakan", "disable")
+		ExecSafeAt(cfg.Boot0, "ckecli", "sabakan", "disable")
 	})
 
 	It("should stop all CKE service", func() {
-		ExecSafeAt(boot0, "sudo", "systemctl", "stop", "cke.service")
-		ExecSafeAt(boot1, "sudo", "systemctl", "stop", "cke.service")
-		ExecSafeAt(boot2, "sudo", "systemctl", "stop", "cke.service")
+		ExecSafeAt(cfg.Boot0, "sudo", "systemctl", "stop", "cke.service")
+		ExecSafeAt(cfg.Boot1, "sudo", "systemctl", "stop", "cke.service")
+		ExecSafeAt(cfg.Boot2, "sudo", "systemctl", "stop", "cke.service")
 	})
 
 	It("should stop all kube-controller-manager and delete all Pod", func() {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "nodes", "-l", "node-role.kubernetes.io/master=true", "-ojsonpath='{.items..metadata.name}'")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "nodes", "-l", "node-role.kubernetes.io/master=true", "-ojsonpath='{.items..metadata.name}'")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		cpAddrs := strings.Split(string(stdout), " ")
 		for _, a := range cpAddrs {
-			ExecSafeAt(boot0, "ckecli", "ssh", a, "docker", "stop", "kube-controller-manager")
+			ExecSafeAt(cfg.Boot0, "ckecli", "ssh", a, "docker", "stop", "kube-controller-manager")
 		}
-		ExecSafeAt(boot0, "kubectl", "delete", "pod", "-A", "--all", "--force")
+		ExecSafeAt(cfg.Boot0, "kubectl", "delete", "pod", "-A", "--all", "--force")
 	})
 
 	It("reboots all nodes", func() {
 		By("getting machines list")
-		stdout, _, err := ExecAt(boot0, "sabactl", "machines", "get")
+		stdout, _, err := ExecAt(cfg.Boot0, "sabactl", "machines", "get")
 		Expect(err).ShouldNot(HaveOccurred())
 		var machines []sabakan.Machine
 		err = json.Unmarshal(stdout, &machines)
@@ -123,7 +123,7 @@ func testRebootAllNodes() {
 			if m.Spec.Role == "boot" || m.Spec.Rack == 3 {
 				continue
 			}
-			stdout, stderr, err := ExecAt(boot0, "neco", "ipmipower", "stop", m.Spec.IPv4[0])
+			stdout, stderr, err := ExecAt(cfg.Boot0, "neco", "ipmipower", "stop", m.Spec.IPv4[0])
 			Expect(err).ShouldNot(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		}
 
@@ -153,7 +153,7 @@ func testRebootAllNodes() {
 			if len(preReboot) > 0 {
 				fmt.Println("retry to ipmipower-stop", preReboot)
 				for addr := range preReboot {
-					stdout, stderr, err := ExecAt(boot0, "neco", "ipmipower", "stop", addr)
+					stdout, stderr, err := ExecAt(cfg.Boot0, "neco", "ipmipower", "stop", addr)
 					if err != nil {
 						fmt.Println("unable to ipmipower-stop", addr, "stdout:", string(stdout), "stderr:", string(stderr))
 					}
@@ -168,7 +168,7 @@ func testRebootAllNodes() {
 			if m.Spec.Rack == 3 {
 				continue
 			}
-			stdout, stderr, err := ExecAt(boot0, "neco", "ipmipower", "start", m.Spec.IPv4[0])
+			stdout, stderr, err := ExecAt(cfg.Boot0, "neco", "ipmipower", "start", m.Spec.IPv4[0])
 			Expect(err).ShouldNot(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		}
 
@@ -193,7 +193,7 @@ func testRebootAllNodes() {
 					if addr == k {
 						if m.Status != "alive" {
 							fmt.Println("retry to ipmipower-start", addr)
-							stdout, stderr, err := ExecAt(boot0, "neco", "ipmipower", "start", addr)
+							stdout, stderr, err := ExecAt(cfg.Boot0, "neco", "ipmipower", "start", addr)
 							if err != nil {
 								fmt.Println("unable to ipmipower-start", addr, "stdout:", string(stdout), "stderr:", string(stderr))
 							}
@@ -225,7 +225,7 @@ func testRebootAllNodes() {
 
 	It("sets all nodes' machine state to healthy", func() {
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "sabactl", "machines", "get")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "sabactl", "machines", "get")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -240,7 +240,7 @@ func testRebootAllNodes() {
 				if m.Spec.Role == "boot" {
 					continue
 				}
-				stdout := ExecSafeAt(boot0, "sabactl", "machines", "get-state", m.Spec.Serial)
+				stdout := ExecSafeAt(cfg.Boot0, "sabactl", "machines", "get-state", m.Spec.Serial)
 				state := string(bytes.TrimSpace(stdout))
 				if state != "healthy" {
 					return fmt.Errorf("sabakan machine state of %s is not healthy: %s", m.Spec.Serial, state)
@@ -252,19 +252,19 @@ func testRebootAllNodes() {
 	})
 
 	It("should start all CKE service", func() {
-		ExecSafeAt(boot0, "sudo", "systemctl", "start", "cke.service")
-		ExecSafeAt(boot1, "sudo", "systemctl", "start", "cke.service")
-		ExecSafeAt(boot2, "sudo", "systemctl", "start", "cke.service")
+		ExecSafeAt(cfg.Boot0, "sudo", "systemctl", "start", "cke.service")
+		ExecSafeAt(cfg.Boot1, "sudo", "systemctl", "start", "cke.service")
+		ExecSafeAt(cfg.Boot2, "sudo", "systemctl", "start", "cke.service")
 	})
 
 	It("re-enable CKE sabakan integration", func() {
-		ExecSafeAt(boot0, "ckecli", "sabakan", "enable")
+		ExecSafeAt(cfg.Boot0, "ckecli", "sabakan", "enable")
 	})
 
 	It("wait for Kubernetes cluster to become ready", func() {
 		By("waiting nodes")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "nodes", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "nodes", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -307,7 +307,7 @@ spec:
     imagePullPolicy: Always
 `
 		Eventually(func() error {
-			stdout, stderr, err := ExecAtWithInput(boot0, []byte(testhttpdYAML), "kubectl", "apply", "-f", "-")
+			stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(testhttpdYAML), "kubectl", "apply", "-f", "-")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -318,7 +318,7 @@ spec:
 	It("waits for Kubernetes resources to become ready", func() {
 		By("cofirming that deployment is ready")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "deployment", "-A", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "deployment", "-A", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -348,7 +348,7 @@ spec:
 
 		By("cofirming that statefulset is ready")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "statefulset", "-A", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "statefulset", "-A", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -378,7 +378,7 @@ spec:
 
 		By("cofirming that daemonset is ready")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "daemonset", "-A", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "daemonset", "-A", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -4,12 +4,15 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	. "github.com/onsi/gomega"
@@ -22,8 +25,19 @@ const (
 	defaultDialTimeout = 30 * time.Second
 	defaultKeepAlive   = 5 * time.Second
 
-	// DefaultRunTimeout is the timeout value for Agent.Run().
+	// DefaultRunTimeout is the timeout value of commands run by ExecAt and ExecAtWithInput.
 	DefaultRunTimeout = 10 * time.Minute
+
+	// sshKeepAliveInterval is the interval of SSH keepalive requests.
+	// A connection is considered dead if a keepalive request is not replied in sshKeepAliveTimeout.
+	sshKeepAliveInterval = 10 * time.Second
+	sshKeepAliveTimeout  = 30 * time.Second
+
+	// sshMaxSessions limits the number of concurrent sessions per host.
+	// This must be less than MaxSessions of sshd, which defaults to 10.
+	sshMaxSessions = 8
+
+	sshMaxBackoff = 30 * time.Second
 )
 
 var (
@@ -36,33 +50,80 @@ var (
 	}
 )
 
+// sshAgent is an SSH connection to a host.
+// The connection is re-established transparently when it is found dead,
+// either by keepalive requests or by a failure to open a session.
 type sshAgent struct {
-	client *ssh.Client
-	conn   net.Conn
+	address  string
+	userName string
+	signer   ssh.Signer
+	sessions chan struct{}
+
+	mu      sync.Mutex
+	client  *ssh.Client
+	hostKey ssh.PublicKey
+	pinned  bool
 }
 
 func prepare() {
-	err := prepareSSHClients(boot0, boot1, boot2)
+	err := prepareSSHClients(cfg.Boot0, cfg.Boot1, cfg.Boot2)
 	Expect(err).NotTo(HaveOccurred())
 
 	// sync VM root filesystem to store newly generated SSH host keys.
 	for h := range sshClients {
 		ExecSafeAt(h, "sync")
 	}
+
+	if cfg.PinSSHHostKeys {
+		for _, agent := range sshClients {
+			agent.pinHostKey()
+		}
+	}
+}
+
+func newSSHAgent(address string, signer ssh.Signer, userName string) *sshAgent {
+	return &sshAgent{
+		address:  address,
+		userName: userName,
+		signer:   signer,
+		sessions: make(chan struct{}, sshMaxSessions),
+	}
+}
+
+// pinHostKey makes later connections fail unless the host key is the same as the current one.
+func (a *sshAgent) pinHostKey() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pinned = true
+}
+
+func (a *sshAgent) hostKeyCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pinned {
+		if !bytes.Equal(a.hostKey.Marshal(), key.Marshal()) {
+			return fmt.Errorf("host key of %s has been changed: %s", a.address, ssh.FingerprintSHA256(key))
+		}
+		return nil
+	}
+	a.hostKey = key
+	return nil
 }
 
-func sshTo(address string, sshKey ssh.Signer, userName string) (*sshAgent, error) {
-	conn, err := agentDialer.Dial("tcp", address+":22")
+// dial connects to the host.  a.mu must not be held because the host key callback locks it.
+func (a *sshAgent) dial() (*ssh.Client, error) {
+	conn, err := agentDialer.Dial("tcp", a.address+":22")
 	if err != nil {
-		fmt.Printf("failed to dial: %s\n", address)
+		fmt.Printf("failed to dial: %s\n", a.address)
 		return nil, err
 	}
 	config := &ssh.ClientConfig{
-		User: userName,
+		User: a.userName,
 		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(sshKey),
+			ssh.PublicKeys(a.signer),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: a.hostKeyCallback,
 		Timeout:         5 * time.Second,
 	}
 	err = conn.SetDeadline(time.Now().Add(defaultDialTimeout))
@@ -80,11 +141,131 @@ func sshTo(address string, sshKey ssh.Signer, userName string) (*sshAgent, error
 		clientConn.Close()
 		return nil, err
 	}
-	a := sshAgent{
-		client: ssh.NewClient(clientConn, channelCh, reqCh),
-		conn:   conn,
+	return ssh.NewClient(clientConn, channelCh, reqCh), nil
+}
+
+// getClient returns the current connection, reconnecting with exponential backoff if there is none.
+// It gives up when ctx is done.
+func (a *sshAgent) getClient(ctx context.Context) (*ssh.Client, error) {
+	a.mu.Lock()
+	client := a.client
+	a.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	backoff := time.Second
+	timeout := time.After(sshTimeout)
+	for {
+		client, err := a.dial()
+		if err == nil {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if a.client != nil {
+				// another goroutine has reconnected
+				client.Close()
+				return a.client, nil
+			}
+			a.client = client
+			go a.keepAlive(client)
+			return client, nil
+		}
+
+		select {
+		case <-timeout:
+			return nil, fmt.Errorf("failed to connect to %s: %w", a.address, err)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to connect to %s: %v: %w", a.address, err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > sshMaxBackoff {
+			backoff = sshMaxBackoff
+		}
+	}
+}
+
+// invalidate closes client and lets the next getClient reconnect.
+func (a *sshAgent) invalidate(client *ssh.Client) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.client == client {
+		a.client = nil
+	}
+	client.Close()
+}
+
+func (a *sshAgent) keepAlive(client *ssh.Client) {
+	ticker := time.NewTicker(sshKeepAliveInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			errCh <- err
+		}()
+
+		var err error
+		select {
+		case err = <-errCh:
+		case <-time.After(sshKeepAliveTimeout):
+			err = errors.New("keepalive timed out")
+		}
+		if err != nil {
+			fmt.Printf("SSH connection to %s is dead: %v\n", a.address, err)
+			a.invalidate(client)
+			return
+		}
+	}
+}
+
+// newSession opens a session.  The returned function must be called to close the session.
+// If the connection is dead, it reconnects and retries once.
+// It gives up when ctx is done while waiting for a free session or reconnecting.
+func (a *sshAgent) newSession(ctx context.Context) (*ssh.Session, func(), error) {
+	select {
+	case a.sessions <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("waiting for a session to %s: %w", a.address, ctx.Err())
+	}
+	release := func() { <-a.sessions }
+
+	for i := 0; ; i++ {
+		client, err := a.getClient(ctx)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		sess, err := client.NewSession()
+		if err == nil {
+			return sess, func() {
+				sess.Close()
+				release()
+			}, nil
+		}
+		a.invalidate(client)
+		if i > 0 {
+			release()
+			return nil, nil, err
+		}
+	}
+}
+
+// DialContext opens a connection to address from the host.
+// If the connection is dead, it reconnects and retries once.
+func (a *sshAgent) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	for i := 0; ; i++ {
+		client, err := a.getClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := client.Dial(network, address)
+		if err == nil || i > 0 {
+			return conn, err
+		}
+		a.invalidate(client)
 	}
-	return &a, nil
 }
 
 func parsePrivateKey(keyPath string) (ssh.Signer, error) {
@@ -103,23 +284,15 @@ func parsePrivateKey(keyPath string) (ssh.Signer, error) {
 }
 
 func prepareSSHClients(addresses ...string) error {
-	sshKey, err := parsePrivateKey(sshKeyFile)
+	sshKey, err := parsePrivateKey(cfg.SSHPrivKey)
 	if err != nil {
 		return err
 	}
 
-	ch := time.After(sshTimeout)
 	for _, a := range addresses {
-	RETRY:
-		select {
-		case <-ch:
-			return errors.New("timed out")
-		default:
-		}
-		agent, err := sshTo(a, sshKey, "cybozu")
-		if err != nil {
-			time.Sleep(time.Second)
-			goto RETRY
+		agent := newSSHAgent(a, sshKey, "cybozu")
+		if _, err := agent.getClient(context.Background()); err != nil {
+			return err
 		}
 		sshClients[a] = agent
 	}
@@ -127,6 +300,51 @@ func prepareSSHClients(addresses ...string) error {
 	return nil
 }
 
+// ExecResult is the result of a command executed at a host.
+type ExecResult struct {
+	Host   string
+	Args   []string
+	Stdout []byte
+	Stderr []byte
+
+	// ExitStatus is the exit status of the command, or -1 if the command did not exit normally,
+	// e.g. it was killed by a signal or the connection was lost.
+	ExitStatus int
+	Duration   time.Duration
+}
+
+// String returns a summary of r for logs and error messages.
+func (r *ExecResult) String() string {
+	return fmt.Sprintf("[%s] %v: exit status %d in %s, stdout: %s, stderr: %s",
+		r.Host, r.Args, r.ExitStatus, r.Duration.Round(time.Millisecond), r.Stdout, r.Stderr)
+}
+
+// execRequest is the optional parameters of a command.
+type execRequest struct {
+	input  []byte
+	stdout io.Writer
+}
+
+// ExecContext executes command at given host.
+// The command is killed when ctx is done.
+// The returned result is not nil even if err is not nil.
+// If the command exits with non-zero status, err wraps *ssh.ExitError.
+func ExecContext(ctx context.Context, host string, args ...string) (*ExecResult, error) {
+	return execAt(ctx, host, execRequest{}, args...)
+}
+
+// ExecContextWithInput is the same as ExecContext except that input is given to stdin of the command.
+// WARNING: `input` can contain secret data.  Never output `input` to console.
+func ExecContextWithInput(ctx context.Context, host string, input []byte, args ...string) (*ExecResult, error) {
+	return execAt(ctx, host, execRequest{input: input}, args...)
+}
+
+// ExecContextStream is the same as ExecContext except that stdout of the command is also written to w
+// while the command is running.  This is useful to watch the progress of long commands.
+func ExecContextStream(ctx context.Context, host string, w io.Writer, args ...string) (*ExecResult, error) {
+	return execAt(ctx, host, execRequest{stdout: w}, args...)
+}
+
 // ExecAt executes command at given host
 func ExecAt(host string, args ...string) (stdout, stderr []byte, e error) {
 	return ExecAtWithInput(host, nil, args...)
@@ -135,36 +353,80 @@ func ExecAt(host string, args ...string) (stdout, stderr []byte, e error) {
 // ExecAtWithInput executes command at given host with input
 // WARNING: `input` can contain secret data.  Never output `input` to console.
 func ExecAtWithInput(host string, input []byte, args ...string) (stdout, stderr []byte, e error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+
+	res, err := ExecContextWithInput(ctx, host, input, args...)
+	return res.Stdout, res.Stderr, err
+}
+
+func execAt(ctx context.Context, host string, req execRequest, args ...string) (*ExecResult, error) {
+	res := &ExecResult{
+		Host:       host,
+		Args:       args,
+		ExitStatus: -1,
+	}
 	agent := sshClients[host]
-	stdout, stderr, err := doExec(agent, input, args...)
-	if err != nil {
-		e = fmt.Errorf("Exec failed: args: %v, err: %w", args, err)
+	if agent == nil {
+		return res, fmt.Errorf("Exec failed: host: %s, args: %v, err: no SSH connection", host, args)
 	}
-	return
-}
 
-func doExec(agent *sshAgent, input []byte, args ...string) ([]byte, []byte, error) {
-	err := agent.conn.SetDeadline(time.Now().Add(DefaultRunTimeout))
+	start := time.Now()
+	err := doExec(ctx, agent, req, res)
+	res.Duration = time.Since(start)
 	if err != nil {
-		return nil, nil, err
+		return res, fmt.Errorf("Exec failed: host: %s, args: %v, err: %w", host, args, err)
 	}
-	defer agent.conn.SetDeadline(time.Time{})
+	return res, nil
+}
 
-	sess, err := agent.client.NewSession()
+// doExec runs a command in a new session and fills res.
+// Commands are not retried even if the connection is lost while running,
+// because they may not be idempotent.
+func doExec(ctx context.Context, agent *sshAgent, req execRequest, res *ExecResult) error {
+	sess, closeSession, err := agent.newSession(ctx)
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
-	defer sess.Close()
+	defer closeSession()
 
-	if input != nil {
-		sess.Stdin = bytes.NewReader(input)
+	if req.input != nil {
+		sess.Stdin = bytes.NewReader(req.input)
 	}
 	outBuf := new(bytes.Buffer)
 	errBuf := new(bytes.Buffer)
 	sess.Stdout = outBuf
+	if req.stdout != nil {
+		sess.Stdout = io.MultiWriter(outBuf, req.stdout)
+	}
 	sess.Stderr = errBuf
-	err = sess.Run(strings.Join(args, " "))
-	return outBuf.Bytes(), errBuf.Bytes(), err
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- sess.Run(strings.Join(res.Args, " "))
+	}()
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		// Not all sshd support signals, so close the session as well.
+		sess.Signal(ssh.SIGKILL)
+		sess.Close()
+		<-errCh
+		err = ctx.Err()
+	}
+	res.Stdout = outBuf.Bytes()
+	res.Stderr = errBuf.Bytes()
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		res.ExitStatus = 0
+	case errors.As(err, &exitErr):
+		if exitErr.Signal() == "" {
+			res.ExitStatus = exitErr.ExitStatus()
+		}
+	}
+	return err
 }
 
 // ExecSafeAt executes command at given host and returns only stdout
@@ -9,7 +9,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 )
 
-var sandboxGrafanaFQDN = testID + "-sandbox-grafana.gcp0.dev-ne.co"
+var sandboxGrafanaFQDN = cfg.TestID + "-sandbox-grafana.gcp0.dev-ne.co"
 
 func prepareSandboxGrafanaIngress() {
 	It("should create HTTPProxy for Sandbox Grafana", func() {
@@ -38,7 +38,7 @@ spec:
           port: 3000
 `, sandboxGrafanaFQDN)
 
-		_, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 	})
 }
@@ -47,7 +47,7 @@ func testSandboxGrafana() {
 	It("should have data sources and dashboards", func() {
 		By("confirming grafana is deployed successfully")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "--namespace=sandbox",
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=sandbox",
 				"get", "statefulset/grafana", "-o=json")
 			if err != nil {
 				return err
@@ -71,12 +71,11 @@ func testSandboxGrafana() {
 
 		By("getting admin stats from grafana")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "curl", "-kL", "-u", "admin:AUJUl1K2xgeqwMdZ3XlEFc1QhgEQItODMNzJwQme", sandboxGrafanaFQDN+"/api/admin/stats")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "curl", "-kL", "-u", "admin:AUJUl1K2xgeqwMdZ3XlEFc1QhgEQItODMNzJwQme", sandboxGrafanaFQDN+"/api/admin/stats")
 			if err != nil {
 				return fmt.Errorf("unable to get admin stats, stderr: %s, err: %v", stderr, err)
 			}
 			var adminStats struct {
-				Dashboards  int `json:"dashboards"`
 				Datasources int `json:"datasources"`
 			}
 			err = json.Unmarshal(stdout, &adminStats)
@@ -86,10 +85,21 @@ func testSandboxGrafana() {
 			if adminStats.Datasources == 0 {
 				return fmt.Errorf("no data sources")
 			}
-			if adminStats.Dashboards != 0 {
-				return fmt.Errorf("%d dashboards exist", adminStats.Dashboards)
-			}
 			return nil
 		}).Should(Succeed())
+
+		By("confirming no dashboards are loaded")
+		Eventually(func() error {
+			stdout, stderr, err := ExecAt(cfg.Boot0, "curl", "-kL", "-u", "admin:AUJUl1K2xgeqwMdZ3XlEFc1QhgEQItODMNzJwQme", sandboxGrafanaFQDN+"/api/search?type=dash-db")
+			if err != nil {
+				return fmt.Errorf("unable to get dashboards, stderr: %s, err: %v", stderr, err)
+			}
+			titles, err := grafanaDashboardTitles(stdout)
+			if err != nil {
+				return err
+			}
+			// Sandbox Grafana is for tenants, so no dashboards are provided by neco-apps.
+			return checkGrafanaDashboards(nil, titles)
+		}).Should(Succeed())
 	})
 }
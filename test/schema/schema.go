@@ -0,0 +1,203 @@
+// Package schema validates rendered Kubernetes objects offline against
+// the OpenAPI schema of Kubernetes and the openAPIV3Schema of CustomResourceDefinitions.
+//
+// Only the subset of the schema needed to find typos in manifests is implemented:
+// object properties, unknown fields, required fields, basic types and enums.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	refPrefix      = "#/definitions/"
+	objectMetaName = "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+)
+
+// GVK identifies the kind of an object.
+type GVK struct {
+	Group   string
+	Version string
+	Kind    string
+}
+
+func (g GVK) String() string {
+	if g.Group == "" {
+		return g.Version + "/" + g.Kind
+	}
+	return g.Group + "/" + g.Version + "/" + g.Kind
+}
+
+// ParseGVK parses apiVersion and kind of an object.
+func ParseGVK(apiVersion, kind string) GVK {
+	gv := strings.SplitN(apiVersion, "/", 2)
+	if len(gv) == 1 {
+		return GVK{Version: gv[0], Kind: kind}
+	}
+	return GVK{Group: gv[0], Version: gv[1], Kind: kind}
+}
+
+// Schema is a subset of OpenAPI v2 schema and openAPIV3Schema in CustomResourceDefinition.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *SchemaOrBool      `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+
+	PreserveUnknownFields bool `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	IntOrString           bool `json:"x-kubernetes-int-or-string,omitempty"`
+	EmbeddedResource      bool `json:"x-kubernetes-embedded-resource,omitempty"`
+
+	GroupVersionKinds []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind,omitempty"`
+}
+
+// SchemaOrBool represents `additionalProperties` that can be either a schema or a boolean.
+type SchemaOrBool struct {
+	Allows bool
+	Schema *Schema
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *SchemaOrBool) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		s.Allows = b
+		return nil
+	}
+	s.Allows = true
+	s.Schema = new(Schema)
+	return json.Unmarshal(data, s.Schema)
+}
+
+// root is a schema for a kind.
+type root struct {
+	schema *Schema
+
+	// strict is true for schemas of custom resources.
+	// The API server prunes fields of custom resources that are not specified in the schema,
+	// so objects without properties do not accept any fields.
+	strict bool
+}
+
+// Validator validates objects against the registered schemas.
+type Validator struct {
+	definitions map[string]*Schema
+	kinds       map[GVK]*root
+}
+
+// NewValidator creates an empty Validator.
+func NewValidator() *Validator {
+	return &Validator{
+		definitions: make(map[string]*Schema),
+		kinds:       make(map[GVK]*root),
+	}
+}
+
+// LoadSwagger registers the definitions in swagger.json of Kubernetes.
+func (v *Validator) LoadSwagger(data []byte) error {
+	var doc struct {
+		Definitions map[string]*Schema `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse swagger: %w", err)
+	}
+	if len(doc.Definitions) == 0 {
+		return errors.New("no definitions in swagger")
+	}
+
+	for name, def := range doc.Definitions {
+		v.definitions[name] = def
+		for _, gvk := range def.GroupVersionKinds {
+			v.kinds[GVK{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}] = &root{schema: def}
+		}
+	}
+	return nil
+}
+
+// AddCRD registers the schemas of a CustomResourceDefinition.
+// Both apiextensions.k8s.io/v1 and v1beta1 are supported.
+// Versions without openAPIV3Schema are ignored.
+func (v *Validator) AddCRD(obj map[string]interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	type validation struct {
+		OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+	}
+	var crd struct {
+		APIVersion string `json:"apiVersion"`
+		Metadata   struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			Group string `json:"group"`
+			Names struct {
+				Kind string `json:"kind"`
+			} `json:"names"`
+			Version               string      `json:"version"`
+			Validation            *validation `json:"validation"`
+			PreserveUnknownFields *bool       `json:"preserveUnknownFields"`
+			Versions              []struct {
+				Name   string      `json:"name"`
+				Schema *validation `json:"schema"`
+			} `json:"versions"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(data, &crd); err != nil {
+		return fmt.Errorf("failed to parse CustomResourceDefinition: %w", err)
+	}
+	if crd.Spec.Group == "" || crd.Spec.Names.Kind == "" {
+		return fmt.Errorf("invalid CustomResourceDefinition %s", crd.Metadata.Name)
+	}
+
+	// v1beta1 does not prune unknown fields unless spec.preserveUnknownFields is false,
+	// so objects without properties are treated as free-form like Kubernetes schema.
+	preserve := crd.APIVersion == "apiextensions.k8s.io/v1beta1" &&
+		(crd.Spec.PreserveUnknownFields == nil || *crd.Spec.PreserveUnknownFields)
+
+	add := func(version string, s *Schema) {
+		if s == nil {
+			return
+		}
+		v.kinds[GVK{Group: crd.Spec.Group, Version: version, Kind: crd.Spec.Names.Kind}] = &root{schema: s, strict: !preserve}
+	}
+
+	var common *Schema
+	if crd.Spec.Validation != nil {
+		common = crd.Spec.Validation.OpenAPIV3Schema
+	}
+	if len(crd.Spec.Versions) == 0 && crd.Spec.Version != "" {
+		add(crd.Spec.Version, common)
+	}
+	for _, ver := range crd.Spec.Versions {
+		if ver.Schema != nil && ver.Schema.OpenAPIV3Schema != nil {
+			add(ver.Name, ver.Schema.OpenAPIV3Schema)
+			continue
+		}
+		add(ver.Name, common)
+	}
+	return nil
+}
+
+// Has returns true if a schema for gvk is registered.
+func (v *Validator) Has(gvk GVK) bool {
+	_, ok := v.kinds[gvk]
+	return ok
+}
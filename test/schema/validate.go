@@ -0,0 +1,248 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrNoSchema is returned by Validate when no schema is registered for the kind of an object.
+var ErrNoSchema = errors.New("no schema")
+
+// FieldError is a problem found in a field of an object.
+type FieldError struct {
+	// Path is the path to the field such as `spec.template.spec.containers[0].image`.
+	Path   string
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Reason
+}
+
+// Validate validates obj against the schema for its kind.
+// obj must be decoded from JSON or YAML, e.g. the content of unstructured.Unstructured.
+// If no schema is registered for the kind, an error wrapping ErrNoSchema is returned.
+func (v *Validator) Validate(obj map[string]interface{}) ([]FieldError, error) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	gvk := ParseGVK(apiVersion, kind)
+
+	r, ok := v.kinds[gvk]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrNoSchema, gvk)
+	}
+
+	w := &walker{v: v, strict: r.strict}
+	s := w.resolve(r.schema)
+	if s == nil {
+		return nil, fmt.Errorf("%w for %s", ErrNoSchema, gvk)
+	}
+	w.validateObject("", obj, s, true)
+	return w.errs, nil
+}
+
+type walker struct {
+	v      *Validator
+	strict bool
+	errs   []FieldError
+}
+
+func (w *walker) errorf(path, format string, args ...interface{}) {
+	w.errs = append(w.errs, FieldError{Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+func (w *walker) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = w.v.definitions[strings.TrimPrefix(s.Ref, refPrefix)]
+	}
+	return s
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (w *walker) validate(path string, value interface{}, s *Schema) {
+	s = w.resolve(s)
+	if s == nil || value == nil {
+		// Unresolvable references are treated as free-form.
+		// null values are dropped by the API server.
+		return
+	}
+
+	for _, sub := range s.AllOf {
+		w.validate(path, value, sub)
+	}
+
+	if s.IntOrString || s.Format == "int-or-string" {
+		if _, ok := value.(string); ok {
+			return
+		}
+		if isInteger(value) {
+			return
+		}
+		w.errorf(path, "expected int or string, got %s", typeName(value))
+		return
+	}
+
+	if len(s.Enum) > 0 && !containsValue(s.Enum, value) {
+		w.errorf(path, "unsupported value %v", value)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			w.errorf(path, "expected object, got %s", typeName(value))
+			return
+		}
+		w.validateObject(path, obj, s, false)
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			w.errorf(path, "expected array, got %s", typeName(value))
+			return
+		}
+		for i, item := range arr {
+			w.validate(fmt.Sprintf("%s[%d]", path, i), item, s.Items)
+		}
+	case "string":
+		// Like kubectl, any primitive value is accepted as a string.
+		if !isPrimitive(value) {
+			w.errorf(path, "expected string, got %s", typeName(value))
+		}
+	case "integer":
+		if !isInteger(value) {
+			w.errorf(path, "expected integer, got %s", typeName(value))
+		}
+	case "number":
+		if !isInteger(value) && !isFloat(value) {
+			w.errorf(path, "expected number, got %s", typeName(value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			w.errorf(path, "expected boolean, got %s", typeName(value))
+		}
+	case "":
+		if obj, ok := value.(map[string]interface{}); ok && len(s.Properties) > 0 {
+			w.validateObject(path, obj, s, false)
+		}
+	}
+}
+
+func (w *walker) validateObject(path string, obj map[string]interface{}, s *Schema, resourceRoot bool) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			w.errorf(joinPath(path, name), "missing required field")
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	embedded := resourceRoot || s.EmbeddedResource
+	for _, k := range keys {
+		p := joinPath(path, k)
+		val := obj[k]
+
+		if embedded {
+			switch k {
+			case "apiVersion", "kind":
+				continue
+			case "metadata":
+				// openAPIV3Schema of custom resources does not define ObjectMeta.
+				if meta, ok := w.v.definitions[objectMetaName]; ok {
+					w.validate(p, val, meta)
+				}
+				continue
+			}
+		}
+
+		if prop, ok := s.Properties[k]; ok {
+			w.validate(p, val, prop)
+			continue
+		}
+		if ap := s.AdditionalProperties; ap != nil {
+			if ap.Schema != nil {
+				w.validate(p, val, ap.Schema)
+				continue
+			}
+			if ap.Allows {
+				continue
+			}
+		}
+		if s.PreserveUnknownFields {
+			continue
+		}
+		if !w.strict && len(s.Properties) == 0 {
+			// free-form object such as RawExtension
+			continue
+		}
+		w.errorf(p, "unknown field")
+	}
+}
+
+func isPrimitive(v interface{}) bool {
+	switch v.(type) {
+	case string, bool:
+		return true
+	}
+	return isInteger(v) || isFloat(v)
+}
+
+func isInteger(v interface{}) bool {
+	switch n := v.(type) {
+	case int, int32, int64:
+		return true
+	case float64:
+		return n == math.Trunc(n)
+	}
+	return false
+}
+
+func isFloat(v interface{}) bool {
+	switch v.(type) {
+	case float32, float64:
+		return true
+	}
+	return false
+}
+
+func containsValue(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) || fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	if isInteger(v) {
+		return "integer"
+	}
+	if isFloat(v) {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,207 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testSwagger = `{
+  "definitions": {
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "namespace": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    },
+    "io.k8s.api.core.v1.ConfigMap": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "data": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "", "version": "v1", "kind": "ConfigMap"}]
+    },
+    "io.k8s.api.core.v1.ServicePort": {
+      "type": "object",
+      "required": ["port"],
+      "properties": {
+        "port": {"type": "integer"},
+        "targetPort": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.util.intstr.IntOrString"}
+      }
+    },
+    "io.k8s.api.core.v1.Service": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {
+          "type": "object",
+          "properties": {
+            "ports": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.ServicePort"}},
+            "type": {"type": "string"}
+          }
+        }
+      },
+      "x-kubernetes-group-version-kind": [{"group": "", "version": "v1", "kind": "Service"}]
+    },
+    "io.k8s.apimachinery.pkg.util.intstr.IntOrString": {
+      "type": "string",
+      "format": "int-or-string"
+    }
+  }
+}`
+
+const testCRD = `{
+  "apiVersion": "apiextensions.k8s.io/v1",
+  "kind": "CustomResourceDefinition",
+  "metadata": {"name": "foos.example.com"},
+  "spec": {
+    "group": "example.com",
+    "names": {"kind": "Foo"},
+    "versions": [{
+      "name": "v1",
+      "schema": {"openAPIV3Schema": {
+        "type": "object",
+        "properties": {
+          "apiVersion": {"type": "string"},
+          "kind": {"type": "string"},
+          "metadata": {"type": "object"},
+          "spec": {
+            "type": "object",
+            "properties": {
+              "mode": {"type": "string", "enum": ["a", "b"]},
+              "extra": {"type": "object"},
+              "free": {"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+            }
+          }
+        }
+      }}
+    }]
+  }
+}`
+
+func decode(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestValidate(t *testing.T) {
+	v := NewValidator()
+	if err := v.LoadSwagger([]byte(testSwagger)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddCRD(decode(t, testCRD)); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		obj      string
+		expected []FieldError
+	}{
+		{
+			name: "valid ConfigMap",
+			obj:  `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a", "labels": {"x": "y"}}, "data": {"k": "v"}}`,
+		},
+		{
+			name: "unknown field in metadata",
+			obj:  `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a", "label": {"x": "y"}}}`,
+			expected: []FieldError{
+				{Path: "metadata.label", Reason: "unknown field"},
+			},
+		},
+		{
+			name: "Service with int-or-string and missing required field",
+			obj:  `{"apiVersion": "v1", "kind": "Service", "spec": {"ports": [{"port": 80, "targetPort": "http"}, {"targetPort": 8080}, {"port": 1, "targetPort": [1]}]}}`,
+			expected: []FieldError{
+				{Path: "spec.ports[1].port", Reason: "missing required field"},
+				{Path: "spec.ports[2].targetPort", Reason: "expected int or string, got array"},
+			},
+		},
+		{
+			name: "Service with wrong type",
+			obj:  `{"apiVersion": "v1", "kind": "Service", "spec": {"ports": {"port": 80}, "typo": 1}}`,
+			expected: []FieldError{
+				{Path: "spec.ports", Reason: "expected array, got object"},
+				{Path: "spec.typo", Reason: "unknown field"},
+			},
+		},
+		{
+			name: "custom resource",
+			obj:  `{"apiVersion": "example.com/v1", "kind": "Foo", "metadata": {"name": "a", "nmespace": "b"}, "spec": {"mode": "c", "extra": {"a": 1}, "free": {"b": 2}}}`,
+			expected: []FieldError{
+				{Path: "metadata.nmespace", Reason: "unknown field"},
+				{Path: "spec.extra.a", Reason: "unknown field"},
+				{Path: "spec.mode", Reason: "unsupported value c"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			errs, err := v.Validate(decode(t, tc.obj))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(errs, tc.expected) {
+				t.Errorf("unexpected errors: %s", cmp.Diff(tc.expected, errs))
+			}
+		})
+	}
+
+	_, err := v.Validate(decode(t, `{"apiVersion": "example.com/v2", "kind": "Foo"}`))
+	if !errors.Is(err, ErrNoSchema) {
+		t.Errorf("ErrNoSchema should be returned: %v", err)
+	}
+}
+
+func TestAddCRDv1beta1(t *testing.T) {
+	v := NewValidator()
+	crd := `{
+  "apiVersion": "apiextensions.k8s.io/v1beta1",
+  "kind": "CustomResourceDefinition",
+  "metadata": {"name": "bars.example.com"},
+  "spec": {
+    "group": "example.com",
+    "names": {"kind": "Bar"},
+    "version": "v1alpha1",
+    "versions": [{"name": "v1alpha1"}, {"name": "v1beta1"}],
+    "validation": {"openAPIV3Schema": {
+      "type": "object",
+      "properties": {"spec": {"type": "object", "properties": {"size": {"type": "integer"}}, "required": ["size"]}}
+    }}
+  }
+}`
+	if err := v.AddCRD(decode(t, crd)); err != nil {
+		t.Fatal(err)
+	}
+	for _, ver := range []string{"v1alpha1", "v1beta1"} {
+		if !v.Has(GVK{Group: "example.com", Version: ver, Kind: "Bar"}) {
+			t.Errorf("schema for %s is not registered", ver)
+		}
+	}
+
+	errs, err := v.Validate(decode(t, `{"apiVersion": "example.com/v1beta1", "kind": "Bar", "metadata": {"whatever": 1}, "spec": {"size": 1.5, "sise": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FieldError{
+		{Path: "spec.sise", Reason: "unknown field"},
+		{Path: "spec.size", Reason: "expected integer, got number"},
+	}
+	if !cmp.Equal(errs, expected) {
+		t.Errorf("unexpected errors: %s", cmp.Diff(expected, errs))
+	}
+}
@@ -20,7 +20,7 @@ type: Opaque
 data:
   foo: YmFy
 `)
-		stdout, stderr, err := ExecAtWithInput(boot0, secret, "kubeseal | kubectl apply -f -")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, secret, "kubeseal | kubectl apply -f -")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 	})
 }
@@ -28,7 +28,7 @@ data:
 func testSealedSecret() {
 	It("should be working", func() {
 		Eventually(func() error {
-			_, stderr, err := ExecAt(boot0, "kubectl", "get", "secrets", "sealed-secret-test")
+			_, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "secrets", "sealed-secret-test")
 			if err != nil {
 				return fmt.Errorf("failed to get secret: %s: %w", string(stderr), err)
 			}
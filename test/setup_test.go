@@ -3,6 +3,7 @@ package test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,6 +28,9 @@ import (
 const (
 	argoCDPasswordFile = "./argocd-password.txt"
 
+	// argoCDSyncTimeout bounds a synchronous "argocd app sync" so that a stuck sync is retried.
+	argoCDSyncTimeout = 10 * time.Minute
+
 	teleportSecret = `
 apiVersion: v1
 kind: Secret
@@ -90,12 +94,12 @@ var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONSc
 func prepareNodes() {
 	It("should increase worker nodes", func() {
 		Eventually(func() error {
-			_, _, err := ExecAt(boot0, "ckecli", "cluster", "get")
+			_, _, err := ExecAt(cfg.Boot0, "ckecli", "cluster", "get")
 			return err
 		}).Should(Succeed())
-		ExecSafeAt(boot0, "ckecli", "constraints", "set", "minimum-workers", "4")
+		ExecSafeAt(cfg.Boot0, "ckecli", "constraints", "set", "minimum-workers", "4")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "nodes", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "nodes", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -129,14 +133,14 @@ func prepareNodes() {
 }
 
 func createNamespaceIfNotExists(ns string) {
-	_, _, err := ExecAt(boot0, "kubectl", "get", "namespace", ns)
+	_, _, err := ExecAt(cfg.Boot0, "kubectl", "get", "namespace", ns)
 	if err == nil {
 		return
 	}
 
-	ExecSafeAt(boot0, "kubectl", "create", "namespace", ns)
+	ExecSafeAt(cfg.Boot0, "kubectl", "create", "namespace", ns)
 	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "sa", "default", "-n", ns)
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "sa", "default", "-n", ns)
 		if err != nil {
 			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 		}
@@ -146,7 +150,7 @@ func createNamespaceIfNotExists(ns string) {
 
 // testSetup tests setup of Argo CD
 func testSetup() {
-	if !doUpgrade {
+	if !cfg.Upgrade {
 		It("should create secrets of account.json", func() {
 			By("loading account.json")
 			data, err := ioutil.ReadFile("account.json")
@@ -154,18 +158,18 @@ func testSetup() {
 
 			By("creating namespace and secrets for external-dns")
 			createNamespaceIfNotExists("external-dns")
-			_, _, err = ExecAt(boot0, "kubectl", "--namespace=external-dns", "get", "secret", "clouddns")
+			_, _, err = ExecAt(cfg.Boot0, "kubectl", "--namespace=external-dns", "get", "secret", "clouddns")
 			if err != nil {
-				_, stderr, err := ExecAtWithInput(boot0, data, "kubectl", "--namespace=external-dns",
+				_, stderr, err := ExecAtWithInput(cfg.Boot0, data, "kubectl", "--namespace=external-dns",
 					"create", "secret", "generic", "clouddns", "--from-file=account.json=/dev/stdin")
 				Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 			}
 
 			By("creating namespace and secrets for cert-manager")
 			createNamespaceIfNotExists("cert-manager")
-			_, _, err = ExecAt(boot0, "kubectl", "--namespace=cert-manager", "get", "secret", "clouddns")
+			_, _, err = ExecAt(cfg.Boot0, "kubectl", "--namespace=cert-manager", "get", "secret", "clouddns")
 			if err != nil {
-				_, stderr, err := ExecAtWithInput(boot0, data, "kubectl", "--namespace=cert-manager",
+				_, stderr, err := ExecAtWithInput(cfg.Boot0, data, "kubectl", "--namespace=cert-manager",
 					"create", "secret", "generic", "clouddns", "--from-file=account.json=/dev/stdin")
 				Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 			}
@@ -176,7 +180,7 @@ func testSetup() {
 			createNamespaceIfNotExists("sandbox")
 
 			By("creating namespace and secrets for teleport")
-			stdout, stderr, err := ExecAt(boot0, "env", "ETCDCTL_API=3", "etcdctl", "--cert=/etc/etcd/backup.crt", "--key=/etc/etcd/backup.key",
+			stdout, stderr, err := ExecAt(cfg.Boot0, "env", "ETCDCTL_API=3", "etcdctl", "--cert=/etc/etcd/backup.crt", "--key=/etc/etcd/backup.key",
 				"get", "--print-value-only", "/neco/teleport/auth-token")
 			Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 			teleportToken := strings.TrimSpace(string(stdout))
@@ -189,7 +193,7 @@ func testSetup() {
 			})
 			Expect(err).NotTo(HaveOccurred())
 			createNamespaceIfNotExists("teleport")
-			stdout, stderr, err = ExecAtWithInput(boot0, buf.Bytes(), "kubectl", "apply", "-n", "teleport", "-f", "-")
+			stdout, stderr, err = ExecAtWithInput(cfg.Boot0, buf.Bytes(), "kubectl", "apply", "-n", "teleport", "-f", "-")
 			Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
 		})
 	}
@@ -201,36 +205,36 @@ func testSetup() {
 
 		By("creating namespace and secrets for zerossl")
 		createNamespaceIfNotExists("cert-manager")
-		_, stderr, err := ExecAtWithInput(boot0, data, "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, data, "kubectl", "apply", "-f", "-")
 		Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 	})
 
-	It("should checkout neco-apps repository@"+commitID, func() {
-		ExecSafeAt(boot0, "rm", "-rf", "neco-apps")
+	It("should checkout neco-apps repository@"+cfg.CommitID, func() {
+		ExecSafeAt(cfg.Boot0, "rm", "-rf", "neco-apps")
 
-		ExecSafeAt(boot0, "env", "https_proxy=http://10.0.49.3:3128",
+		ExecSafeAt(cfg.Boot0, "env", "https_proxy=http://10.0.49.3:3128",
 			"git", "clone", "https://github.com/cybozu-go/neco-apps")
-		ExecSafeAt(boot0, "cd neco-apps; git checkout "+commitID)
+		ExecSafeAt(cfg.Boot0, "cd neco-apps; git checkout "+cfg.CommitID)
 	})
 
 	It("should setup applications", func() {
-		if !doUpgrade {
+		if !cfg.Upgrade {
 			applyNetworkPolicy()
 			applyCertManager()
 			setupArgoCD()
 			applyMutatingWebhooks()
 		}
 
-		ExecSafeAt(boot0, "sed", "-i", "s/release/"+commitID+"/", "./neco-apps/argocd-config/base/*.yaml")
-		ExecSafeAt(boot0, "sed", "-i", "s/release/"+commitID+"/", "./neco-apps/argocd-config/overlays/"+overlayName+"/*.yaml")
-		applyAndWaitForApplications(commitID)
+		ExecSafeAt(cfg.Boot0, "sed", "-i", "s/release/"+cfg.CommitID+"/", "./neco-apps/argocd-config/base/*.yaml")
+		ExecSafeAt(cfg.Boot0, "sed", "-i", "s/release/"+cfg.CommitID+"/", "./neco-apps/argocd-config/overlays/"+cfg.Overlay+"/*.yaml")
+		applyAndWaitForApplications(cfg.CommitID)
 	})
 
 	It("should set DNS", func() {
 		var ip string
 		By("confirming that unbound is exported")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=internet-egress",
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=internet-egress",
 				"get", "service/unbound-bastion", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -251,7 +255,7 @@ func testSetup() {
 		}).Should(Succeed())
 
 		By("setting dns address to neco config")
-		stdout, stderr, err := ExecAt(boot0, "neco", "config", "set", "dns", ip)
+		stdout, stderr, err := ExecAt(cfg.Boot0, "neco", "config", "set", "dns", ip)
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 	})
 
@@ -259,7 +263,7 @@ func testSetup() {
 		var proxyIP string
 		By("getting proxy address")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "internet-egress", "get", "svc", "squid", "-o", "json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "internet-egress", "get", "svc", "squid", "-o", "json")
 			if err != nil {
 				return fmt.Errorf("stdout: %v, stderr: %v, err: %v", stdout, stderr, err)
 			}
@@ -278,12 +282,12 @@ func testSetup() {
 		}).Should(Succeed())
 
 		proxyURL := fmt.Sprintf("http://%s:3128", proxyIP)
-		ExecSafeAt(boot0, "neco", "config", "set", "node-proxy", proxyURL)
-		ExecSafeAt(boot0, "neco", "config", "set", "proxy", proxyURL)
+		ExecSafeAt(cfg.Boot0, "neco", "config", "set", "node-proxy", proxyURL)
+		ExecSafeAt(cfg.Boot0, "neco", "config", "set", "proxy", proxyURL)
 
 		By("waiting for docker to be restarted")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "docker", "info", "-f", "{{.HTTPProxy}}")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "docker", "info", "-f", "{{.HTTPProxy}}")
 			if err != nil {
 				return fmt.Errorf("docker info failed: %s: %w", stderr, err)
 			}
@@ -301,11 +305,11 @@ func testSetup() {
 				if time.Since(st) > 15*time.Second {
 					return nil
 				}
-				_, _, err := ExecAt(boot0, "sabactl", "ipam", "get")
+				_, _, err := ExecAt(cfg.Boot0, "sabactl", "ipam", "get")
 				if err != nil {
 					return err
 				}
-				_, _, err = ExecAt(boot0, "ckecli", "cluster", "get")
+				_, _, err = ExecAt(cfg.Boot0, "ckecli", "cluster", "get")
 				if err != nil {
 					return err
 				}
@@ -315,14 +319,14 @@ func testSetup() {
 	})
 
 	It("should reconfigure ignitions", func() {
-		necoVersion := string(ExecSafeAt(boot0, "dpkg-query", "-W", "-f", "'${Version}'", "neco"))
-		rolePaths := strings.Fields(string(ExecSafeAt(boot0, "ls", "/usr/share/neco/ignitions/roles/*/site.yml")))
+		necoVersion := string(ExecSafeAt(cfg.Boot0, "dpkg-query", "-W", "-f", "'${Version}'", "neco"))
+		rolePaths := strings.Fields(string(ExecSafeAt(cfg.Boot0, "ls", "/usr/share/neco/ignitions/roles/*/site.yml")))
 		for _, rolePath := range rolePaths {
 			role := strings.Split(rolePath, "/")[6]
-			ExecSafeAt(boot0, "sabactl", "ignitions", "delete", role, necoVersion)
+			ExecSafeAt(cfg.Boot0, "sabactl", "ignitions", "delete", role, necoVersion)
 		}
 		Eventually(func() error {
-			_, stderr, err := ExecAt(boot0, "neco", "init-data", "--ignitions-only")
+			_, stderr, err := ExecAt(cfg.Boot0, "neco", "init-data", "--ignitions-only")
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "neco init-data failed: %s: %v\n", stderr, err)
 				return fmt.Errorf("neco init-data failed: %s: %w", stderr, err)
@@ -333,32 +337,8 @@ func testSetup() {
 }
 
 func applyAndWaitForApplications(commitID string) {
-	By("creating Argo CD app")
-	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "argocd", "app", "create", "argocd-config",
-			"--upsert",
-			"--repo", "https://github.com/cybozu-go/neco-apps.git",
-			"--path", "argocd-config/overlays/"+overlayName,
-			"--dest-namespace", "argocd",
-			"--dest-server", "https://kubernetes.default.svc",
-			"--sync-policy", "none",
-			"--revision", commitID)
-		if err != nil {
-			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
-		}
-		return nil
-	}).Should(Succeed())
-
-	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "cd", "./neco-apps", "&&", "argocd", "app", "sync", "argocd-config", "--local", "argocd-config/overlays/"+overlayName, "--async")
-		if err != nil {
-			return fmt.Errorf("stdout=%s, stderr=%s: %w", string(stdout), string(stderr), err)
-		}
-		return nil
-	}).Should(Succeed())
-
 	By("getting application list")
-	stdout, _, err := kustomizeBuild("../argocd-config/overlays/" + overlayName)
+	stdout, err := kustomizeBuild("../argocd-config/overlays/" + cfg.Overlay)
 	Expect(err).ShouldNot(HaveOccurred())
 
 	var appList []string
@@ -388,70 +368,85 @@ func applyAndWaitForApplications(commitID string) {
 		fmt.Println("  " + app)
 	}
 
-	By("waiting initialization")
-	checkAllAppsSynced := func() error {
-		for _, target := range appList {
-			appStdout, stderr, err := ExecAt(boot0, "argocd", "app", "get", "-o", "json", target)
-			if err != nil {
-				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", appStdout, stderr, err)
-			}
-			var app Application
-			err = json.Unmarshal(appStdout, &app)
-			if err != nil {
-				return fmt.Errorf("stdout: %s, err: %v", appStdout, err)
-			}
-			switch app.Name {
-			case "prometheus-adapter":
-			// These reference upstream Helm chart versions, so no need to check commitID.
-			default:
-				if app.Status.Sync.ComparedTo.Source.TargetRevision != commitID {
-					return errors.New(target + " does not have correct target yet")
-				}
-			}
-			if app.Status.Sync.Status == SyncStatusCodeSynced &&
-				app.Status.Health.Status == HealthStatusHealthy &&
-				app.Operation == nil {
-				continue
+	waitApps := appList
+	var unchanged []string
+	var rollouts map[string]rolloutState
+	if cfg.Upgrade && cfg.BaseBranch != "" {
+		By("finding applications changed from " + cfg.BaseBranch)
+		changed, err := changedApplications(cfg.BaseBranch, cfg.Overlay)
+		Expect(err).ShouldNot(HaveOccurred())
+		waitApps = nil
+		for _, app := range appList {
+			if changed[app] {
+				waitApps = append(waitApps, app)
+			} else {
+				unchanged = append(unchanged, app)
 			}
+		}
+		fmt.Printf("changed applications: %s\n", strings.Join(waitApps, " "))
+		fmt.Printf("unchanged applications: %s\n", strings.Join(unchanged, " "))
 
-			// In upgrade test, syncing network-policy app may cause temporal network disruption.
-			// It leads to ArgoCD's improper behavior. In spite of the network-policy app becomes Synced/Healthy, the operation does not end.
-			// So terminate the unexpected operation manually in upgrade test.
-			// TODO: This is workaround for ArgoCD's improper behavior. When this issue (T.B.D.) is closed, delete this block.
-			if app.Status.Sync.Status == SyncStatusCodeSynced &&
-				app.Status.Health.Status == HealthStatusHealthy &&
-				app.Operation != nil &&
-				app.Status.OperationState.Phase == "Running" {
-				fmt.Printf("%s terminate unexpected operation: app=%s\n", time.Now().Format(time.RFC3339), target)
-				stdout, stderr, err := ExecAt(boot0, "argocd", "app", "terminate-op", target)
-				if err != nil {
-					return fmt.Errorf("failed to terminate operation. app: %s, stdout: %s, stderr: %s, err: %v", target, stdout, stderr, err)
-				}
-				stdout, stderr, err = ExecAt(boot0, "argocd", "app", "sync", target)
-				if err != nil {
-					return fmt.Errorf("failed to sync application. app: %s, stdout: %s, stderr: %s, err: %v", target, stdout, stderr, err)
-				}
-			}
+		rollouts, err = snapshotRollouts(context.Background(), unchanged)
+		Expect(err).ShouldNot(HaveOccurred())
+	}
 
-			return fmt.Errorf("%s is not initialized. argocd app get %s -o json: %s", target, target, appStdout)
+	By("creating Argo CD app")
+	Eventually(func() error {
+		stdout, stderr, err := ExecAt(cfg.Boot0, "argocd", "app", "create", "argocd-config",
+			"--upsert",
+			"--repo", "https://github.com/cybozu-go/neco-apps.git",
+			"--path", "argocd-config/overlays/"+cfg.Overlay,
+			"--dest-namespace", "argocd",
+			"--dest-server", "https://kubernetes.default.svc",
+			"--sync-policy", "none",
+			"--revision", commitID)
+		if err != nil {
+			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 		}
 		return nil
-	}
+	}).Should(Succeed())
 
-	// want to do "Eventually( Consistently(checkAllAppsSynced, 15sec, 1sec) )"
 	Eventually(func() error {
-		st := time.Now()
-		for {
-			if time.Since(st) > 15*time.Second {
-				return nil
-			}
-			err := checkAllAppsSynced()
-			if err != nil {
-				return err
-			}
-			time.Sleep(1 * time.Second)
+		stdout, stderr, err := ExecAt(cfg.Boot0, "cd", "./neco-apps", "&&", "argocd", "app", "sync", "argocd-config", "--local", "argocd-config/overlays/"+cfg.Overlay, "--async")
+		if err != nil {
+			return fmt.Errorf("stdout=%s, stderr=%s: %w", string(stdout), string(stderr), err)
 		}
-	}, 60*time.Minute).Should(Succeed())
+		return nil
+	}).Should(Succeed())
+
+	By("waiting initialization")
+	waiter := &appWaiter{
+		Apps:     waitApps,
+		Revision: commitID,
+		// These reference upstream Helm chart versions, so no need to check commitID.
+		SkipRevision: map[string]bool{"prometheus-adapter": true},
+		StableFor:    15 * time.Second,
+		Recovery: appRecoveryPolicy{
+			TerminateStuckOperations: true,
+			StuckAfter:               time.Minute,
+			MaxAttempts:              5,
+		},
+		Out: GinkgoWriter,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
+	defer cancel()
+	Expect(waiter.Wait(ctx)).To(Succeed())
+
+	if len(unchanged) == 0 {
+		return
+	}
+	By("confirming that unchanged applications are not rolled out")
+	waiter = &appWaiter{
+		Apps:         unchanged,
+		Revision:     commitID,
+		SkipRevision: waiter.SkipRevision,
+		StableFor:    15 * time.Second,
+		Out:          GinkgoWriter,
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	Expect(waiter.Wait(ctx)).To(Succeed())
+	Expect(checkNoRollouts(ctx, unchanged, rollouts)).To(Succeed())
 }
 
 // Sometimes synchronization fails when argocd applies network policies.
@@ -459,18 +454,18 @@ func applyAndWaitForApplications(commitID string) {
 // TODO: This is a workaround. When this issue is solved, delete this func.
 func applyNetworkPolicy() {
 	By("apply namespaces")
-	namespaceManifest, stderr, err := kustomizeBuild("../namespaces/base/")
-	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build: stderr=%s", stderr)
+	namespaceManifest, err := kustomizeBuild("../namespaces/base/")
+	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build")
 
-	stdout, stderr, err := ExecAtWithInput(boot0, namespaceManifest, "kubectl", "apply", "-f", "-")
+	stdout, stderr, err := ExecAtWithInput(cfg.Boot0, namespaceManifest, "kubectl", "apply", "-f", "-")
 	Expect(err).ShouldNot(HaveOccurred(), "failed to apply namespaces: stdout=%s, stderr=%s", stdout, stderr)
 
-	stdout, stderr, err = ExecAt(boot0, "kubectl", "apply", "-f", "./neco-apps/customer-egress/base/namespace.yaml")
+	stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "apply", "-f", "./neco-apps/customer-egress/base/namespace.yaml")
 	Expect(err).ShouldNot(HaveOccurred(), "failed to apply customer-egress namespace: stdout=%s, stderr=%s", stdout, stderr)
 
 	By("apply network-policies")
-	netpolManifest, stderr, err := kustomizeBuild("../network-policy/base/")
-	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build: stderr=%s", stderr)
+	netpolManifest, err := kustomizeBuild("../network-policy/base/")
+	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build")
 
 	var nonCRDResources []*unstructured.Unstructured
 	y := k8sYaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(netpolManifest)))
@@ -491,7 +486,7 @@ func applyNetworkPolicy() {
 			continue
 		}
 
-		stdout, stderr, err = ExecAtWithInput(boot0, data, "kubectl", "apply", "-f", "-")
+		stdout, stderr, err = ExecAtWithInput(cfg.Boot0, data, "kubectl", "apply", "-f", "-")
 		Expect(err).ShouldNot(HaveOccurred(), "failed to apply crd: stdout=%s, stderr=%s", stdout, stderr)
 	}
 
@@ -505,12 +500,12 @@ func applyNetworkPolicy() {
 		r.SetLabels(labels)
 		data, err := r.MarshalJSON()
 		Expect(err).ShouldNot(HaveOccurred(), "failed to marshal json. err=%s", err)
-		stdout, stderr, err = ExecAtWithInput(boot0, data, "kubectl", "apply", "-f", "-")
+		stdout, stderr, err = ExecAtWithInput(cfg.Boot0, data, "kubectl", "apply", "-f", "-")
 		Expect(err).ShouldNot(HaveOccurred(), "failed to apply non-crd resource: stdout=%s, stderr=%s", stdout, stderr)
 	}
 
 	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=kube-system", "get", "deployment/calico-typha", "-o=json")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=kube-system", "get", "deployment/calico-typha", "-o=json")
 		if err != nil {
 			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 		}
@@ -526,7 +521,7 @@ func applyNetworkPolicy() {
 	}, 3*time.Minute).Should(Succeed())
 
 	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace=kube-system", "get", "daemonset/calico-node", "-o=json")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace=kube-system", "get", "daemonset/calico-node", "-o=json")
 		if err != nil {
 			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 		}
@@ -546,11 +541,11 @@ func applyNetworkPolicy() {
 func applyCertManager() {
 	// Egress in internet-egress is a dependency of cert-manager
 	By("apply coil")
-	ExecSafeAt(boot0, "kustomize build neco-apps/coil/base | kubectl apply -f -")
+	ExecSafeAt(cfg.Boot0, "kustomize build neco-apps/coil/base | kubectl apply -f -")
 
 	By("apply cert-manager")
-	manifest, stderr, err := kustomizeBuild("../cert-manager/overlays/" + overlayName)
-	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build: stderr=%s", stderr)
+	manifest, err := kustomizeBuild("../cert-manager/overlays/" + cfg.Overlay)
+	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build")
 
 	var nonCRDResources []*unstructured.Unstructured
 	y := k8sYaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(manifest)))
@@ -574,7 +569,7 @@ func applyCertManager() {
 			continue
 		}
 
-		stdout, stderr, err := ExecAtWithInput(boot0, data, "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, data, "kubectl", "apply", "-f", "-")
 		Expect(err).ShouldNot(HaveOccurred(), "failed to apply crd: stdout=%s, stderr=%s", stdout, stderr)
 	}
 
@@ -588,13 +583,13 @@ func applyCertManager() {
 		r.SetLabels(labels)
 		data, err := r.MarshalJSON()
 		Expect(err).ShouldNot(HaveOccurred(), "failed to marshal json. err=%s", err)
-		stdout, stderr, err := ExecAtWithInput(boot0, data, "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, data, "kubectl", "apply", "-f", "-")
 		Expect(err).ShouldNot(HaveOccurred(), "failed to apply non-crd resource: stdout=%s, stderr=%s", stdout, stderr)
 	}
 
 	Eventually(func() error {
 		for _, name := range []string{"cert-manager", "cert-manager-cainjector", "cert-manager-webhook"} {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "cert-manager", "get", "deployments", name, "-o=json")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "cert-manager", "get", "deployments", name, "-o=json")
 			if err != nil {
 				return fmt.Errorf("%s, err: %w", stderr, err)
 			}
@@ -634,7 +629,7 @@ func applyWebhooksFrom(manifests []byte) {
 		data, err := r.MarshalJSON()
 		ExpectWithOffset(1, err).ShouldNot(HaveOccurred())
 
-		stdout, stderr, err := ExecAtWithInput(boot0, data, "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, data, "kubectl", "apply", "-f", "-")
 		ExpectWithOffset(1, err).ShouldNot(HaveOccurred(), "failed to apply webhook %s: stdout=%s, stderr=%s", r.GetName(), stdout, stderr)
 	}
 }
@@ -644,13 +639,13 @@ func applyWebhooksFrom(manifests []byte) {
 // To workaround this bootstrap problem, we need to apply webhooks manually first.
 func applyMutatingWebhooks() {
 	By("applying neco-admission webhooks")
-	manifests, stderr, err := kustomizeBuild("../neco-admission/base/")
-	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build: stderr=%s", stderr)
+	manifests, err := kustomizeBuild("../neco-admission/base/")
+	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build")
 	applyWebhooksFrom(manifests)
 
 	By("applying TopoLVM webhooks")
-	manifests, stderr, err = kustomizeBuild("../topolvm/base/")
-	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build: stderr=%s", stderr)
+	manifests, err = kustomizeBuild("../topolvm/base/")
+	Expect(err).ShouldNot(HaveOccurred(), "failed to kustomize build")
 	applyWebhooksFrom(manifests)
 }
 
@@ -659,14 +654,14 @@ func setupArgoCD() {
 	createNamespaceIfNotExists("argocd")
 	data, err := ioutil.ReadFile("install.yaml")
 	Expect(err).ShouldNot(HaveOccurred())
-	_, stderr, err := ExecAtWithInput(boot0, data, "kubectl", "apply", "-n", "argocd", "-f", "-")
+	_, stderr, err := ExecAtWithInput(cfg.Boot0, data, "kubectl", "apply", "-n", "argocd", "-f", "-")
 	Expect(err).ShouldNot(HaveOccurred(), "faied to apply install.yaml. stderr=%s", stderr)
 
 	By("waiting Argo CD comes up")
 	// admin password is same as pod name
 	var podList corev1.PodList
 	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "pods", "-n", "argocd",
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "pods", "-n", "argocd",
 			"-l", "app.kubernetes.io/name=argocd-server", "-o", "json")
 		if err != nil {
 			return fmt.Errorf("unable to get argocd-server pods. stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -688,7 +683,7 @@ func setupArgoCD() {
 
 	By("getting node address")
 	var nodeList corev1.NodeList
-	data = ExecSafeAt(boot0, "kubectl", "get", "nodes", "-o", "json")
+	data = ExecSafeAt(cfg.Boot0, "kubectl", "get", "nodes", "-o", "json")
 	err = json.Unmarshal(data, &nodeList)
 	Expect(err).ShouldNot(HaveOccurred(), "data=%s", string(data))
 	Expect(nodeList.Items).ShouldNot(BeEmpty())
@@ -705,7 +700,7 @@ func setupArgoCD() {
 
 	By("getting node port")
 	var svc corev1.Service
-	data = ExecSafeAt(boot0, "kubectl", "get", "svc/argocd-server", "-n", "argocd", "-o", "json")
+	data = ExecSafeAt(cfg.Boot0, "kubectl", "get", "svc/argocd-server", "-n", "argocd", "-o", "json")
 	err = json.Unmarshal(data, &svc)
 	Expect(err).ShouldNot(HaveOccurred(), "data=%s", string(data))
 	Expect(svc.Spec.Ports).ShouldNot(BeEmpty())
@@ -721,7 +716,7 @@ func setupArgoCD() {
 
 	By("logging in to Argo CD")
 	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "argocd", "login", nodeAddress+":"+nodePort,
+		stdout, stderr, err := ExecAt(cfg.Boot0, "argocd", "login", nodeAddress+":"+nodePort,
 			"--insecure", "--username", "admin", "--password", loadArgoCDPassword())
 		if err != nil {
 			return fmt.Errorf("failed to login to argocd. stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -15,6 +15,15 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
+func init() {
+	for _, ns := range []string{"ceph-hdd", "ceph-ssd"} {
+		registerDiagnostics("rook-ceph", []string{ns},
+			diagnosticsCommand{ns + "-ceph-status", []string{"kubectl", "exec", "-n", ns, "deploy/rook-ceph-tools", "--", "ceph", "status"}},
+			diagnosticsCommand{ns + "-ceph-health", []string{"kubectl", "exec", "-n", ns, "deploy/rook-ceph-tools", "--", "ceph", "health", "detail"}},
+		)
+	}
+}
+
 func prepareLoadPods() {
 	It("should deploy pods", func() {
 		yamlSS := `
@@ -61,11 +70,11 @@ spec:
         operator: Equal
         value: storage
 `
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(yamlSS), "kubectl", "apply", "-f", "-")
+		stdout, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(yamlSS), "kubectl", "apply", "-f", "-")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl",
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl",
 				"get", "deployment", "addload-for-ss", "-o=json")
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -118,7 +127,7 @@ spec:
         name: pod-ob
 `
 
-		_, stderr, err := ExecAtWithInput(boot0, []byte(podPvcYaml), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(podPvcYaml), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 	})
 
@@ -156,7 +165,7 @@ spec:
     persistentVolumeClaim:
       claimName: %s-pvc-rbd`, storageClassName, storageClassName, storageClassName, storageClassName)
 
-			_, stderr, err := ExecAtWithInput(boot0, []byte(podPvcYaml), "kubectl", "apply", "-f", "-")
+			_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(podPvcYaml), "kubectl", "apply", "-f", "-")
 			Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 		}
 	})
@@ -167,7 +176,7 @@ func testRookOperator() {
 	for _, ns := range nss {
 		By("checking rook-ceph-operator Deployment for "+ns, func() {
 			Eventually(func() error {
-				stdout, _, err := ExecAt(boot0, "kubectl", "--namespace="+ns,
+				stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 					"get", "deployment/rook-ceph-operator", "-o=json")
 				if err != nil {
 					return err
@@ -188,7 +197,7 @@ func testRookOperator() {
 
 		By("checking ceph-tools Deployment for "+ns, func() {
 			Eventually(func() error {
-				stdout, _, err := ExecAt(boot0, "kubectl", "--namespace="+ns,
+				stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 					"get", "deployment/rook-ceph-tools", "-o=json")
 				if err != nil {
 					return err
@@ -204,7 +213,7 @@ func testRookOperator() {
 					return fmt.Errorf("rook ceph tools deployment's AvailableReplicas is not 1: %d", int(deploy.Status.AvailableReplicas))
 				}
 
-				stdout, _, err = ExecAt(boot0, "kubectl", "get", "pod", "--namespace="+ns, "-l", "app=rook-ceph-tools", "-o=json")
+				stdout, _, err = ExecAt(cfg.Boot0, "kubectl", "get", "pod", "--namespace="+ns, "-l", "app=rook-ceph-tools", "-o=json")
 				if err != nil {
 					return err
 				}
@@ -216,7 +225,7 @@ func testRookOperator() {
 				}
 
 				podName := pods.Items[0].Name
-				_, _, err = ExecAt(boot0, "kubectl", "exec", "--namespace="+ns, podName, "--", "ceph", "status")
+				_, _, err = ExecAt(cfg.Boot0, "kubectl", "exec", "--namespace="+ns, podName, "--", "ceph", "status")
 				if err != nil {
 					return err
 				}
@@ -230,7 +239,7 @@ func testClusterStable() {
 	nss := []string{"ceph-hdd", "ceph-ssd"}
 	for _, ns := range nss {
 		By("checking stability of rook/ceph cluster "+ns, func() {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace="+ns,
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 				"get", "deployment/rook-ceph-operator", "-o=json")
 			Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
@@ -243,13 +252,13 @@ func testClusterStable() {
 			group := re.FindSubmatch([]byte(imageString))
 			expectRookVersion := "v" + string(group[1])
 
-			stdout, stderr, err = ExecAt(boot0, "kubectl", "--namespace="+ns,
+			stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 				"get", "cephcluster", ns, "-o", "jsonpath='{.spec.mon.count}'")
 			Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 			num_mon_expected, err := strconv.Atoi(strings.TrimSpace(string(stdout)))
 			Expect(err).ShouldNot(HaveOccurred(), "stdout=%s", stdout)
 
-			stdout, stderr, err = ExecAt(boot0, "kubectl", "--namespace="+ns,
+			stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 				"get", "cephcluster", ns, "-o", "jsonpath='{.spec.storage.storageClassDeviceSets[0].count}'")
 			Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 			num_osd_expected, err := strconv.Atoi(strings.TrimSpace(string(stdout)))
@@ -257,7 +266,7 @@ func testClusterStable() {
 
 			num_rgw_expected := 0
 			if ns == "ceph-hdd" {
-				stdout, stderr, err := ExecAt(boot0, "kubectl", "--namespace="+ns,
+				stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 					"get", "cephobjectstore", ns+"-object-store", "-o", "jsonpath='{.spec.gateway.instances}'")
 				Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 				n, err := strconv.Atoi(strings.TrimSpace(string(stdout)))
@@ -268,7 +277,7 @@ func testClusterStable() {
 			By("checking deployments versions are equal to the requiring")
 			Eventually(func() error {
 				// Confirm deployment version and pod available counts.
-				stdout, _, err = ExecAt(boot0, "kubectl", "--namespace="+ns,
+				stdout, _, err = ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 					"get", "deployment", "-o=json")
 				if err != nil {
 					return err
@@ -326,7 +335,7 @@ func testClusterStable() {
 			By("checking pods statuses are equal to running or job statuses are equal to succeeded")
 			Eventually(func() error {
 				// Show pod status.
-				stdout, _, err := ExecAt(boot0, "kubectl", "--namespace="+ns,
+				stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "--namespace="+ns,
 					"get", "pod", "-o=json")
 				if err != nil {
 					return err
@@ -357,14 +366,14 @@ func testMONPodsSpreadAll() {
 
 func testMONPodsSpread(cephClusterName, cephClusterNamespace string) {
 	By("checking MON Pods for "+cephClusterName+" are spread", func() {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "node", "-l", "node-role.kubernetes.io/cs=true", "-o=json")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "node", "-l", "node-role.kubernetes.io/cs=true", "-o=json")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
 		nodes := new(corev1.NodeList)
 		err = json.Unmarshal(stdout, nodes)
 		Expect(err).ShouldNot(HaveOccurred())
 
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "--namespace="+cephClusterNamespace,
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "--namespace="+cephClusterNamespace,
 			"get", "pod", "-l", "app=rook-ceph-mon", "-o=json")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
@@ -398,7 +407,7 @@ func testOSDPodsSpread() {
 	nodeRole := "ss"
 
 	By("checking OSD Pods for "+cephClusterName+" are spread on "+nodeRole+" nodes", func() {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "node", "-l", "node-role.kubernetes.io/"+nodeRole+"=true", "-o=json")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "node", "-l", "node-role.kubernetes.io/"+nodeRole+"=true", "-o=json")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
 		nodes := new(corev1.NodeList)
@@ -410,7 +419,7 @@ func testOSDPodsSpread() {
 			nodeCounts[node.Name] = 0
 		}
 
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "--namespace="+cephClusterNamespace,
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "--namespace="+cephClusterNamespace,
 			"get", "pod", "-l", "app=rook-ceph-osd", "-o=json")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
@@ -458,20 +467,20 @@ func testRookRGW() {
 		ns := "sandbox"
 		waitRGW(ns, "pod-ob")
 
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c", `"echo 'putting getting data' > /tmp/put_get"`)
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c", `"echo 'putting getting data' > /tmp/put_get"`)
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c",
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c",
 			`"s3cmd put /tmp/put_get --no-ssl --host=\${BUCKET_HOST} --host-bucket= s3://\${BUCKET_NAME}"`)
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 
-		stdout, _, _ = ExecAt(boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c",
+		stdout, _, _ = ExecAt(cfg.Boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c",
 			`"s3cmd ls s3://\${BUCKET_NAME} --no-ssl --host=\${BUCKET_HOST} --host-bucket= s3://\${BUCKET_NAME}"`)
 		Expect(stdout).Should(ContainSubstring("put_get"))
 
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c",
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c",
 			`"s3cmd get s3://\${BUCKET_NAME}/put_get /tmp/put_get_download --no-ssl --host=\${BUCKET_HOST} --host-bucket="`)
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "cat", "/tmp/put_get_download")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "cat", "/tmp/put_get_download")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 		Expect(stdout).To(Equal([]byte("putting getting data\n")))
 	})
@@ -486,7 +495,7 @@ func testRookRBD(storageClassName string) {
 	pod := storageClassName + "-pod-rbd"
 	By("mounting RBD of "+storageClassName, func() {
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", "sandbox", pod, "--", "mountpoint", "-d", "/test1")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", pod, "--", "mountpoint", "-d", "/test1")
 			if err != nil {
 				return fmt.Errorf("failed to check mount point. stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
@@ -494,11 +503,11 @@ func testRookRBD(storageClassName string) {
 		}).Should(Succeed())
 
 		writePath := "/test1/test.txt"
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", "sandbox", pod, "--", "cp", "/etc/passwd", writePath)
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", pod, "--", "cp", "/etc/passwd", writePath)
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "exec", "-n", "sandbox", pod, "--", "sync")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", pod, "--", "sync")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "exec", "-n", "sandbox", pod, "--", "cat", writePath)
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", pod, "--", "cat", writePath)
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 	})
 }
@@ -509,9 +518,9 @@ func prepareRebootRookCeph() {
 	It("should store data via RGW before reboot", func() {
 		ns := "sandbox"
 		waitRGW(ns, "pod-ob")
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c", `"echo 'reboot data' > /tmp/reboot"`)
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c", `"echo 'reboot data' > /tmp/reboot"`)
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c",
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "exec", "-n", ns, "pod-ob", "--", "sh", "-c",
 			`"s3cmd put /tmp/reboot --no-ssl --host=\${BUCKET_HOST} --host-bucket= s3://\${BUCKET_NAME}/reboot"`)
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 	})
@@ -540,14 +549,14 @@ spec:
     - secretRef:
         name: pod-ob
 `
-		_, stderr, err := ExecAtWithInput(boot0, []byte(podPvcYaml), "kubectl", "apply", "-f", "-")
+		_, stderr, err := ExecAtWithInput(cfg.Boot0, []byte(podPvcYaml), "kubectl", "apply", "-f", "-")
 		Expect(err).NotTo(HaveOccurred(), "stderr: %s", stderr)
 
 		waitRGW("sandbox", "pod-ob")
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", "sandbox", "pod-ob", "--", "sh", "-c",
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", "pod-ob", "--", "sh", "-c",
 			`"s3cmd get s3://\${BUCKET_NAME}/reboot /tmp/reboot_download --no-ssl --host=\${BUCKET_HOST} --host-bucket="`)
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "exec", "-n", "sandbox", "pod-ob", "--", "cat", "/tmp/reboot_download")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", "pod-ob", "--", "cat", "/tmp/reboot_download")
 		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
 		Expect(stdout).To(Equal([]byte("reboot data\n")))
 	})
@@ -555,7 +564,7 @@ spec:
 
 func waitRGW(ns, podName string) {
 	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "exec", "-n", ns, podName, "--", "sh", "-c",
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "exec", "-n", ns, podName, "--", "sh", "-c",
 			`"s3cmd ls s3://\${BUCKET_NAME}/ --no-ssl --host=\${BUCKET_HOST} --host-bucket="`)
 		if err != nil {
 			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
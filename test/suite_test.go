@@ -2,7 +2,6 @@ package test
 
 import (
 	"fmt"
-	"os"
 	"testing"
 	"time"
 
@@ -12,10 +11,19 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// defaultWaitTimeout is the timeout of Eventually and waitFor.
+const defaultWaitTimeout = 40 * time.Minute
+
 func Test(t *testing.T) {
-	if os.Getenv("SSH_PRIVKEY") == "" {
+	if cfg.SSHPrivKey == "" {
 		t.Skip("no SSH_PRIVKEY envvar")
 	}
+	if cfgErr != nil {
+		t.Fatal(cfgErr)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
 
 	RegisterFailHandler(Fail)
 	junitReporter := reporters.NewJUnitReporter("/tmp/junit.xml")
@@ -26,7 +34,7 @@ var _ = BeforeSuite(func() {
 	fmt.Println("Preparing...")
 
 	SetDefaultEventuallyPollingInterval(time.Second)
-	SetDefaultEventuallyTimeout(40 * time.Minute)
+	SetDefaultEventuallyTimeout(defaultWaitTimeout)
 
 	prepare()
 
@@ -42,10 +50,11 @@ var _ = Describe("Test applications", func() {
 		fmt.Printf("START: %s\n", time.Now().Format(time.RFC3339))
 	})
 	AfterEach(func() {
+		collectDiagnostics()
 		fmt.Printf("END: %s\n", time.Now().Format(time.RFC3339))
 	})
 
-	switch testSuite {
+	switch cfg.Suite {
 	case "bootstrap":
 		bootstrapTest()
 	case "prepare":
@@ -63,7 +72,7 @@ func bootstrapTest() {
 }
 
 func prepareTest() {
-	if doReboot {
+	if cfg.Reboot {
 		Context("prepare reboot rook-ceph", prepareRebootRookCeph)
 		Context("reboot", testRebootAllNodes)
 		Context("reboot rook-ceph", testRebootRookCeph)
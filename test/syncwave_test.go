@@ -0,0 +1,483 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/neco-apps/test/manifest"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+const syncWaveAnnotation = "argocd.argoproj.io/sync-wave"
+
+// builtinNamespaces exist before Argo CD syncs applications.
+var builtinNamespaces = map[string]bool{
+	"default":         true,
+	"kube-node-lease": true,
+	"kube-public":     true,
+	"kube-system":     true,
+}
+
+// syncWaveDependency means app should be synchronized after the application after.
+type syncWaveDependency struct {
+	app     string
+	after   string
+	reasons []string
+}
+
+// buildSyncWaveDependencies builds the dependency graph of the applications from their rendered manifests.
+//
+// An application depends on
+//   - the applications that ship the CRDs of its custom resources,
+//   - the applications that create the namespaces of its objects, and
+//   - the application that ships cert-manager if it has admission webhooks,
+//     because the CA bundles of webhooks are injected by cert-manager.
+func buildSyncWaveDependencies(t *testing.T, apps []overlayApp, idx *manifest.Index) []*syncWaveDependency {
+	crdOwners := map[string][]string{}
+	nsOwners := map[string][]string{}
+	webhookApps := map[string]bool{}
+	for _, app := range apps {
+		if app.Dir == "" {
+			continue
+		}
+		if err := idx.Err(app.Dir); err != nil {
+			t.Fatalf("failed to render %s: %v", app.Dir, err)
+		}
+		for _, obj := range idx.Source(app.Dir).All() {
+			switch obj.GetKind() {
+			case "CustomResourceDefinition":
+				group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+				kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+				gk := kind + "." + group
+				crdOwners[gk] = append(crdOwners[gk], app.Name)
+			case "Namespace":
+				if !builtinNamespaces[obj.GetName()] {
+					nsOwners[obj.GetName()] = append(nsOwners[obj.GetName()], app.Name)
+				}
+			case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+				webhookApps[app.Name] = true
+			}
+		}
+	}
+	certManagerApps := crdOwners["Certificate.cert-manager.io"]
+
+	deps := map[[2]string]*syncWaveDependency{}
+	addDependency := func(app string, owners []string, reason string) {
+		for _, o := range owners {
+			if o == app {
+				// the application provides it by itself.
+				return
+			}
+		}
+		for _, o := range owners {
+			key := [2]string{app, o}
+			dep, ok := deps[key]
+			if !ok {
+				dep = &syncWaveDependency{app: app, after: o}
+				deps[key] = dep
+			}
+			dep.reasons = append(dep.reasons, reason)
+		}
+	}
+
+	for _, app := range apps {
+		if app.Dir == "" {
+			continue
+		}
+		usedCRDs := map[string]bool{}
+		usedNamespaces := map[string]bool{}
+		for _, obj := range idx.Source(app.Dir).All() {
+			gk := obj.GroupVersionKind().GroupKind().String()
+			if _, ok := crdOwners[gk]; ok && !usedCRDs[gk] {
+				usedCRDs[gk] = true
+				addDependency(app.Name, crdOwners[gk], "uses "+gk)
+			}
+			ns := obj.GetNamespace()
+			if _, ok := nsOwners[ns]; ok && !usedNamespaces[ns] {
+				usedNamespaces[ns] = true
+				addDependency(app.Name, nsOwners[ns], "uses namespace "+ns)
+			}
+		}
+		if webhookApps[app.Name] {
+			addDependency(app.Name, certManagerApps, "has admission webhooks")
+		}
+	}
+
+	ret := make([]*syncWaveDependency, 0, len(deps))
+	for _, dep := range deps {
+		ret = append(ret, dep)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].app != ret[j].app {
+			return ret[i].app < ret[j].app
+		}
+		return ret[i].after < ret[j].after
+	})
+	return ret
+}
+
+// syncWaveOf returns the sync-wave of an object.  found is false if the annotation is missing,
+// in which case Argo CD puts the object in wave 0.
+func syncWaveOf(annotations map[string]string) (wave int, found bool, err error) {
+	v, ok := annotations[syncWaveAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+	wave, err = strconv.Atoi(v)
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid %s annotation %q: %w", syncWaveAnnotation, v, err)
+	}
+	return wave, true, nil
+}
+
+// checkResourceSyncWaves checks the sync-waves of the objects of an application.
+// Argo CD syncs the objects of an application wave by wave, and sorts Namespaces and CRDs
+// before the other objects in the same wave.  An object must not be in an earlier wave than
+// the following objects of the same application:
+//   - the CRD of its kind,
+//   - its Namespace,
+//   - the admission webhook configurations that handle creating or updating it, and
+//   - for admission webhook configurations, the Service and the workloads that serve the webhooks.
+func checkResourceSyncWaves(idx *manifest.Index) []string {
+	var problems []string
+	waves := make(map[*manifest.Object]int)
+	for _, obj := range idx.All() {
+		wave, _, err := syncWaveOf(obj.GetAnnotations())
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", manifest.KeyOf(obj.Unstructured), err))
+			continue
+		}
+		waves[obj] = wave
+	}
+
+	reported := make(map[string]bool)
+	// check reports that obj should not be in an earlier wave than dep.
+	check := func(obj, dep *manifest.Object, reason string) {
+		objWave, ok1 := waves[obj]
+		depWave, ok2 := waves[dep]
+		if !ok1 || !ok2 {
+			// already reported as invalid
+			return
+		}
+		if objWave < depWave {
+			p := fmt.Sprintf("%s (wave %d) should not be in an earlier wave than %s (wave %d): %s",
+				manifest.KeyOf(obj.Unstructured), objWave, manifest.KeyOf(dep.Unstructured), depWave, reason)
+			if !reported[p] {
+				reported[p] = true
+				problems = append(problems, p)
+			}
+		}
+	}
+
+	crds := make(map[string][]*manifest.Object)
+	for _, crd := range idx.CustomResourceDefinitions() {
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		gk := kind + "." + group
+		crds[gk] = append(crds[gk], crd)
+	}
+	namespaces := make(map[string][]*manifest.Object)
+	for _, ns := range idx.Namespaces() {
+		namespaces[ns.GetName()] = append(namespaces[ns.GetName()], ns)
+	}
+	// servers is the Services and the workloads that serve the admission webhooks.
+	servers := make(map[*manifest.Object]bool)
+	var webhooks []*manifest.Object
+	var rules []webhookRule
+	for _, kind := range []string{"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"} {
+		for _, wh := range idx.ByKind(kind) {
+			webhooks = append(webhooks, wh)
+			hooks, _, _ := unstructured.NestedSlice(wh.Object, "webhooks")
+			for _, h := range hooks {
+				hook := h.(map[string]interface{})
+				namespace, _, _ := unstructured.NestedString(hook, "clientConfig", "service", "namespace")
+				name, _, _ := unstructured.NestedString(hook, "clientConfig", "service", "name")
+				for _, svc := range idx.Lookup("Service", namespace, name) {
+					servers[svc] = true
+					check(wh, svc, "calls the service")
+					selector, _, _ := unstructured.NestedStringMap(svc.Object, "spec", "selector")
+					if len(selector) == 0 {
+						continue
+					}
+					for _, kind := range []string{"Deployment", "StatefulSet", "DaemonSet"} {
+						for _, w := range idx.InNamespace(kind, namespace) {
+							podLabels, _, _ := unstructured.NestedStringMap(w.Object, "spec", "template", "metadata", "labels")
+							if labels.SelectorFromSet(selector).Matches(labels.Set(podLabels)) {
+								servers[w] = true
+								check(wh, w, "calls the service "+name)
+							}
+						}
+					}
+				}
+
+				hookRules, _, _ := unstructured.NestedSlice(hook, "rules")
+				for _, r := range hookRules {
+					r := r.(map[string]interface{})
+					operations, _, _ := unstructured.NestedStringSlice(r, "operations")
+					if !containsString(operations, "CREATE") && !containsString(operations, "UPDATE") && !containsString(operations, "*") {
+						// the webhook does not handle applying the objects
+						continue
+					}
+					groups, _, _ := unstructured.NestedStringSlice(r, "apiGroups")
+					resources, _, _ := unstructured.NestedStringSlice(r, "resources")
+					rules = append(rules, webhookRule{webhook: wh, groups: groups, resources: resources})
+				}
+			}
+		}
+	}
+
+	for _, obj := range idx.All() {
+		gk := obj.GroupVersionKind().GroupKind()
+		for _, crd := range crds[gk.String()] {
+			check(obj, crd, "uses "+gk.String())
+		}
+		for _, ns := range namespaces[obj.GetNamespace()] {
+			check(obj, ns, "is in namespace "+obj.GetNamespace())
+		}
+		if servers[obj] {
+			// the webhooks cannot handle the objects serving them
+			continue
+		}
+		resource := resourceOf(obj, crds)
+		for _, r := range rules {
+			if r.webhook != obj && r.matches(gk.Group, resource) {
+				check(obj, r.webhook, "is handled by the admission webhooks")
+			}
+		}
+	}
+
+	return problems
+}
+
+// webhookRule is a rule of an admission webhook that handles CREATE or UPDATE.
+type webhookRule struct {
+	webhook   *manifest.Object
+	groups    []string
+	resources []string
+}
+
+func (r webhookRule) matches(group, resource string) bool {
+	if !containsString(r.groups, "*") && !containsString(r.groups, group) {
+		return false
+	}
+	for _, res := range r.resources {
+		if res == "*" || res == "*/*" || res == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceOf returns the resource name of obj, which is the plural of the CRD in crds
+// or the one guessed from the kind.
+func resourceOf(obj *manifest.Object, crds map[string][]*manifest.Object) string {
+	gvk := obj.GroupVersionKind()
+	for _, crd := range crds[gvk.GroupKind().String()] {
+		if plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural"); plural != "" {
+			return plural
+		}
+	}
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return plural.Resource
+}
+
+// testSyncWaves checks the sync-waves of the objects in each application,
+// and the sync-waves of the applications in each overlay.
+func testSyncWaves(t *testing.T) {
+	overlays, err := findOverlays()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Parallel()
+	for _, overlay := range overlays {
+		overlay := overlay
+		t.Run(overlay, func(t *testing.T) {
+			t.Parallel()
+
+			apps, idx := loadOverlay(t, overlay)
+			for _, app := range apps {
+				if app.Dir == "" {
+					continue
+				}
+				if idx.Err(app.Dir) != nil {
+					// reported by Overlays
+					continue
+				}
+				for _, p := range checkResourceSyncWaves(idx.Source(app.Dir)) {
+					t.Errorf("application %s: %s", app.Name, p)
+				}
+			}
+
+			waves := map[string]int{}
+			for i := range apps {
+				wave, found, err := syncWaveOf(apps[i].GetAnnotations())
+				switch {
+				case err != nil:
+					t.Errorf("application %s: %v", apps[i].Name, err)
+				case !found:
+					t.Errorf("application %s: %s annotation is missing", apps[i].Name, syncWaveAnnotation)
+				default:
+					waves[apps[i].Name] = wave
+				}
+			}
+			for _, app := range apps {
+				if app.Dir != "" && idx.Err(app.Dir) != nil {
+					// buildSyncWaveDependencies needs all applications
+					return
+				}
+			}
+			for _, dep := range buildSyncWaveDependencies(t, apps, idx) {
+				appWave, ok1 := waves[dep.app]
+				afterWave, ok2 := waves[dep.after]
+				if !ok1 || !ok2 {
+					// already reported as missing
+					continue
+				}
+				if appWave <= afterWave {
+					t.Errorf("application %s (wave %d) should be in a later wave than %s (wave %d): %s",
+						dep.app, appWave, dep.after, afterWave, strings.Join(dep.reasons, ", "))
+				}
+			}
+		})
+	}
+}
+
+func TestCheckResourceSyncWaves(t *testing.T) {
+	const manifests = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: foo
+  annotations:
+    argocd.argoproj.io/sync-wave: "1"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: early
+  namespace: foo
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: bars.example.com
+spec:
+  group: example.com
+  names:
+    kind: Bar
+    plural: bars
+---
+apiVersion: example.com/v1
+kind: Bar
+metadata:
+  name: early
+  annotations:
+    argocd.argoproj.io/sync-wave: "-1"
+---
+apiVersion: example.com/v1
+kind: Bar
+metadata:
+  name: late
+  annotations:
+    argocd.argoproj.io/sync-wave: "3"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: webhook
+  namespace: foo
+  annotations:
+    argocd.argoproj.io/sync-wave: "1"
+spec:
+  selector:
+    app: webhook
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: webhook
+  namespace: foo
+  annotations:
+    argocd.argoproj.io/sync-wave: "2"
+spec:
+  template:
+    metadata:
+      labels:
+        app: webhook
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: webhook
+  annotations:
+    argocd.argoproj.io/sync-wave: "1"
+webhooks:
+- name: bar.example.com
+  clientConfig:
+    service:
+      namespace: foo
+      name: webhook
+  rules:
+  - apiGroups: ["example.com"]
+    resources: ["bars"]
+    operations: ["CREATE", "UPDATE"]
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: bar
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: prevent-delete
+  annotations:
+    argocd.argoproj.io/sync-wave: "2"
+webhooks:
+- name: namespace.example.com
+  clientConfig:
+    service:
+      namespace: foo
+      name: webhook
+  rules:
+  - apiGroups: [""]
+    resources: ["namespaces"]
+    operations: ["DELETE"]
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: invalid
+  annotations:
+    argocd.argoproj.io/sync-wave: "first"
+`
+	var objs []*unstructured.Unstructured
+	for _, doc := range strings.Split(manifests, "\n---\n") {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(doc), &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		objs = append(objs, obj)
+	}
+	idx := manifest.NewIndex()
+	idx.Add("test", objs)
+
+	expected := []string{
+		`ConfigMap invalid: invalid argocd.argoproj.io/sync-wave annotation "first": strconv.Atoi: parsing "first": invalid syntax`,
+		"ValidatingWebhookConfiguration.admissionregistration.k8s.io webhook (wave 1) should not be in an earlier wave than Deployment.apps foo/webhook (wave 2): calls the service webhook",
+		"ConfigMap foo/early (wave 0) should not be in an earlier wave than Namespace foo (wave 1): is in namespace foo",
+		"Bar.example.com early (wave -1) should not be in an earlier wave than CustomResourceDefinition.apiextensions.k8s.io bars.example.com (wave 0): uses Bar.example.com",
+		"Bar.example.com early (wave -1) should not be in an earlier wave than ValidatingWebhookConfiguration.admissionregistration.k8s.io webhook (wave 1): is handled by the admission webhooks",
+	}
+	if actual := checkResourceSyncWaves(idx); !cmp.Equal(actual, expected) {
+		t.Error(cmp.Diff(expected, actual))
+	}
+}
@@ -72,7 +72,7 @@ const (
 var authCanIRowRegexp = regexp.MustCompile(rowRegexp)
 
 func getActualVerbs(team, ns string) map[string][]string {
-	stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", ns, "--as=test", "--as-group="+team, "--as-group=system:authenticated", "auth", "can-i", "--list", "--no-headers")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", ns, "--as=test", "--as-group="+team, "--as-group=system:authenticated", "auth", "can-i", "--list", "--no-headers")
 	Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 
 	ret := map[string][]string{}
@@ -97,28 +97,62 @@ func getActualVerbs(team, ns string) map[string][]string {
 		if resource == "" {
 			continue
 		}
-		origVerbs := strings.Split(submatch[4], " ")
+		ret[resource] = normalizeVerbs(strings.Split(submatch[4], " "))
+	}
+	return ret
+}
 
-		// '*' means can do everything
-		for _, v := range origVerbs {
-			if v == "*" {
-				ret[resource] = allVerbs
-				continue
-			}
+// normalizeVerbs removes duplicate verbs and the verbs not in allVerbs, and sorts the rest in the order of allVerbs.
+// '*' means can do everything.
+func normalizeVerbs(origVerbs []string) []string {
+	found := map[string]bool{}
+	for _, v := range origVerbs {
+		if v == "*" {
+			return allVerbs
 		}
+		found[v] = true
+	}
+	verbs := make([]string, 0, len(allVerbs))
+	for _, v := range allVerbs {
+		if found[v] {
+			verbs = append(verbs, v)
+		}
+	}
+	return verbs
+}
 
-		// remove duplicate verb
-		found := map[string]bool{}
-		for _, v := range origVerbs {
-			found[v] = true
+// expectedTeamVerbs returns the verbs that an unprivileged team should have for each resource in ns.
+// nsOwner maps namespaces to their owner teams.
+func expectedTeamVerbs(team, ns string, nsOwner map[string]string) map[string][]string {
+	ret := map[string][]string{}
+	isAdmin := ns == "sandbox" || nsOwner[ns] == team || (team == "maneki" && nsOwner[ns] != "neco")
+
+	// check secrets
+	for _, resource := range []string{"secrets", "sealedsecrets.bitnami.com"} {
+		if isAdmin {
+			ret[resource] = adminVerbs
+		} else {
+			ret[resource] = prohibitedVerbs
 		}
-		verbs := make([]string, 0, len(allVerbs))
-		for _, v := range allVerbs {
-			if found[v] {
-				verbs = append(verbs, v)
-			}
+	}
+
+	// check required resources
+	for _, resource := range requiredResources {
+		if isAdmin {
+			ret[resource] = adminVerbs
+		} else {
+			ret[resource] = viewVerbs
 		}
-		ret[resource] = verbs
+	}
+
+	// check prohibited resources
+	for _, resource := range prohibitedResources {
+		ret[resource] = viewVerbs
+	}
+
+	// check viewable cluster resources
+	for _, resource := range viewableClusterResources {
+		ret[resource] = viewVerbs
 	}
 	return ret
 }
@@ -130,7 +164,7 @@ func testTeamManagement() {
 		tenantTeamList := []string{}
 
 		By("listing namespaces and their owner team")
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "namespaces", "-o=json")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "get", "namespaces", "-o=json")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 
 		nsList := new(corev1.NamespaceList)
@@ -177,56 +211,9 @@ func testTeamManagement() {
 			for _, ns := range namespaceList {
 				actualVerbsByResource := getActualVerbs(team, ns)
 
-				// check secrets
-				for _, resource := range []string{"secrets", "sealedsecrets.bitnami.com"} {
-					key := keyGen(team, ns, resource)
-
-					if ns == "sandbox" || nsOwner[ns] == team || (team == "maneki" && nsOwner[ns] != "neco") {
-						expectedVerbs[key] = adminVerbs
-					} else {
-						expectedVerbs[key] = prohibitedVerbs
-					}
-
-					if v, ok := actualVerbsByResource[resource]; ok {
-						actualVerbs[key] = v
-					} else {
-						actualVerbs[key] = prohibitedVerbs
-					}
-				}
-
-				// check required resources
-				for _, resource := range requiredResources {
-					key := keyGen(team, ns, resource)
-
-					if ns == "sandbox" || nsOwner[ns] == team || (team == "maneki" && nsOwner[ns] != "neco") {
-						expectedVerbs[key] = adminVerbs
-					} else {
-						expectedVerbs[key] = viewVerbs
-					}
-
-					if v, ok := actualVerbsByResource[resource]; ok {
-						actualVerbs[key] = v
-					} else {
-						actualVerbs[key] = prohibitedVerbs
-					}
-				}
-
-				// check prohibited resources
-				for _, resource := range prohibitedResources {
-					key := keyGen(team, ns, resource)
-					expectedVerbs[key] = viewVerbs
-
-					if v, ok := actualVerbsByResource[resource]; ok {
-						actualVerbs[key] = v
-					} else {
-						actualVerbs[key] = prohibitedVerbs
-					}
-				}
-
-				// check viewable cluster resources
-				for _, resource := range viewableClusterResources {
+				for resource, verbs := range expectedTeamVerbs(team, ns, nsOwner) {
 					key := keyGen(team, ns, resource)
-					expectedVerbs[key] = viewVerbs
+					expectedVerbs[key] = verbs
 
 					if v, ok := actualVerbsByResource[resource]; ok {
 						actualVerbs[key] = v
@@ -241,7 +228,7 @@ func testTeamManagement() {
 		Expect(actualVerbs).To(Equal(expectedVerbs), cmp.Diff(actualVerbs, expectedVerbs))
 
 		By("listing cluster resources")
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "api-resources", "--namespaced=false", "-o=name", "--sort-by=name")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "api-resources", "--namespaced=false", "-o=name", "--sort-by=name")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 
 		var clusterResources []string
@@ -276,12 +263,12 @@ func testTeamManagement() {
 
 	It("should give authority of ephemeral containers to unprivileged team", func() {
 		By("creating test pod")
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "run", "-n", "maneki", "neco-ephemeral-test", "--image=quay.io/cybozu/ubuntu-debug:20.04", "pause")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "run", "-n", "maneki", "neco-ephemeral-test", "--image=quay.io/cybozu/ubuntu-debug:20.04", "pause")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 
 		By("waiting the pod become ready")
 		Eventually(func() error {
-			stdout, _, err := ExecAt(boot0, "kubectl", "get", "-n", "maneki", "pod/neco-ephemeral-test", "-o=json")
+			stdout, _, err := ExecAt(cfg.Boot0, "kubectl", "get", "-n", "maneki", "pod/neco-ephemeral-test", "-o=json")
 			if err != nil {
 				return err
 			}
@@ -299,7 +286,7 @@ func testTeamManagement() {
 		}).Should(Succeed())
 
 		By("adding a ephemeral container by unprivileged team")
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "alpha", "debug", "-i", "-n", "maneki", "neco-ephemeral-test", "--image=quay.io/cybozu/ubuntu-debug:20.04", "--target=neco-ephemeral-test", "--as=test", "--as-group=maneki", "--as-group=system:authenticated", "--", "echo a")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "alpha", "debug", "-i", "-n", "maneki", "neco-ephemeral-test", "--image=quay.io/cybozu/ubuntu-debug:20.04", "--target=neco-ephemeral-test", "--as=test", "--as-group=maneki", "--as-group=system:authenticated", "--", "echo a")
 		Expect(err).NotTo(HaveOccurred(), "stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 	})
 }
@@ -21,6 +21,10 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
+func init() {
+	registerDiagnostics("teleport", []string{"teleport"})
+}
+
 type Node struct {
 	Kind     string
 	Metadata struct {
@@ -32,7 +36,7 @@ func teleportNodeServiceTest() {
 	By("retrieving LoadBalancer IP address of teleport auth service")
 	var addr string
 	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "teleport", "get", "service", "teleport-auth",
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "teleport", "get", "service", "teleport-auth",
 			"--output=jsonpath={.status.loadBalancer.ingress[0].ip}")
 		if err != nil {
 			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
@@ -46,11 +50,11 @@ func teleportNodeServiceTest() {
 	}).Should(Succeed())
 
 	By("storing LoadBalancer IP address to etcd")
-	ExecSafeAt(boot0, "env", "ETCDCTL_API=3", "etcdctl", "--cert=/etc/etcd/backup.crt", "--key=/etc/etcd/backup.key",
+	ExecSafeAt(cfg.Boot0, "env", "ETCDCTL_API=3", "etcdctl", "--cert=/etc/etcd/backup.crt", "--key=/etc/etcd/backup.key",
 		"put", "/neco/teleport/auth-servers", `[\"`+addr+`:3025\"]`)
 
 	By("starting teleport node services on boot servers")
-	for _, h := range []string{boot0, boot1, boot2} {
+	for _, h := range []string{cfg.Boot0, cfg.Boot1, cfg.Boot2} {
 		ExecSafeAt(h, "sudo", "neco", "teleport", "config")
 		ExecSafeAt(h, "sudo", "systemctl", "start", "teleport-node.service")
 	}
@@ -59,22 +63,22 @@ func teleportNodeServiceTest() {
 func teleportSSHConnectionTest() {
 	// Run on boot1 because this test changes kubectl config and it causes failures of other tests running in parallel when those execute kubectl on boot0
 	By("prepare .kube/config on boot1")
-	_, stderr, err := ExecAt(boot1, "mkdir", "-p", "~/.kube")
+	_, stderr, err := ExecAt(cfg.Boot1, "mkdir", "-p", "~/.kube")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
-	_, stderr, err = ExecAt(boot1, "ckecli", "kubernetes", "issue", ">", "~/.kube/config")
+	_, stderr, err = ExecAt(cfg.Boot1, "ckecli", "kubernetes", "issue", ">", "~/.kube/config")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 
 	By("adding proxy addr entry to /etc/hosts")
-	stdout, stderr, err := ExecAt(boot1, "kubectl", "-n", "teleport", "get", "service", "teleport-proxy",
+	stdout, stderr, err := ExecAt(cfg.Boot1, "kubectl", "-n", "teleport", "get", "service", "teleport-proxy",
 		"--output=jsonpath={.status.loadBalancer.ingress[0].ip}")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 	addr := string(stdout)
 	entry := fmt.Sprintf("%s teleport.gcp0.dev-ne.co", addr)
-	_, stderr, err = ExecAt(boot1, "sudo", "sh", "-c", fmt.Sprintf(`'echo "%s" >> /etc/hosts'`, entry))
+	_, stderr, err = ExecAt(cfg.Boot1, "sudo", "sh", "-c", fmt.Sprintf(`'echo "%s" >> /etc/hosts'`, entry))
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 
 	By("creating user")
-	stdout, stderr, err = ExecAt(boot1, "kubectl", "-n", "teleport", "exec", "teleport-auth-0", "tctl", "users", "add", "cybozu", "cybozu,root")
+	stdout, stderr, err = ExecAt(cfg.Boot1, "kubectl", "-n", "teleport", "exec", "teleport-auth-0", "tctl", "users", "add", "cybozu", "cybozu,root")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 	tctlOutput := string(stdout)
 	fmt.Println("output:")
@@ -105,9 +109,9 @@ func teleportSSHConnectionTest() {
 
 	By("accessing invite URL")
 	filename := "teleport_cookie.txt"
-	_, stderr, err = ExecAt(boot1, "curl", "--fail", "--insecure", "-c", filename, inviteURL)
+	_, stderr, err = ExecAt(cfg.Boot1, "curl", "--fail", "--insecure", "-c", filename, inviteURL)
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
-	stdout, stderr, err = ExecAt(boot1, "cat", filename)
+	stdout, stderr, err = ExecAt(cfg.Boot1, "cat", filename)
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 	cookieFileContents := string(stdout)
 	fmt.Println("cookie file:")
@@ -130,7 +134,7 @@ func teleportSSHConnectionTest() {
 	fmt.Printf("CSRF token: %s\n", csrfToken)
 
 	By("updating password")
-	_, stderr, err = ExecAt(boot1,
+	_, stderr, err = ExecAt(cfg.Boot1,
 		"curl",
 		"--fail", "--insecure",
 		"-X", "PUT",
@@ -146,12 +150,12 @@ func teleportSSHConnectionTest() {
 	Eventually(func() error {
 		// Use ssh command and run tsh to input password using pty
 		var cmd *exec.Cmd
-		if placematMajorVersion == "1" {
-			cmd = exec.Command("nsenter", "-n", "-t", operationPID, "ssh", "-oStrictHostKeyChecking=no", "-i", sshKeyFile,
-				fmt.Sprintf("cybozu@%s", boot1), "-t", "tsh", "--insecure", "--proxy=teleport.gcp0.dev-ne.co:443", "--user=cybozu login")
+		if cfg.PlacematMajorVersion == "1" {
+			cmd = exec.Command("nsenter", "-n", "-t", cfg.OperationPID, "ssh", "-oStrictHostKeyChecking=no", "-i", cfg.SSHPrivKey,
+				fmt.Sprintf("cybozu@%s", cfg.Boot1), "-t", "tsh", "--insecure", "--proxy=teleport.gcp0.dev-ne.co:443", "--user=cybozu login")
 		} else {
-			cmd = exec.Command("ip", "netns", "exec", "operation", "ssh", "-oStrictHostKeyChecking=no", "-i", sshKeyFile,
-				fmt.Sprintf("cybozu@%s", boot1), "-t", "tsh", "--insecure", "--proxy=teleport.gcp0.dev-ne.co:443", "--user=cybozu login")
+			cmd = exec.Command("ip", "netns", "exec", "operation", "ssh", "-oStrictHostKeyChecking=no", "-i", cfg.SSHPrivKey,
+				fmt.Sprintf("cybozu@%s", cfg.Boot1), "-t", "tsh", "--insecure", "--proxy=teleport.gcp0.dev-ne.co:443", "--user=cybozu login")
 		}
 		ptmx, err := pty.Start(cmd)
 		if err != nil {
@@ -167,13 +171,13 @@ func teleportSSHConnectionTest() {
 	}).Should(Succeed())
 
 	By("getting node resources with kubectl via teleport proxy")
-	_, stderr, err = ExecAt(boot1, "kubectl", "get", "nodes")
+	_, stderr, err = ExecAt(cfg.Boot1, "kubectl", "get", "nodes")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 
 	By("accessing boot servers using tsh command")
 	for _, n := range []string{"boot-0", "boot-1", "boot-2"} {
 		Eventually(func() error {
-			_, stderr, err := ExecAt(boot1, "tsh", "--insecure", "--proxy=teleport.gcp0.dev-ne.co:443", "--user=cybozu", "ssh", "cybozu@gcp0-"+n, "date")
+			_, stderr, err := ExecAt(cfg.Boot1, "tsh", "--insecure", "--proxy=teleport.gcp0.dev-ne.co:443", "--user=cybozu", "ssh", "cybozu@gcp0-"+n, "date")
 			if err != nil {
 				return fmt.Errorf("tsh ssh failed for %s: %s", n, string(stderr))
 			}
@@ -182,32 +186,32 @@ func teleportSSHConnectionTest() {
 	}
 
 	By("logout tsh")
-	_, stderr, err = ExecAt(boot1, "tsh", "--insecure", "--proxy=teleport.gcp0.dev-ne.co:443", "--user=cybozu", "logout")
+	_, stderr, err = ExecAt(cfg.Boot1, "tsh", "--insecure", "--proxy=teleport.gcp0.dev-ne.co:443", "--user=cybozu", "logout")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 
 	By("clearing kubectl config")
-	_, stderr, err = ExecAt(boot1, "ckecli", "kubernetes", "issue", ">", "~/.kube/config")
+	_, stderr, err = ExecAt(cfg.Boot1, "ckecli", "kubernetes", "issue", ">", "~/.kube/config")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 
 	By("clearing teleport_cookie.txt")
-	_, stderr, err = ExecAt(boot1, "rm", filename)
+	_, stderr, err = ExecAt(cfg.Boot1, "rm", filename)
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 
 	By("clearing /etc/hosts")
-	_, stderr, err = ExecAt(boot1, "sudo", "sed", "-i", "-e", "/teleport.gcp0.dev-ne.co/d", "/etc/hosts")
+	_, stderr, err = ExecAt(cfg.Boot1, "sudo", "sed", "-i", "-e", "/teleport.gcp0.dev-ne.co/d", "/etc/hosts")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 }
 
 func teleportAuthTest() {
 	By("getting the node list before recreating the teleport-auth pod")
-	stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "teleport", "exec", "teleport-auth-0", "tctl", "get", "nodes")
+	stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "teleport", "exec", "teleport-auth-0", "tctl", "get", "nodes")
 	Expect(err).ShouldNot(HaveOccurred(), "stderr=%s", stderr)
 	beforeNodes := decodeNodes(stdout)
 
 	By("recreating the teleport-auth pod")
-	ExecSafeAt(boot0, "kubectl", "-n", "teleport", "delete", "pod", "teleport-auth-0")
+	ExecSafeAt(cfg.Boot0, "kubectl", "-n", "teleport", "delete", "pod", "teleport-auth-0")
 	Eventually(func() error {
-		stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "teleport", "exec", "teleport-auth-0", "tctl", "status")
+		stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "teleport", "exec", "teleport-auth-0", "tctl", "status")
 		if err != nil {
 			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 		}
@@ -216,7 +220,7 @@ func teleportAuthTest() {
 
 	By("comparing the current node list with the obtained before")
 	Eventually(func() error {
-		stdout, stderr, err = ExecAt(boot0, "kubectl", "-n", "teleport", "exec", "teleport-auth-0", "tctl", "get", "nodes")
+		stdout, stderr, err = ExecAt(cfg.Boot0, "kubectl", "-n", "teleport", "exec", "teleport-auth-0", "tctl", "get", "nodes")
 		if err != nil {
 			return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 		}
@@ -231,7 +235,7 @@ func teleportAuthTest() {
 func teleportApplicationTest() {
 	// This test requires CNAME record "teleport.gcp0.dev-ne.co : teleport-proxy.teleport.svc".
 	By("getting the application names")
-	stdout, _, err := kustomizeBuild("../teleport/base/apps")
+	stdout, err := kustomizeBuild("../teleport/base/apps")
 	Expect(err).ShouldNot(HaveOccurred())
 	var appNames []string
 	y := k8sYaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(stdout)))
@@ -264,7 +268,7 @@ func teleportApplicationTest() {
 	Eventually(func() error {
 		for _, n := range appNames {
 			query := fmt.Sprintf("'.[].spec.apps[].name | select(. == \"%s\")'", n)
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n", "teleport", "exec", "-it", "teleport-auth-0", "--", "tctl", "apps", "ls", "--format=json", "--", "|", "jq", "-r", query)
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n", "teleport", "exec", "-it", "teleport-auth-0", "--", "tctl", "apps", "ls", "--format=json", "--", "|", "jq", "-r", query)
 			if err != nil {
 				return fmt.Errorf("stdout: %s, stderr: %s, err: %v", stdout, stderr, err)
 			}
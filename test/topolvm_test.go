@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,10 @@ import (
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
 )
 
+func init() {
+	registerDiagnostics("topolvm", []string{"topolvm-system", "sandbox"})
+}
+
 func prepareTopoLVM() {
 	It("should prepare a Pod and a PVC", func() {
 		manifest := `
@@ -52,41 +57,25 @@ spec:
       storage: 3Gi
   storageClassName: topolvm-provisioner
 `
-		stdout, stderr, err := ExecAtWithInput(boot0, []byte(manifest), "kubectl", "apply", "-f", "-")
-		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
+		err := kube().Apply(context.Background(), manifest)
+		Expect(err).ShouldNot(HaveOccurred())
 	})
 }
 
 func testTopoLVM() {
 	It("should work TopoLVM pod and auto-resizer", func() {
 		By("checking PodDisruptionBudget for controller Deployment")
-		Eventually(func() error {
-			pdb := policyv1beta1.PodDisruptionBudget{}
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "poddisruptionbudgets", "controller-pdb", "-n", "topolvm-system", "-o", "json")
-			if err != nil {
-				return fmt.Errorf("failed to get TopoLVM pdb: %s: %w", stderr, err)
-			}
-
-			if err := json.Unmarshal(stdout, &pdb); err != nil {
-				return err
-			}
+		pdb := new(policyv1beta1.PodDisruptionBudget)
+		waitFor("topolvm-system", "controller-pdb", pdb, func() error {
 			if pdb.Status.CurrentHealthy != 2 {
 				return fmt.Errorf("too few healthy pods: %d", pdb.Status.CurrentHealthy)
 			}
 			return nil
-		}).Should(Succeed())
+		})
 
 		By("checking the test pod is running")
-		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "get", "-n", "sandbox", "pods", "topolvm-test", "-o", "json")
-			if err != nil {
-				return fmt.Errorf("failed to get topolvm-test pod: %s: %w", stderr, err)
-			}
-			pod := &corev1.Pod{}
-			if err := json.Unmarshal(stdout, pod); err != nil {
-				return err
-			}
-
+		pod := new(corev1.Pod)
+		waitFor("sandbox", "topolvm-test", pod, func() error {
 			for _, cond := range pod.Status.Conditions {
 				if cond.Type != corev1.PodReady {
 					continue
@@ -96,14 +85,14 @@ func testTopoLVM() {
 				}
 			}
 			return errors.New("topolvm-test pod is not ready")
-		}).Should(Succeed())
+		})
 
 		By("writing large file")
-		ExecSafeAt(boot0, "kubectl", "exec", "-n", "sandbox", "topolvm-test", "--", "dd", "if=/dev/zero", "of=/test1/largefile", "bs=1M", "count=110")
+		ExecSafeAt(cfg.Boot0, "kubectl", "exec", "-n", "sandbox", "topolvm-test", "--", "dd", "if=/dev/zero", "of=/test1/largefile", "bs=1M", "count=110")
 
 		By("waiting for the PV getting resized")
 		Eventually(func() error {
-			stdout, stderr, err := ExecAt(boot0, "kubectl", "-n=monitoring", "exec", "vmselect-vmcluster-largeset-0", "-i", "--", "curl", "-sf", "http://localhost:8481/select/0/prometheus/api/v1/query?query=kubelet_volume_stats_capacity_bytes")
+			stdout, stderr, err := ExecAt(cfg.Boot0, "kubectl", "-n=monitoring", "exec", "vmselect-vmcluster-largeset-0", "-i", "--", "curl", "-sf", "http://localhost:8481/select/0/prometheus/api/v1/query?query=kubelet_volume_stats_capacity_bytes")
 			if err != nil {
 				return fmt.Errorf("stderr=%s: %w", string(stderr), err)
 			}
@@ -0,0 +1,155 @@
+// +build !kind
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cybozu-go/neco-apps/test/manifest"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// changedApplications returns the names of the applications in overlay
+// whose rendered manifests differ between the git revision base and the working tree.
+func changedApplications(base, overlay string) (map[string]bool, error) {
+	oldClusters, err := manifest.RenderRevision(manifestDir, base)
+	if err != nil {
+		return nil, err
+	}
+	newClusters, err := manifest.RenderClusters(manifest.NewRenderer(), manifestDir)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, d := range manifest.DiffClusters(oldClusters, newClusters) {
+		if d.Name != overlay {
+			continue
+		}
+		if d.Err != "" {
+			return nil, fmt.Errorf("argocd-config/overlays/%s: %s", overlay, d.Err)
+		}
+		for _, a := range d.Apps {
+			changed[a.Name] = true
+		}
+	}
+	return changed, nil
+}
+
+// rolloutState is the state of a workload that changes when it is rolled out.
+type rolloutState struct {
+	Generation int64
+	// Revision is the ReplicaSets of a Deployment or the update revision of a StatefulSet.
+	Revision string
+	// Pods is the UID and the restart count of the pods of the workload by name.
+	Pods map[string]string
+}
+
+// snapshotRollouts returns the rollout states of the Deployments, StatefulSets and DaemonSets of apps.
+// The keys are "app: Kind namespace/name".
+func snapshotRollouts(ctx context.Context, apps []string) (map[string]rolloutState, error) {
+	states := make(map[string]rolloutState)
+	for _, name := range apps {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(applicationGVK)
+		if err := kube().Get(ctx, "argocd", name, obj); err != nil {
+			return nil, err
+		}
+		app, err := decodeApplication(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range app.Status.Resources {
+			if r.Group != "apps" {
+				continue
+			}
+			var st rolloutState
+			switch r.Kind {
+			case "Deployment":
+				st, err = deploymentRollout(ctx, r.Namespace, r.Name)
+			case "StatefulSet":
+				st, err = statefulSetRollout(ctx, r.Namespace, r.Name)
+			case "DaemonSet":
+				st, err = daemonSetRollout(ctx, r.Namespace, r.Name)
+			default:
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s %s/%s: %w", name, r.Kind, r.Namespace, r.Name, err)
+			}
+			states[fmt.Sprintf("%s: %s %s/%s", name, r.Kind, r.Namespace, r.Name)] = st
+		}
+	}
+	return states, nil
+}
+
+func deploymentRollout(ctx context.Context, namespace, name string) (rolloutState, error) {
+	d := &appsv1.Deployment{}
+	if err := kube().Get(ctx, namespace, name, d); err != nil {
+		return rolloutState{}, err
+	}
+	rsList := &appsv1.ReplicaSetList{}
+	if err := kube().List(ctx, namespace, rsList, metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(d.Spec.Selector)}); err != nil {
+		return rolloutState{}, err
+	}
+	var rsNames []string
+	for i := range rsList.Items {
+		if metav1.IsControlledBy(&rsList.Items[i], d) {
+			rsNames = append(rsNames, rsList.Items[i].Name)
+		}
+	}
+	sort.Strings(rsNames)
+	return podRollout(ctx, namespace, d.Generation, strings.Join(rsNames, ","), d.Spec.Selector)
+}
+
+func statefulSetRollout(ctx context.Context, namespace, name string) (rolloutState, error) {
+	s := &appsv1.StatefulSet{}
+	if err := kube().Get(ctx, namespace, name, s); err != nil {
+		return rolloutState{}, err
+	}
+	return podRollout(ctx, namespace, s.Generation, s.Status.UpdateRevision, s.Spec.Selector)
+}
+
+func daemonSetRollout(ctx context.Context, namespace, name string) (rolloutState, error) {
+	ds := &appsv1.DaemonSet{}
+	if err := kube().Get(ctx, namespace, name, ds); err != nil {
+		return rolloutState{}, err
+	}
+	return podRollout(ctx, namespace, ds.Generation, "", ds.Spec.Selector)
+}
+
+func podRollout(ctx context.Context, namespace string, generation int64, revision string, selector *metav1.LabelSelector) (rolloutState, error) {
+	pods := &corev1.PodList{}
+	if err := kube().List(ctx, namespace, pods, metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(selector)}); err != nil {
+		return rolloutState{}, err
+	}
+	st := rolloutState{Generation: generation, Revision: revision, Pods: make(map[string]string)}
+	for _, pod := range pods.Items {
+		var restarts int32
+		for _, cs := range pod.Status.ContainerStatuses {
+			restarts += cs.RestartCount
+		}
+		st.Pods[pod.Name] = fmt.Sprintf("uid=%s restarts=%d", pod.UID, restarts)
+	}
+	return st, nil
+}
+
+// checkNoRollouts returns an error describing the workloads rolled out or restarted since before.
+func checkNoRollouts(ctx context.Context, apps []string, before map[string]rolloutState) error {
+	after, err := snapshotRollouts(ctx, apps)
+	if err != nil {
+		return err
+	}
+	if diff := cmp.Diff(before, after); diff != "" {
+		return fmt.Errorf("unchanged applications are rolled out (-before +after):\n%s", diff)
+	}
+	return nil
+}
@@ -1,23 +1,21 @@
 package test
 
 import (
-	"bufio"
-	"bytes"
+	"errors"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/cybozu-go/neco-apps/test/manifest"
+	"github.com/cybozu-go/neco-apps/test/schema"
 	"github.com/google/go-cmp/cmp"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
-	k8sYaml "k8s.io/apimachinery/pkg/util/yaml"
-	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -39,112 +37,139 @@ func isKustomizationFile(name string) bool {
 	return false
 }
 
-func kustomizeBuild(dir string) ([]byte, []byte, error) {
-	outBuf := new(bytes.Buffer)
-	errBuf := new(bytes.Buffer)
-	workdir, err := os.Getwd()
-	if err != nil {
-		return nil, nil, err
-	}
-	cmd := exec.Command(filepath.Join(workdir, "bin", "kustomize"), "build", dir)
-	cmd.Stdout = outBuf
-	cmd.Stderr = errBuf
-	err = cmd.Run()
-	return outBuf.Bytes(), errBuf.Bytes(), err
-}
+// renderer is shared by all tests so that each kustomization is built only once per run.
+var renderer = manifest.NewRenderer()
 
-func testNamespaceResources(t *testing.T) {
-	t.Parallel()
+var (
+	manifestIndexOnce sync.Once
+	manifestIndex     *manifest.Index
+	manifestIndexErr  error
+)
 
-	// All namespaces defined in neco-apps should have the `team` label.
-	// Exceptionally, `sandbox` ns should not have the `team` label.
-	doCheckKustomizedYaml(t, func(t *testing.T, data []byte) {
-		var meta struct {
-			metav1.TypeMeta   `json:",inline"`
-			metav1.ObjectMeta `json:"metadata,omitempty"`
-		}
-		err := yaml.Unmarshal(data, &meta)
+func kustomizeBuild(dir string) ([]byte, error) {
+	return renderer.Build(dir)
+}
+
+// findKustomizations returns the kustomization directories in neco-apps relative to manifestDir.
+func findKustomizations() ([]string, error) {
+	targets := []string{}
+	err := filepath.Walk(manifestDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			t.Fatal(err)
+			return err
 		}
-		if meta.Kind != "Namespace" {
-			return
+		if info.IsDir() {
+			return nil
 		}
-
-		// `sandbox` namespace should not have a team label.
-		if meta.Name == "sandbox" {
-			if _, ok := meta.Labels["team"]; ok {
-				t.Errorf("sandbox ns has team label: value=%s", meta.Labels["team"])
+		for _, exDir := range excludeDirs {
+			if strings.HasPrefix(path, exDir) {
+				// Skip files in the directory
+				return filepath.SkipDir
 			}
-			return
 		}
+		if !isKustomizationFile(info.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(manifestDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		targets = append(targets, rel)
+		// Skip other files in the directory
+		return filepath.SkipDir
+	})
+	return targets, err
+}
 
-		// other namespace should have a team label.
-		if meta.Labels["team"] == "" {
-			t.Errorf("%s ns doesn't have team label", meta.Name)
+// loadManifestIndex returns the index of all kustomizations in neco-apps.
+// The index is built only once and shared by all validation tests.
+func loadManifestIndex(t *testing.T) *manifest.Index {
+	manifestIndexOnce.Do(func() {
+		var dirs []string
+		dirs, manifestIndexErr = findKustomizations()
+		if manifestIndexErr != nil {
+			return
 		}
+		manifestIndex = manifest.BuildIndex(renderer, manifestDir, dirs)
 	})
+	if manifestIndexErr != nil {
+		t.Fatalf("failed to find kustomizations: %v", manifestIndexErr)
+	}
+	return manifestIndex
+}
+
+// loadSourceIndex returns the index of the objects rendered from a kustomization directory.
+// dir is relative to manifestDir and need not be found by findKustomizations.
+func loadSourceIndex(t *testing.T, dir string) *manifest.Index {
+	idx := manifest.BuildIndex(renderer, manifestDir, []string{dir})
+	if err := idx.Err(dir); err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func testNamespaceResources(t *testing.T) {
+	t.Parallel()
+	doCheckKustomizedYaml(t, checkNamespaceLabels)
+}
+
+// checkNamespaceLabels checks that all namespaces defined in neco-apps have the `team` label.
+// Exceptionally, `sandbox` ns should not have the `team` label.
+func checkNamespaceLabels(t *testing.T, obj *manifest.Object) {
+	if obj.GetKind() != "Namespace" {
+		return
+	}
+
+	nsLabels := obj.GetLabels()
+
+	// `sandbox` namespace should not have a team label.
+	if obj.GetName() == "sandbox" {
+		if _, ok := nsLabels["team"]; ok {
+			t.Errorf("sandbox ns has team label: value=%s", nsLabels["team"])
+		}
+		return
+	}
+
+	// other namespace should have a team label.
+	if nsLabels["team"] == "" {
+		t.Errorf("%s ns doesn't have team label", obj.GetName())
+	}
 }
 
 func testAppProjectResources(t *testing.T) {
 	// Verify the destination namespaces in the AppPorject for unprivileged team are listed correctly.
-	targetDir := filepath.Join(manifestDir, "team-management", "base")
+	idx := loadSourceIndex(t, filepath.Join("team-management", "base"))
 
 	namespacesByTeam := map[string][]string{}
 	namespacesInAppProject := map[string][]string{}
 
-	stdout, stderr, err := kustomizeBuild(targetDir)
-	if err != nil {
-		t.Fatalf("kustomize build failed. path: %s, stderr: %s, err: %v", targetDir, stderr, err)
-	}
-	y := k8sYaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(stdout)))
-	for {
-		data, err := y.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			t.Fatal(err)
+	for _, ns := range idx.Namespaces() {
+		if ns.GetName() == "sandbox" {
+			// Skip. sandbox ns does not have team label.
+			continue
 		}
 
-		var meta struct {
-			metav1.TypeMeta   `json:",inline"`
-			metav1.ObjectMeta `json:"metadata,omitempty"`
+		team := ns.GetLabels()["team"]
+		namespacesByTeam[team] = append(namespacesByTeam[team], ns.GetName())
+	}
+
+	for _, obj := range idx.AppProjects() {
+		if obj.GetName() == "default" || obj.GetName() == "tenant-app-of-apps" || obj.GetName() == "tenant-apps" {
+			// Skip. default app and tenant-app-of-apps app are privileged.
+			continue
 		}
-		err = yaml.Unmarshal(data, &meta)
+
+		var proj AppProject
+		err := obj.Decode(&proj)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		// Make lists from each resources.
-		switch meta.Kind {
-		case "Namespace":
-			if meta.Name == "sandbox" {
-				// Skip. sandbox ns does not have team label.
-				continue
-			}
-
-			team := meta.Labels["team"]
-			namespacesByTeam[team] = append(namespacesByTeam[team], meta.Name)
-
-		case "AppProject":
-			if meta.Name == "default" || meta.Name == "tenant-app-of-apps" || meta.Name == "tenant-apps" {
-				// Skip. default app and tenant-app-of-apps app are privileged.
-				continue
-			}
-
-			var proj AppProject
-			err = yaml.Unmarshal(data, &proj)
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			var namespaces []string
-			for _, dest := range proj.Spec.Destinations {
-				namespaces = append(namespaces, dest.Namespace)
-			}
-			sort.Strings(namespaces)
-			namespacesInAppProject[proj.Name] = namespaces
+		var namespaces []string
+		for _, dest := range proj.Spec.Destinations {
+			namespaces = append(namespaces, dest.Namespace)
 		}
+		sort.Strings(namespaces)
+		namespacesInAppProject[proj.Name] = namespaces
 	}
 
 	for team, namespaces := range namespacesByTeam {
@@ -202,40 +227,19 @@ func testApplicationResources(t *testing.T) {
 		},
 	}
 
-	// Getting overlays list
-	overlayDirs := map[string]string{}
-	err := filepath.Walk(filepath.Join(manifestDir, "argocd-config", "overlays"), func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() && info.Name() != "overlays" {
-			overlayDirs[info.Name()] = path
-		}
-		return nil
-	})
+	overlays, err := findOverlays()
 	if err != nil {
 		t.Error(err)
 	}
 
 	t.Parallel()
-	for overlay, targetDir := range overlayDirs {
+	for _, overlay := range overlays {
 		t.Run(overlay, func(t *testing.T) {
-			stdout, stderr, err := kustomizeBuild(targetDir)
-			if err != nil {
-				t.Errorf("kustomize build failed. path: %s, stderr: %s, err: %v", targetDir, stderr, err)
-			}
-
-			y := k8sYaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(stdout)))
-			for {
-				data, err := y.Read()
-				if err == io.EOF {
-					break
-				} else if err != nil {
-					t.Error(err)
-				}
+			idx := loadSourceIndex(t, overlayDir(overlay))
 
+			for _, obj := range idx.Applications() {
 				var app Application
-				err = yaml.Unmarshal(data, &app)
+				err := obj.Decode(&app)
 				if err != nil {
 					t.Error(err)
 				}
@@ -264,43 +268,145 @@ func testApplicationResources(t *testing.T) {
 	}
 }
 
-// Use to check the existence of the status field in manifest files for CRDs.
-// `apiextensionsv1beta1.CustomResourceDefinition` cannot be used because the status field always exists in the struct.
-type crdValidation struct {
-	Kind     string `json:"kind"`
-	Metadata struct {
-		Name string `json:"name"`
-	} `json:"metadata"`
-	Status *struct{} `json:"status"`
+const necoAppsRepoURL = manifest.RepoURL
+
+// findOverlays returns the names of argocd-config overlays, i.e. clusters.
+func findOverlays() ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(manifestDir, "argocd-config", "overlays"))
+	if err != nil {
+		return nil, err
+	}
+	var overlays []string
+	for _, e := range entries {
+		if e.IsDir() {
+			overlays = append(overlays, e.Name())
+		}
+	}
+	return overlays, nil
+}
+
+// overlayDir returns the argocd-config directory for overlay relative to manifestDir.
+func overlayDir(overlay string) string {
+	return filepath.Join("argocd-config", "overlays", overlay)
 }
 
-func testCRDStatus(t *testing.T) {
-	t.Parallel()
+// overlayApp is an Application deployed to a cluster.
+type overlayApp struct {
+	Application
 
-	doCheckKustomizedYaml(t, func(t *testing.T, data []byte) {
-		var crd crdValidation
-		err := yaml.Unmarshal(data, &crd)
-		if err != nil {
-			// Skip because this YAML might not be custom resource definition
-			return
-		}
+	// Dir is spec.source.path relative to manifestDir.
+	// It is empty if the application is not in neco-apps, e.g. tenant apps and Helm charts.
+	Dir string
+}
 
-		if crd.Kind != "CustomResourceDefinition" {
-			// Skip because this YAML is not custom resource definition
-			return
+// loadOverlay returns the Applications in argocd-config/overlays/<overlay> sorted by name,
+// and the index of the manifests rendered from their source paths.
+func loadOverlay(t *testing.T, overlay string) ([]overlayApp, *manifest.Index) {
+	var apps []overlayApp
+	var dirs []string
+	seen := map[string]bool{}
+	for _, obj := range loadSourceIndex(t, overlayDir(overlay)).Applications() {
+		var app overlayApp
+		if err := obj.Decode(&app.Application); err != nil {
+			t.Fatal(err)
 		}
-		if crd.Status != nil {
-			t.Errorf(".status(Status) exists in %s, remove it to prevent occurring OutOfSync by Argo CD", crd.Metadata.Name)
+		if app.Spec.Source.RepoURL == necoAppsRepoURL {
+			if app.Spec.Source.Path == "" {
+				t.Errorf("application %s has no source path", app.Name)
+			} else {
+				app.Dir = filepath.Clean(app.Spec.Source.Path)
+				if !seen[app.Dir] {
+					seen[app.Dir] = true
+					dirs = append(dirs, app.Dir)
+				}
+			}
 		}
-	})
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+
+	return apps, manifest.BuildIndex(renderer, manifestDir, dirs)
+}
+
+// objectCheck is a check applied to each rendered object.
+type objectCheck struct {
+	name  string
+	check func(*testing.T, *manifest.Object)
+}
+
+// objectChecks returns the per-object checks run by both the per-kustomization tests and testOverlays.
+func objectChecks(t *testing.T) []objectCheck {
+	checks := []objectCheck{
+		{name: "CRDStatus", check: checkCRDStatus},
+		{name: "CertificateUsages", check: checkCertificateUsages},
+		{name: "NamespaceLabels", check: checkNamespaceLabels},
+	}
+	if c := loadSchemaChecker(t); c != nil {
+		checks = append(checks, objectCheck{name: "Schema", check: c.check})
+	}
+	return checks
+}
+
+// testOverlays renders the applications deployed to each cluster as Argo CD does,
+// i.e. follows spec.source.path of the Applications in argocd-config/overlays/<overlay>,
+// and runs the per-object checks against the result.
+// Applications from other repositories such as tenant apps and Helm charts are not rendered.
+func testOverlays(t *testing.T) {
+	overlays, err := findOverlays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := objectChecks(t)
+
+	t.Parallel()
+	for _, overlay := range overlays {
+		overlay := overlay
+		t.Run(overlay, func(t *testing.T) {
+			t.Parallel()
+
+			apps, idx := loadOverlay(t, overlay)
+			for _, app := range apps {
+				if app.Dir == "" {
+					continue
+				}
+				sub := idx.Source(app.Dir)
+				t.Run(app.Name, func(t *testing.T) {
+					if err := sub.Err(app.Dir); err != nil {
+						t.Fatalf("failed to render %s: %v", app.Dir, err)
+					}
+					for _, c := range checks {
+						t.Run(c.name, func(t *testing.T) {
+							for _, obj := range sub.All() {
+								c.check(t, obj)
+							}
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
+func testCRDStatus(t *testing.T) {
+	t.Parallel()
+	doCheckKustomizedYaml(t, checkCRDStatus)
+}
+
+func checkCRDStatus(t *testing.T, obj *manifest.Object) {
+	if obj.GetKind() != "CustomResourceDefinition" {
+		// Skip because this YAML is not custom resource definition
+		return
+	}
+	// `apiextensionsv1beta1.CustomResourceDefinition` cannot be used because the status field always exists in the struct.
+	if _, ok := obj.Object["status"]; ok {
+		t.Errorf(".status(Status) exists in %s, remove it to prevent occurring OutOfSync by Argo CD", obj.GetName())
+	}
 }
 
 type certificateValidation struct {
-	Kind     string `json:"kind"`
-	Metadata struct {
-		Name string `json:"name"`
-	} `json:"metadata"`
-	Spec struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
 		IsCA   bool     `json:"isCA"`
 		Usages []string `json:"usages"`
 	} `json:"spec"`
@@ -308,75 +414,152 @@ type certificateValidation struct {
 
 func testCertificateUsages(t *testing.T) {
 	t.Parallel()
+	doCheckKustomizedYaml(t, checkCertificateUsages)
+}
 
-	doCheckKustomizedYaml(t, func(t *testing.T, data []byte) {
-		var cert certificateValidation
-		err := yaml.Unmarshal(data, &cert)
-		if err != nil {
-			// Skip because this YAML might not be certificate
-			return
-		}
+func checkCertificateUsages(t *testing.T, obj *manifest.Object) {
+	if obj.GetKind() != "Certificate" {
+		// Skip because this YAML is not certificate
+		return
+	}
 
-		if cert.Kind != "Certificate" {
-			// Skip because this YAML is not certificate
-			return
-		}
+	var cert certificateValidation
+	err := obj.Decode(&cert)
+	if err != nil {
+		t.Errorf("failed to convert Certificate %s: %v", obj.GetName(), err)
+		return
+	}
 
-		var expected []string
-		if cert.Spec.IsCA {
-			expected = []string{"digital signature", "key encipherment", "cert sign"}
-		} else {
-			expected = []string{"digital signature", "key encipherment", "server auth", "client auth"}
-		}
-		if !cmp.Equal(cert.Spec.Usages, expected) {
-			t.Errorf(".spec.usages has incorrect list in %s: %s", cert.Metadata.Name, cmp.Diff(cert.Spec.Usages, expected))
-		}
-	})
+	var expected []string
+	if cert.Spec.IsCA {
+		expected = []string{"digital signature", "key encipherment", "cert sign"}
+	} else {
+		expected = []string{"digital signature", "key encipherment", "server auth", "client auth"}
+	}
+	if !cmp.Equal(cert.Spec.Usages, expected) {
+		t.Errorf(".spec.usages has incorrect list in %s: %s", cert.Name, cmp.Diff(cert.Spec.Usages, expected))
+	}
 }
 
-func doCheckKustomizedYaml(t *testing.T, checkFunc func(*testing.T, []byte)) {
-	targets := []string{}
-	err := filepath.Walk(manifestDir, func(path string, info os.FileInfo, err error) error {
+// schemaChecker validates objects against the OpenAPI schemas of Kubernetes and CRDs in neco-apps.
+type schemaChecker struct {
+	validator *schema.Validator
+	files     *manifest.FileIndex
+
+	mu sync.Mutex
+	// noSchema records custom resources whose CRD is not in neco-apps.  They cannot be validated.
+	noSchema map[string]bool
+}
+
+var (
+	schemaCheckerOnce sync.Once
+	schemaCheckerInst *schemaChecker
+	schemaCheckerErr  error
+)
+
+// loadSchemaChecker returns the shared schemaChecker.
+// nil is returned if KUBERNETES_OPENAPI_SPEC is not defined.
+func loadSchemaChecker(t *testing.T) *schemaChecker {
+	specPath := os.Getenv("KUBERNETES_OPENAPI_SPEC")
+	if specPath == "" {
+		return nil
+	}
+	idx := loadManifestIndex(t)
+
+	schemaCheckerOnce.Do(func() {
+		spec, err := ioutil.ReadFile(specPath)
 		if err != nil {
-			return err
+			schemaCheckerErr = err
+			return
 		}
-		if info.IsDir() {
-			return nil
+		v := schema.NewValidator()
+		if err := v.LoadSwagger(spec); err != nil {
+			schemaCheckerErr = err
+			return
 		}
-		for _, exDir := range excludeDirs {
-			if strings.HasPrefix(path, exDir) {
-				// Skip files in the directory
-				return filepath.SkipDir
+		for _, crd := range idx.CustomResourceDefinitions() {
+			if err := v.AddCRD(crd.Object); err != nil {
+				schemaCheckerErr = fmt.Errorf("failed to load schema of %s in %s: %w", crd.GetName(), crd.Source, err)
+				return
 			}
 		}
-		if !isKustomizationFile(info.Name()) {
-			return nil
+
+		files, err := manifest.IndexFiles(manifestDir, excludeDirs)
+		if err != nil {
+			schemaCheckerErr = err
+			return
+		}
+		schemaCheckerInst = &schemaChecker{
+			validator: v,
+			files:     files,
+			noSchema:  make(map[string]bool),
 		}
-		targets = append(targets, filepath.Dir(path))
-		// Skip other files in the directory
-		return filepath.SkipDir
 	})
+	if schemaCheckerErr != nil {
+		t.Fatal(schemaCheckerErr)
+	}
+	return schemaCheckerInst
+}
+
+func (c *schemaChecker) check(t *testing.T, obj *manifest.Object) {
+	errs, err := c.validator.Validate(obj.Object)
+	if errors.Is(err, schema.ErrNoSchema) {
+		c.mu.Lock()
+		c.noSchema[obj.GetAPIVersion()+" "+obj.GetKind()] = true
+		c.mu.Unlock()
+		return
+	}
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if len(errs) == 0 {
+		return
 	}
 
-	for _, path := range targets {
-		t.Run(path, func(t *testing.T) {
-			stdout, stderr, err := kustomizeBuild(path)
-			if err != nil {
-				t.Errorf("kustomize build failed. path: %s, stderr: %s, err: %v", path, stderr, err)
-			}
+	file := c.files.Find(obj.Source, obj.GetKind(), obj.GetName())
+	if file == "" {
+		file = "(unknown)"
+	}
+	for _, e := range errs {
+		t.Errorf("%s %s/%s: %v (file: %s, kustomization: %s)", obj.GetKind(), obj.GetNamespace(), obj.GetName(), e, file, obj.Source)
+	}
+}
 
-			y := k8sYaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(stdout)))
-			for {
-				data, err := y.Read()
-				if err == io.EOF {
-					break
-				} else if err != nil {
-					t.Error(err)
-				}
+func testSchema(t *testing.T) {
+	t.Parallel()
+
+	c := loadSchemaChecker(t)
+	if c == nil {
+		t.Skip("KUBERNETES_OPENAPI_SPEC envvar is not defined")
+	}
+
+	t.Run("Objects", func(t *testing.T) {
+		doCheckKustomizedYaml(t, c.check)
+	})
 
-				checkFunc(t, data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kinds := make([]string, 0, len(c.noSchema))
+	for k := range c.noSchema {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		t.Logf("no schema for %s", k)
+	}
+}
+
+func doCheckKustomizedYaml(t *testing.T, checkFunc func(*testing.T, *manifest.Object)) {
+	idx := loadManifestIndex(t)
+	for _, source := range idx.Sources() {
+		t.Run(source, func(t *testing.T) {
+			sub := idx.Source(source)
+			if err := sub.Err(source); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, obj := range sub.All() {
+				checkFunc(t, obj)
 			}
 		})
 	}
@@ -388,11 +571,6 @@ type RelabelConfig struct {
 	Replacement string `json:"replacement"`
 }
 
-type resourceMeta struct {
-	metav1.TypeMeta   `json:",inline"`
-	metav1.ObjectMeta `json:"metadata,omitempty"`
-}
-
 // shrinked and merged version of VMServiceScrape, VMPodScrape and VMNodeScrape
 type VMScrapeOrRule struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -409,6 +587,60 @@ type VMScrapeOrRule struct {
 	} `json:"spec"`
 }
 
+// endpointRelabelConfigs returns the relabelConfigs of each endpoint.
+func (r *VMScrapeOrRule) endpointRelabelConfigs() [][]RelabelConfig {
+	var relabelConfigs [][]RelabelConfig
+	switch r.Kind {
+	case "VMServiceScrape":
+		for _, ep := range r.Spec.ServiceScrapeEndpoints {
+			relabelConfigs = append(relabelConfigs, ep.RelabelConfigs)
+		}
+	case "VMPodScrape":
+		for _, ep := range r.Spec.PodScrapeEndpoints {
+			relabelConfigs = append(relabelConfigs, ep.RelabelConfigs)
+		}
+	case "VMNodeScrape":
+		relabelConfigs = append(relabelConfigs, r.Spec.NodeScrapeRelabelConfigs)
+	}
+	return relabelConfigs
+}
+
+// explicitJob returns the job label set explicitly by rcs, or an empty string if not set.
+func explicitJob(rcs []RelabelConfig) string {
+	for _, rc := range rcs {
+		if rc.Action == "" && rc.TargetLabel == "job" && rc.Replacement != "" && !strings.Contains(rc.Replacement, "/") {
+			return rc.Replacement
+		}
+	}
+	return ""
+}
+
+// decodeVMObject decodes the object of kind in the monitoring namespace into v.
+func decodeVMObject(t *testing.T, idx *manifest.Index, kind, name string, v interface{}) {
+	objs := idx.Lookup(kind, "monitoring", name)
+	if len(objs) != 1 {
+		t.Fatalf("failed to get %s %s", kind, name)
+	}
+	if err := objs[0].Decode(v); err != nil {
+		t.Fatalf("failed to decode %s %s: %v", kind, name, err)
+	}
+}
+
+// selectVMObjects returns the sorted names of the objects of kind selected by selector.
+func selectVMObjects(t *testing.T, idx *manifest.Index, kind string, selector *metav1.LabelSelector) []string {
+	selected, err := idx.Select(kind, selector)
+	if err != nil {
+		t.Errorf("cannot convert label selector: %v", err)
+		return nil
+	}
+	names := []string{}
+	for _, r := range selected {
+		names = append(names, r.GetName())
+	}
+	sort.Strings(names)
+	return names
+}
+
 // shrinked version of github.com/VictoriaMetrics/operator/api/v1beta1.VMAgent
 type VMAgent struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -436,42 +668,12 @@ type VMAlert struct {
 }
 
 func testVMCustomResources(t *testing.T) {
-	vmBaseDir := filepath.Join(manifestDir, "monitoring/base/victoriametrics")
-
-	// expected resource names of each CRs which are handled by smallset cluster (must be sorted)
-	expectedSmallsetServiceScrapes := []string{
-		"kube-state-metrics",
-		"kubernetes",
-		"rook",
-		"vmagent-largeset",
-		"vmagent-smallset",
-		"vmalert-largeset",
-		"vmalert-smallset",
-		"vmalertmanager-largeset",
-		"vmalertmanager-smallset",
-		"vminsert-largeset",
-		"vmselect-largeset",
-		"vmsingle-smallset",
-		"vmstorage-largeset",
-	}
-	expectedSmallsetPodScrapes := []string{
-		"topolvm",
-		"victoriametrics-operator",
-	}
-	expectedSmallsetNodeScrapes := []string{
-		"kubernetes-cadvisor",
-		"kubernetes-nodes",
-	}
-	expectedSmallsetProbes := []string{}
-	expectedSmallsetRules := []string{
-		"monitoring",
-		"rook",
-	}
+	vmBaseDir := filepath.Join("monitoring", "base", "victoriametrics")
 
 	// gather CRs in files
 
 	crsInFiles := []string{}
-	err := filepath.Walk("../monitoring/base/victoriametrics/rules", func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(filepath.Join(manifestDir, vmBaseDir, "rules"), func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -479,47 +681,29 @@ func testVMCustomResources(t *testing.T) {
 			return nil
 		}
 
-		file, err := os.Open(path)
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
 			return err
 		}
-		reader := k8sYaml.NewYAMLReader(bufio.NewReader(file))
-		for {
-			data, err := reader.Read()
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return fmt.Errorf("failed to read yaml: %v", err)
-			}
+		objs, err := manifest.Decode(data)
+		if err != nil {
+			return fmt.Errorf("failed to read yaml: %v", err)
+		}
+		for _, obj := range objs {
 			var r VMScrapeOrRule
-			yaml.Unmarshal(data, &r)
-			var relabelConfigs [][]RelabelConfig
+			err := manifest.FromUnstructured(obj, &r)
+			if err != nil {
+				return fmt.Errorf("failed to decode %s %s: %v", obj.GetKind(), obj.GetName(), err)
+			}
 			switch r.Kind {
-			case "VMServiceScrape":
-				for _, ep := range r.Spec.ServiceScrapeEndpoints {
-					relabelConfigs = append(relabelConfigs, ep.RelabelConfigs)
-				}
-			case "VMPodScrape":
-				for _, ep := range r.Spec.PodScrapeEndpoints {
-					relabelConfigs = append(relabelConfigs, ep.RelabelConfigs)
-				}
-			case "VMNodeScrape":
-				relabelConfigs = append(relabelConfigs, r.Spec.NodeScrapeRelabelConfigs)
-			case "VMProbe":
-			case "VMRule":
+			case "VMServiceScrape", "VMPodScrape", "VMNodeScrape", "VMProbe", "VMRule":
 			default:
 				continue
 			}
 			crsInFiles = append(crsInFiles, r.Kind+"/"+r.Name)
 
-			for i, rcs := range relabelConfigs {
-				found := false
-				for _, rc := range rcs {
-					if rc.Action == "" && rc.TargetLabel == "job" && rc.Replacement != "" && !strings.Contains(rc.Replacement, "/") {
-						found = true
-					}
-				}
-				if !found {
+			for i, rcs := range r.endpointRelabelConfigs() {
+				if explicitJob(rcs) == "" {
 					t.Errorf("%s %s endpoint %d should have a relabelConfig that set job label explicitly", r.Kind, r.Name, i)
 				}
 			}
@@ -532,44 +716,13 @@ func testVMCustomResources(t *testing.T) {
 
 	// gather CRs actually applied
 
-	kustomizeResult, err := exec.Command("bin/kustomize", "build", vmBaseDir).Output()
-	if err != nil {
-		t.Fatalf("failed to kustomize build: %v", err)
-	}
+	idx := loadSourceIndex(t, vmBaseDir)
 
-	reader := k8sYaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(kustomizeResult)))
-
-	var serviceScrapes []resourceMeta
-	var podScrapes []resourceMeta
-	var nodeScrapes []resourceMeta
-	var probes []resourceMeta
-	var rules []resourceMeta
 	crsInKBuild := []string{}
-
-	for {
-		data, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			t.Fatalf("failed to read yaml: %v", err)
-		}
-		var r resourceMeta
-		yaml.Unmarshal(data, &r)
-		switch r.Kind {
-		case "VMServiceScrape":
-			serviceScrapes = append(serviceScrapes, r)
-		case "VMPodScrape":
-			podScrapes = append(podScrapes, r)
-		case "VMNodeScrape":
-			nodeScrapes = append(nodeScrapes, r)
-		case "VMProbe":
-			probes = append(probes, r)
-		case "VMRule":
-			rules = append(rules, r)
-		default:
-			continue
+	for _, kind := range []string{"VMServiceScrape", "VMPodScrape", "VMNodeScrape", "VMProbe", "VMRule"} {
+		for _, r := range idx.ByKind(kind) {
+			crsInKBuild = append(crsInKBuild, r.GetKind()+"/"+r.GetName())
 		}
-		crsInKBuild = append(crsInKBuild, r.Kind+"/"+r.Name)
 	}
 
 	sort.Strings(crsInFiles)
@@ -578,142 +731,59 @@ func testVMCustomResources(t *testing.T) {
 		t.Errorf("some CRs mismatch: actual=%v, expected=%v", crsInFiles, crsInKBuild)
 	}
 
-	// read VMAgent/VMAlert CRs (their label selectors)
+	// select CRs by the label selectors of VMAgent/VMAlert CRs and compare the results with the golden file
 
-	file, err := os.Open(filepath.Join(vmBaseDir, "vmagent-smallset.yaml"))
-	if err != nil {
-		t.Fatalf("failed open vmagent-smallset.yaml: %v", err)
-	}
-	defer file.Close()
-	reader = k8sYaml.NewYAMLReader(bufio.NewReader(file))
-	var smallsetVMAgent *VMAgent
-	for {
-		data, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			t.Fatalf("failed to read yaml: %v", err)
-		}
+	selections := make(map[string]map[string][]string)
+	for _, name := range []string{"vmagent-largeset", "vmagent-smallset"} {
 		var r VMAgent
-		err = yaml.Unmarshal(data, &r)
-		if err != nil {
-			continue
+		decodeVMObject(t, idx, "VMAgent", name, &r)
+		if r.Spec.ServiceScrapeNamespaceSelector != nil ||
+			r.Spec.PodScrapeNamespaceSelector != nil ||
+			r.Spec.NodeScrapeNamespaceSelector != nil ||
+			r.Spec.ProbeNamespaceSelector != nil {
+			t.Errorf("%s: bad namespace selector", name)
 		}
-		if r.Kind == "VMAgent" && r.Name == "vmagent-smallset" {
-			smallsetVMAgent = &r
-			break
+		selections[name] = map[string][]string{
+			"VMServiceScrape": selectVMObjects(t, idx, "VMServiceScrape", r.Spec.ServiceScrapeSelector),
+			"VMPodScrape":     selectVMObjects(t, idx, "VMPodScrape", r.Spec.PodScrapeSelector),
+			"VMNodeScrape":    selectVMObjects(t, idx, "VMNodeScrape", r.Spec.NodeScrapeSelector),
+			"VMProbe":         selectVMObjects(t, idx, "VMProbe", r.Spec.ProbeSelector),
 		}
 	}
-	if smallsetVMAgent == nil {
-		t.Fatalf("failed to get vmagent-smallset")
-	}
-
-	file, err = os.Open(filepath.Join(vmBaseDir, "vmalert-smallset.yaml"))
-	if err != nil {
-		t.Fatalf("failed open vmalert-smallset.yaml: %v", err)
-	}
-	defer file.Close()
-	reader = k8sYaml.NewYAMLReader(bufio.NewReader(file))
-	var smallsetVMAlert *VMAlert
-	for {
-		data, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			t.Fatalf("failed to read yaml: %v", err)
-		}
+	for _, name := range []string{"vmalert-largeset", "vmalert-smallset"} {
 		var r VMAlert
-		err = yaml.Unmarshal(data, &r)
-		if err != nil {
-			continue
+		decodeVMObject(t, idx, "VMAlert", name, &r)
+		if r.Spec.RuleNamespaceSelector != nil {
+			t.Errorf("%s: bad namespace selector", name)
 		}
-		if r.Kind == "VMAlert" && r.Name == "vmalert-smallset" {
-			smallsetVMAlert = &r
-			break
-		}
-	}
-	if smallsetVMAlert == nil {
-		t.Fatalf("failed to get vmalert-smallset")
-	}
-
-	// check namespace label selectors
-	if smallsetVMAgent.Spec.ServiceScrapeNamespaceSelector != nil ||
-		smallsetVMAgent.Spec.PodScrapeNamespaceSelector != nil ||
-		smallsetVMAgent.Spec.NodeScrapeNamespaceSelector != nil ||
-		smallsetVMAgent.Spec.ProbeNamespaceSelector != nil ||
-		smallsetVMAlert.Spec.RuleNamespaceSelector != nil {
-		t.Errorf("bad namespace selector")
-	}
-
-	// filter CRs by label selectors and check the results
-
-	selections := []struct {
-		Name     string
-		Selector *metav1.LabelSelector
-		Objects  []resourceMeta
-		Expected []string
-	}{
-		{
-			Name:     "VMServiceScrape",
-			Selector: smallsetVMAgent.Spec.ServiceScrapeSelector,
-			Objects:  serviceScrapes,
-			Expected: expectedSmallsetServiceScrapes,
-		},
-		{
-			Name:     "VMPodScrape",
-			Selector: smallsetVMAgent.Spec.PodScrapeSelector,
-			Objects:  podScrapes,
-			Expected: expectedSmallsetPodScrapes,
-		},
-		{
-			Name:     "VMNodeScrape",
-			Selector: smallsetVMAgent.Spec.NodeScrapeSelector,
-			Objects:  nodeScrapes,
-			Expected: expectedSmallsetNodeScrapes,
-		},
-		{
-			Name:     "VMProbe",
-			Selector: smallsetVMAgent.Spec.ProbeSelector,
-			Objects:  probes,
-			Expected: expectedSmallsetProbes,
-		},
-		{
-			Name:     "VMRule",
-			Selector: smallsetVMAlert.Spec.RuleSelector,
-			Objects:  rules,
-			Expected: expectedSmallsetRules,
-		},
-	}
-
-	for _, selection := range selections {
-		actual := []string{}
-		selector, err := metav1.LabelSelectorAsSelector(selection.Selector)
-		if err != nil {
-			t.Errorf("cannot convert label selector: %v", err)
-			continue
-		}
-		for _, r := range selection.Objects {
-			if selector.Matches(labels.Set(r.Labels)) {
-				actual = append(actual, r.Name)
-			}
-		}
-		sort.Strings(actual)
-		if !reflect.DeepEqual(actual, selection.Expected) {
-			t.Errorf("smallset %s mismatch: actual=%v, expected=%v", selection.Name, actual, selection.Expected)
-			continue
+		selections[name] = map[string][]string{
+			"VMRule": selectVMObjects(t, idx, "VMRule", r.Spec.RuleSelector),
 		}
 	}
+	checkGolden(t, vmSelectionGolden, selections)
 }
 
 func TestValidation(t *testing.T) {
-	if os.Getenv("SSH_PRIVKEY") != "" {
+	if cfg.SSHPrivKey != "" {
 		t.Skip("SSH_PRIVKEY envvar is defined as running e2e test")
 	}
 
+	t.Run("AlertRuleCoverage", testAlertRuleCoverage)
+	t.Run("AlertRuleJobs", testAlertRuleJobs)
+	t.Run("AlertRuleLint", testAlertRuleLint)
 	t.Run("AppProjectNamespaces", testAppProjectResources)
 	t.Run("ApplicationTargetRevision", testApplicationResources)
 	t.Run("CRDStatus", testCRDStatus)
 	t.Run("CertificateUsages", testCertificateUsages)
+	t.Run("CrossReferences", testCrossReferences)
 	t.Run("NamespaceLabels", testNamespaceResources)
+	t.Run("NetworkPolicies", testNetworkPolicySimulation)
+	t.Run("GrafanaDashboards", testGrafanaDashboardContents)
+	t.Run("Images", testImages)
+	t.Run("Overlays", testOverlays)
+	t.Run("Schema", testSchema)
+	t.Run("SyncWaves", testSyncWaves)
+	t.Run("TeamPermissions", testTeamPermissions)
 	t.Run("VictoriaMetricsCustomResources", testVMCustomResources)
+	t.Run("WorkloadPolicy", testWorkloadPolicy)
 }
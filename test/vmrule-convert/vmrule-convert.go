@@ -1,54 +1,72 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
-	"io"
 	"os"
 
-	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"github.com/cybozu-go/neco-apps/test/vmrule"
 	"sigs.k8s.io/yaml"
 )
 
-type VMRule struct {
-	Spec struct {
-		Groups []interface{} `json:"groups"`
-	} `json:"spec"`
-}
+var outDir = flag.String("o", "", "output directory for the converted rule files")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  %[1]s -o OUTDIR DIR   convert each VMRule file in DIR into OUTDIR
+  %[1]s < FILE          convert VMRules read from stdin and write them to stdout
 
-type Rules struct {
-	Groups []interface{} `json:"groups"`
+`, os.Args[0])
+	flag.PrintDefaults()
 }
 
 func main() {
-	reader := k8syaml.NewYAMLReader(bufio.NewReader(os.Stdin))
-
-	var outRules Rules
+	flag.Usage = usage
+	flag.Parse()
 
-	for {
-		data, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			fmt.Fprintf(os.Stderr, "Read failed: %v\n", err)
-			os.Exit(1)
-		}
-
-		var rule VMRule
-		err = yaml.Unmarshal(data, &rule)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Unmarshal failed: %v\n", err)
-			os.Exit(1)
-		}
+	var err error
+	switch {
+	case flag.NArg() == 1 && *outDir != "":
+		err = convertDir(flag.Arg(0), *outDir)
+	case flag.NArg() == 0 && *outDir == "":
+		err = convertStdin()
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-		outRules.Groups = append(outRules.Groups, rule.Spec.Groups...)
+func convertDir(dir, out string) error {
+	rules, err := vmrule.LoadDir(dir)
+	if err != nil {
+		return fmt.Errorf("load failed: %w", err)
+	}
+	if err := vmrule.Validate(rules); err != nil {
+		return fmt.Errorf("validation failed:\n%w", err)
 	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	return vmrule.WriteDir(out, rules)
+}
 
-	b, err := yaml.Marshal(outRules)
+func convertStdin() error {
+	rules, err := vmrule.Load(os.Stdin, "<stdin>")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Marshal failed: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("load failed: %w", err)
+	}
+	if err := vmrule.Validate(rules); err != nil {
+		return fmt.Errorf("validation failed:\n%w", err)
 	}
 
-	fmt.Printf("%s", b)
+	b, err := yaml.Marshal(vmrule.Convert(rules))
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	_, err = os.Stdout.Write(b)
+	return err
 }
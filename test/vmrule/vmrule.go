@@ -0,0 +1,305 @@
+// Package vmrule loads VMRule manifests, validates them, and converts them into Prometheus rule files
+// so that the rules can be tested with promtool.
+package vmrule
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// Rule is an alerting or recording rule.
+type Rule struct {
+	Record      string            `json:"record,omitempty"`
+	Alert       string            `json:"alert,omitempty"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Name returns the name of the alert or the recorded metric.
+func (r *Rule) Name() string {
+	if r.Alert != "" {
+		return r.Alert
+	}
+	return r.Record
+}
+
+// Group is a rule group.
+type Group struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval,omitempty"`
+	Rules    []Rule `json:"rules"`
+}
+
+// VMRule is a VMRule object read from a manifest file.
+type VMRule struct {
+	// Source is the path of the file that defines this VMRule.
+	Source    string            `json:"source"`
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Groups    []Group           `json:"groups"`
+}
+
+// RuleFile is the content of a Prometheus rule file.
+type RuleFile struct {
+	Groups []Group `json:"groups"`
+}
+
+type vmRuleObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Groups []Group `json:"groups"`
+	} `json:"spec"`
+}
+
+// Load reads VMRules from a YAML stream r.  Objects of other kinds are ignored.
+// source is recorded in the returned VMRules to trace errors back to the file.
+func Load(r io.Reader, source string) ([]*VMRule, error) {
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(r))
+
+	var rules []*VMRule
+	for {
+		data, err := reader.Read()
+		if err == io.EOF {
+			return rules, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+
+		var tm metav1.TypeMeta
+		if err := yaml.Unmarshal(data, &tm); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		if tm.Kind != "VMRule" {
+			continue
+		}
+
+		// Unknown fields are rejected because they would be silently dropped by the conversion.
+		var obj vmRuleObject
+		if err := yaml.UnmarshalStrict(data, &obj); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		rules = append(rules, &VMRule{
+			Source:    source,
+			Name:      obj.Name,
+			Namespace: obj.Namespace,
+			Labels:    obj.Labels,
+			Groups:    obj.Spec.Groups,
+		})
+	}
+}
+
+// LoadFile reads VMRules from the file at path.
+func LoadFile(path string) ([]*VMRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f, path)
+}
+
+// LoadDir reads VMRules from the YAML files directly under dir.
+func LoadDir(dir string) ([]*VMRule, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var rules []*VMRule
+	for _, file := range files {
+		rs, err := LoadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rs...)
+	}
+	return rules, nil
+}
+
+// Error is a problem in a rule.
+type Error struct {
+	Source string
+	Group  string
+	Rule   string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Source)
+	if e.Group != "" {
+		fmt.Fprintf(&sb, ": group %q", e.Group)
+	}
+	if e.Rule != "" {
+		fmt.Fprintf(&sb, ": rule %q", e.Rule)
+	}
+	fmt.Fprintf(&sb, ": %v", e.Err)
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors is the list of problems found by Validate.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate checks that group names are unique, that each rule is either an alert or a recording rule,
+// and that each expression is a valid PromQL expression.
+// All problems are returned as Errors.
+func Validate(rules []*VMRule) error {
+	var errs Errors
+	groups := make(map[string]string)
+	for _, vr := range rules {
+		for _, g := range vr.Groups {
+			if g.Name == "" {
+				errs = append(errs, &Error{Source: vr.Source, Err: errors.New("group name is empty")})
+			} else if src, ok := groups[g.Name]; ok {
+				errs = append(errs, &Error{Source: vr.Source, Group: g.Name, Err: fmt.Errorf("duplicate group name; also defined in %s", src)})
+			} else {
+				groups[g.Name] = vr.Source
+			}
+
+			for i, r := range g.Rules {
+				name := r.Name()
+				if name == "" {
+					name = fmt.Sprintf("#%d", i)
+				}
+				newErr := func(err error) *Error {
+					return &Error{Source: vr.Source, Group: g.Name, Rule: name, Err: err}
+				}
+
+				switch {
+				case r.Alert == "" && r.Record == "":
+					errs = append(errs, newErr(errors.New("neither alert nor record is set")))
+				case r.Alert != "" && r.Record != "":
+					errs = append(errs, newErr(errors.New("both alert and record are set")))
+				}
+				if strings.TrimSpace(r.Expr) == "" {
+					errs = append(errs, newErr(errors.New("expr is empty")))
+					continue
+				}
+				if _, err := parser.ParseExpr(r.Expr); err != nil {
+					errs = append(errs, newErr(fmt.Errorf("invalid expr: %w", err)))
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Convert concatenates the groups of rules into a Prometheus rule file.
+func Convert(rules []*VMRule) *RuleFile {
+	rf := &RuleFile{Groups: []Group{}}
+	for _, vr := range rules {
+		rf.Groups = append(rf.Groups, vr.Groups...)
+	}
+	return rf
+}
+
+// Select returns the VMRules that match selector, e.g. spec.ruleSelector of VMAlert.
+func Select(rules []*VMRule, selector *metav1.LabelSelector) ([]*VMRule, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	var selected []*VMRule
+	for _, vr := range rules {
+		if sel.Matches(labels.Set(vr.Labels)) {
+			selected = append(selected, vr)
+		}
+	}
+	return selected, nil
+}
+
+// IndexFile is the name of the file written by WriteDir to describe the converted VMRules.
+const IndexFile = "index.yaml"
+
+// WriteDir writes the rule file for each source file of rules into dir with the same base name.
+// It also writes IndexFile, the list of rules without their groups' rules,
+// so that the metadata such as labels can be used by tests.
+func WriteDir(dir string, rules []*VMRule) error {
+	bySource := make(map[string][]*VMRule)
+	var sources []string
+	for _, vr := range rules {
+		if _, ok := bySource[vr.Source]; !ok {
+			sources = append(sources, vr.Source)
+		}
+		bySource[vr.Source] = append(bySource[vr.Source], vr)
+	}
+
+	written := make(map[string]string)
+	for _, src := range sources {
+		name := filepath.Base(src)
+		if name == IndexFile {
+			return fmt.Errorf("%s: the file name is reserved", src)
+		}
+		if other, ok := written[name]; ok {
+			return fmt.Errorf("%s and %s have the same file name", other, src)
+		}
+		written[name] = src
+
+		data, err := yaml.Marshal(Convert(bySource[src]))
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return err
+		}
+	}
+
+	type indexEntry struct {
+		VMRule
+		File   string   `json:"file"`
+		Groups []string `json:"groups"`
+	}
+	index := make([]indexEntry, len(rules))
+	for i, vr := range rules {
+		e := indexEntry{VMRule: *vr, File: filepath.Base(vr.Source)}
+		e.VMRule.Groups = nil
+		for _, g := range vr.Groups {
+			e.Groups = append(e.Groups, g.Name)
+		}
+		index[i] = e
+	}
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, IndexFile), data, 0644)
+}
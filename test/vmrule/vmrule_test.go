@@ -0,0 +1,149 @@
+package vmrule
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const testRules = `apiVersion: operator.victoriametrics.com/v1beta1
+kind: VMRule
+metadata:
+  name: foo
+  labels:
+    smallset: "true"
+spec:
+  groups:
+    - name: foo
+      rules:
+        - alert: FooDown
+          expr: absent(up{job="foo"} == 1)
+          for: 10m
+          labels:
+            severity: error
+---
+apiVersion: operator.victoriametrics.com/v1beta1
+kind: VMServiceScrape
+metadata:
+  name: foo
+spec:
+  endpoints: []
+---
+apiVersion: operator.victoriametrics.com/v1beta1
+kind: VMRule
+metadata:
+  name: foo-record
+spec:
+  groups:
+    - name: foo-record
+      rules:
+        - record: foo:up:sum
+          expr: sum(up{job="foo"})
+`
+
+func TestLoadAndConvert(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foo-alertrule.yaml")
+	if err := ioutil.WriteFile(src, []byte(testRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("unexpected number of VMRules: %d", len(rules))
+	}
+	if err := Validate(rules); err != nil {
+		t.Error(err)
+	}
+
+	smallset, err := Select(rules, &metav1.LabelSelector{MatchLabels: map[string]string{"smallset": "true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(smallset) != 1 || smallset[0].Name != "foo" || smallset[0].Source != src {
+		t.Errorf("unexpected smallset rules: %#v", smallset)
+	}
+
+	out := t.TempDir()
+	if err := WriteDir(out, rules); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(out, "foo-alertrule.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RuleFile
+	if err := yaml.UnmarshalStrict(data, &rf); err != nil {
+		t.Fatal(err)
+	}
+	expected := RuleFile{Groups: []Group{rules[0].Groups[0], rules[1].Groups[0]}}
+	if !cmp.Equal(rf, expected) {
+		t.Error(cmp.Diff(expected, rf))
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(out, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index []map[string]interface{}
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 2 || index[0]["file"] != "foo-alertrule.yaml" || !cmp.Equal(index[0]["groups"], []interface{}{"foo"}) {
+		t.Errorf("unexpected index: %s", data)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rules := []*VMRule{
+		{
+			Source: "a.yaml",
+			Groups: []Group{
+				{Name: "dup", Rules: []Rule{{Alert: "A", Expr: "up == 0"}}},
+				{Name: "bad", Rules: []Rule{
+					{Expr: "up"},
+					{Alert: "B", Record: "b", Expr: "up"},
+					{Alert: "C", Expr: "sum(up"},
+					{Record: "d"},
+				}},
+			},
+		},
+		{
+			Source: "b.yaml",
+			Groups: []Group{{Name: "dup", Rules: []Rule{{Alert: "E", Expr: "up == 0"}}}},
+		},
+	}
+
+	err := Validate(rules)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	expected := []string{
+		`a.yaml: group "bad": rule "#0": neither alert nor record is set`,
+		`a.yaml: group "bad": rule "B": both alert and record are set`,
+		`a.yaml: group "bad": rule "C": invalid expr: `,
+		`a.yaml: group "bad": rule "d": expr is empty`,
+		`b.yaml: group "dup": duplicate group name; also defined in a.yaml`,
+	}
+	if len(msgs) != len(expected) {
+		t.Fatalf("unexpected errors:\n%s", err)
+	}
+	for i := range expected {
+		if !strings.HasPrefix(msgs[i], expected[i]) {
+			t.Errorf("expected %q, actual %q", expected[i], msgs[i])
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/neco-apps/test/manifest"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// workloadRule is a rule of the workload policy.
+type workloadRule string
+
+const (
+	ruleRunAsNonRoot           = workloadRule("runAsNonRoot")
+	ruleReadOnlyRootFilesystem = workloadRule("readOnlyRootFilesystem")
+	ruleDropCapabilities       = workloadRule("dropCapabilities")
+	ruleResourceRequests       = workloadRule("resourceRequests")
+	ruleHostNetwork            = workloadRule("hostNetwork")
+	ruleHostPath               = workloadRule("hostPath")
+)
+
+// workloadExemption exempts a workload from rules.
+type workloadExemption struct {
+	App  string
+	Kind string
+	Name string
+	// Container is the name of the exempted container.  Empty means the pod, and is only for
+	// the pod-level rules, hostNetwork and hostPath.
+	Container string
+	Rules     []workloadRule
+	Reason    string
+}
+
+func (e *workloadExemption) matches(app string, obj *manifest.Object, container string, rule workloadRule) bool {
+	if e.App != app || e.Kind != obj.GetKind() || e.Name != obj.GetName() {
+		return false
+	}
+	if e.Container != "" && e.Container != container {
+		return false
+	}
+	return containsRule(e.Rules, rule)
+}
+
+// workloadPolicy is the security and resource policy of the workloads.
+type workloadPolicy struct {
+	// Enforced is the rules whose violations fail the test.
+	Enforced []workloadRule
+	// Reported is the rules whose violations are only logged.
+	// Move a rule to Enforced when its violations are fixed or exempted.
+	Reported   []workloadRule
+	Exemptions []workloadExemption
+}
+
+var defaultWorkloadPolicy = workloadPolicy{
+	Enforced: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests, ruleHostNetwork, ruleHostPath},
+	Reported: []workloadRule{ruleReadOnlyRootFilesystem},
+	Exemptions: []workloadExemption{
+		{App: "network-policy", Kind: "DaemonSet", Name: "calico-node", Rules: []workloadRule{ruleHostNetwork, ruleHostPath},
+			Reason: "calico-node configures the network of the node"},
+		{App: "network-policy", Kind: "DaemonSet", Name: "calico-node", Container: "calico-node", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "calico-node configures the network of the node"},
+		{App: "network-policy", Kind: "DaemonSet", Name: "calico-node", Container: "calico-node", Rules: []workloadRule{ruleResourceRequests},
+			Reason: "the upstream manifest of Calico sets no resource requests for calico-node"},
+		{App: "network-policy", Kind: "Deployment", Name: "calico-typha", Rules: []workloadRule{ruleHostNetwork},
+			Reason: "calico-node connects to typha before the pod network is ready"},
+		{App: "metallb", Kind: "DaemonSet", Name: "speaker", Rules: []workloadRule{ruleHostNetwork},
+			Reason: "speaker advertises the addresses of the node via BGP"},
+		{App: "metallb", Kind: "DaemonSet", Name: "speaker", Container: "speaker", Rules: []workloadRule{ruleRunAsNonRoot},
+			Reason: "speaker advertises the addresses of the node via BGP"},
+		{App: "metallb", Kind: "DaemonSet", Name: "speaker", Container: "speaker", Rules: []workloadRule{ruleResourceRequests},
+			Reason: "the upstream manifest of MetalLB sets no resource requests"},
+		{App: "monitoring", Kind: "CronJob", Name: "machines-endpoints-cronjob", Rules: []workloadRule{ruleHostNetwork},
+			Reason: "machines-endpoints reads sabakan on the boot servers"},
+		{App: "bmc-reverse-proxy", Kind: "CronJob", Name: "machines-endpoints-cronjob", Rules: []workloadRule{ruleHostNetwork},
+			Reason: "machines-endpoints reads sabakan on the boot servers"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "topolvm-scheduler", Rules: []workloadRule{ruleHostNetwork},
+			Reason: "kube-scheduler calls the scheduler extender on the control plane nodes"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "node", Rules: []workloadRule{ruleHostPath},
+			Reason: "the CSI node plugin creates logical volumes and mounts them for kubelet"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "node", Container: "topolvm-node", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "the CSI node plugin creates logical volumes and mounts them for kubelet"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "node", Container: "csi-registrar", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "the manifests of TopoLVM set no security context for the CSI sidecars"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "node", Container: "liveness-probe", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "the manifests of TopoLVM set no security context for the CSI sidecars"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "node", Container: "csi-registrar", Rules: []workloadRule{ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no resource requests"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "node", Container: "liveness-probe", Rules: []workloadRule{ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no resource requests"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "node", Container: "topolvm-node", Rules: []workloadRule{ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no resource requests"},
+		{App: "logging", Kind: "DaemonSet", Name: "logging-promtail", Rules: []workloadRule{ruleHostPath},
+			Reason: "promtail reads the journal and the container logs of the node"},
+		{App: "logging", Kind: "DaemonSet", Name: "logging-promtail", Container: "promtail", Rules: []workloadRule{ruleRunAsNonRoot},
+			Reason: "promtail reads the journal and the container logs of the node"},
+		{App: "logging", Kind: "DaemonSet", Name: "logging-promtail", Container: "promtail", Rules: []workloadRule{ruleResourceRequests},
+			Reason: "the upstream manifest of promtail sets no resource requests"},
+		{App: "local-pv-provisioner", Kind: "DaemonSet", Name: "local-pv-provisioner", Rules: []workloadRule{ruleHostPath},
+			Reason: "local-pv-provisioner creates PersistentVolumes for the devices of the node and cleans them up"},
+		{App: "local-pv-provisioner", Kind: "DaemonSet", Name: "local-pv-provisioner", Container: "local-pv-provisioner", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "local-pv-provisioner creates PersistentVolumes for the devices of the node and cleans them up"},
+		{App: "local-pv-provisioner", Kind: "DaemonSet", Name: "local-pv-provisioner", Container: "local-pv-provisioner", Rules: []workloadRule{ruleResourceRequests},
+			Reason: "local-pv-provisioner has no resource requests yet"},
+		{App: "customer-egress", Kind: "Deployment", Name: "squid", Container: "squid", Rules: []workloadRule{ruleRunAsNonRoot, ruleResourceRequests},
+			Reason: "squid has no runAsNonRoot or resource requests settings yet"},
+		{App: "customer-egress", Kind: "Deployment", Name: "squid", Container: "unbound", Rules: []workloadRule{ruleRunAsNonRoot},
+			Reason: "unbound has no runAsNonRoot setting yet"},
+
+		{App: "argocd", Kind: "Deployment", Name: "argocd-dex-server", Container: "copyutil", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Argo CD set no security context or resource requests"},
+		{App: "argocd", Kind: "Deployment", Name: "argocd-dex-server", Container: "dex", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Argo CD set no security context or resource requests"},
+		{App: "argocd", Kind: "Deployment", Name: "argocd-redis", Container: "redis", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Argo CD set no security context or resource requests"},
+		{App: "argocd", Kind: "Deployment", Name: "argocd-repo-server", Container: "argocd-repo-server", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Argo CD set no security context or resource requests"},
+		{App: "argocd", Kind: "Deployment", Name: "argocd-server", Container: "argocd-server", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Argo CD set no security context or resource requests"},
+		{App: "argocd", Kind: "StatefulSet", Name: "argocd-application-controller", Container: "argocd-application-controller", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Argo CD set no security context or resource requests"},
+		{App: "bmc-reverse-proxy", Kind: "CronJob", Name: "machines-endpoints-cronjob", Container: "machines-endpoints", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "machines-endpoints has no security context or resource requests yet"},
+		{App: "bmc-reverse-proxy", Kind: "Deployment", Name: "bmc-reverse-proxy", Container: "bmc-reverse-proxy", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "bmc-reverse-proxy has no security context or resource requests yet"},
+		{App: "cert-manager", Kind: "Deployment", Name: "cert-manager", Container: "cert-manager", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of cert-manager set no security context or resource requests"},
+		{App: "cert-manager", Kind: "Deployment", Name: "cert-manager-cainjector", Container: "cert-manager", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of cert-manager set no security context or resource requests"},
+		{App: "cert-manager", Kind: "Deployment", Name: "cert-manager-webhook", Container: "cert-manager", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of cert-manager set no security context or resource requests"},
+		{App: "elastic", Kind: "StatefulSet", Name: "elastic-operator", Container: "manager", Rules: []workloadRule{ruleDropCapabilities},
+			Reason: "the upstream manifest of ECK does not drop capabilities"},
+		{App: "external-dns", Kind: "Deployment", Name: "external-dns", Container: "external-dns", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "external-dns has no security context or resource requests yet"},
+		{App: "ingress", Kind: "Deployment", Name: "contour", Container: "contour", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Contour set no security context or resource requests"},
+		{App: "ingress", Kind: "Deployment", Name: "contour", Container: "contour-plus", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Contour set no security context or resource requests"},
+		{App: "ingress", Kind: "Deployment", Name: "envoy", Container: "envoy", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Contour set no security context or resource requests"},
+		{App: "ingress", Kind: "Deployment", Name: "envoy", Container: "envoy-initconfig", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Contour set no security context or resource requests"},
+		{App: "ingress", Kind: "Deployment", Name: "envoy", Container: "liveness-probe", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Contour set no security context or resource requests"},
+		{App: "ingress", Kind: "Deployment", Name: "envoy", Container: "shutdown-manager", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifests of Contour set no security context or resource requests"},
+		{App: "kube-metrics-adapter", Kind: "Deployment", Name: "kube-metrics-adapter", Container: "kube-metrics-adapter", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "kube-metrics-adapter has no security context yet"},
+		{App: "logging", Kind: "StatefulSet", Name: "logging-loki", Container: "loki", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "Loki has no capabilities or resource requests settings yet"},
+		{App: "metallb", Kind: "Deployment", Name: "controller", Container: "controller", Rules: []workloadRule{ruleResourceRequests},
+			Reason: "the upstream manifest of MetalLB sets no resource requests"},
+		{App: "moco", Kind: "Deployment", Name: "moco-controller-manager", Container: "manager", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the manifests of MOCO set no security context or resource requests"},
+		{App: "monitoring", Kind: "CronJob", Name: "machines-endpoints-cronjob", Container: "machines-endpoints", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "machines-endpoints has no security context or resource requests yet"},
+		{App: "monitoring", Kind: "Deployment", Name: "grafana-operator", Container: "grafana-operator", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifest of grafana-operator sets no security context or resource requests"},
+		{App: "monitoring", Kind: "Deployment", Name: "heartbeat", Container: "heartbeat", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "heartbeat has no security context yet"},
+		{App: "monitoring", Kind: "Deployment", Name: "ingress-health", Container: "ingress-health", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "ingress-health has no security context or resource requests yet"},
+		{App: "monitoring", Kind: "Deployment", Name: "kube-state-metrics", Container: "kube-state-metrics", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "kube-state-metrics has no capabilities or resource requests settings yet"},
+		{App: "monitoring", Kind: "Deployment", Name: "pushgateway", Container: "pushgateway", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "pushgateway has no security context or resource requests yet"},
+		{App: "monitoring", Kind: "Deployment", Name: "victoriametrics-operator", Container: "manager", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "the upstream manifest of VictoriaMetrics operator sets no security context"},
+		{App: "neco-admission", Kind: "Deployment", Name: "neco-admission", Container: "neco-admission", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "neco-admission has no security context yet"},
+		{App: "network-policy", Kind: "Deployment", Name: "calico-typha", Container: "calico-typha", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifest of Calico sets no capabilities or resource requests for typha"},
+		{App: "pvc-autoresizer", Kind: "Deployment", Name: "pvc-autoresizer-controller", Container: "manager", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "the manifests of pvc-autoresizer set no security context"},
+		{App: "rook", Kind: "Deployment", Name: "rook-ceph-operator", Container: "rook-ceph-operator", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities},
+			Reason: "the upstream manifest of Rook sets no security context"},
+		{App: "rook", Kind: "Deployment", Name: "rook-ceph-tools", Container: "rook-ceph-tools", Rules: []workloadRule{ruleRunAsNonRoot, ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream toolbox manifest of Rook sets no security context or resource requests"},
+		{App: "sandbox", Kind: "StatefulSet", Name: "grafana", Container: "grafana", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "Grafana in sandbox is for experiments and has no capabilities or resource requests settings"},
+		{App: "sealed-secrets", Kind: "Deployment", Name: "sealed-secrets-controller", Container: "sealed-secrets-controller", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the upstream manifest of sealed-secrets sets no capabilities or resource requests"},
+		{App: "teleport", Kind: "Deployment", Name: "teleport-app-vmalertmanager-largeset", Container: "teleport-app-vmalertmanager-largeset", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "Teleport has no capabilities or resource requests settings yet"},
+		{App: "teleport", Kind: "Deployment", Name: "teleport-app-vmalertmanager-smallset", Container: "teleport-app-vmalertmanager-smallset", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "Teleport has no capabilities or resource requests settings yet"},
+		{App: "teleport", Kind: "Deployment", Name: "teleport-proxy", Container: "teleport-proxy", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "Teleport has no capabilities or resource requests settings yet"},
+		{App: "teleport", Kind: "StatefulSet", Name: "teleport-auth", Container: "teleport-auth", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "Teleport has no capabilities or resource requests settings yet"},
+		{App: "topolvm", Kind: "DaemonSet", Name: "topolvm-scheduler", Container: "topolvm-scheduler", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no capabilities or resource requests"},
+		{App: "topolvm", Kind: "Deployment", Name: "controller", Container: "csi-attacher", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no capabilities or resource requests"},
+		{App: "topolvm", Kind: "Deployment", Name: "controller", Container: "csi-provisioner", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no capabilities or resource requests"},
+		{App: "topolvm", Kind: "Deployment", Name: "controller", Container: "csi-resizer", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no capabilities or resource requests"},
+		{App: "topolvm", Kind: "Deployment", Name: "controller", Container: "liveness-probe", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no capabilities or resource requests"},
+		{App: "topolvm", Kind: "Deployment", Name: "controller", Container: "topolvm-controller", Rules: []workloadRule{ruleDropCapabilities, ruleResourceRequests},
+			Reason: "the manifests of TopoLVM set no capabilities or resource requests"},
+	},
+}
+
+// workloadViolation is a violation of a rule.
+type workloadViolation struct {
+	Rule      workloadRule
+	Container string
+	Message   string
+}
+
+// podSpecOf returns the pod spec of obj, or nil if obj is not a workload.
+func podSpecOf(obj *manifest.Object) (*corev1.PodSpec, error) {
+	var path []string
+	switch obj.GetKind() {
+	case "Pod":
+		path = []string{"spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		path = []string{"spec", "template", "spec"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		return nil, nil
+	}
+	m, found, err := unstructured.NestedMap(obj.Object, path...)
+	if err != nil || !found {
+		return nil, fmt.Errorf("%s %s/%s has no pod spec: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	spec := new(corev1.PodSpec)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, spec); err != nil {
+		return nil, fmt.Errorf("%s %s/%s: %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	return spec, nil
+}
+
+// checkPodSpec returns the violations of spec against all rules.
+func checkPodSpec(spec *corev1.PodSpec) []workloadViolation {
+	var violations []workloadViolation
+	if spec.HostNetwork {
+		violations = append(violations, workloadViolation{Rule: ruleHostNetwork, Message: "uses hostNetwork"})
+	}
+	for _, v := range spec.Volumes {
+		if v.HostPath != nil {
+			violations = append(violations, workloadViolation{Rule: ruleHostPath, Message: fmt.Sprintf("volume %s uses hostPath %s", v.Name, v.HostPath.Path)})
+		}
+	}
+
+	podNonRoot := false
+	if sc := spec.SecurityContext; sc != nil {
+		podNonRoot = (sc.RunAsNonRoot != nil && *sc.RunAsNonRoot) || (sc.RunAsUser != nil && *sc.RunAsUser != 0)
+	}
+
+	containers := append(append([]corev1.Container(nil), spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		add := func(rule workloadRule, msg string) {
+			violations = append(violations, workloadViolation{Rule: rule, Container: c.Name, Message: fmt.Sprintf("container %s %s", c.Name, msg)})
+		}
+
+		sc := c.SecurityContext
+		if sc == nil {
+			sc = &corev1.SecurityContext{}
+		}
+		switch {
+		case sc.RunAsUser != nil && *sc.RunAsUser == 0:
+			add(ruleRunAsNonRoot, "runs as root")
+		case sc.RunAsNonRoot != nil && !*sc.RunAsNonRoot:
+			add(ruleRunAsNonRoot, "sets runAsNonRoot to false")
+		case !podNonRoot && (sc.RunAsNonRoot == nil || !*sc.RunAsNonRoot) && sc.RunAsUser == nil:
+			add(ruleRunAsNonRoot, "does not set runAsNonRoot or runAsUser")
+		}
+		if sc.ReadOnlyRootFilesystem == nil || !*sc.ReadOnlyRootFilesystem {
+			add(ruleReadOnlyRootFilesystem, "does not set readOnlyRootFilesystem")
+		}
+		dropAll := false
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Drop {
+				if strings.EqualFold(string(capability), "ALL") {
+					dropAll = true
+				}
+			}
+		}
+		if !dropAll {
+			add(ruleDropCapabilities, "does not drop ALL capabilities")
+		}
+		for _, r := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if _, ok := c.Resources.Requests[r]; !ok {
+				add(ruleResourceRequests, fmt.Sprintf("has no %s request", r))
+			}
+		}
+	}
+	return violations
+}
+
+func containsRule(rules []workloadRule, rule workloadRule) bool {
+	for _, r := range rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// testWorkloadPolicy checks the workloads of the applications deployed to each cluster against defaultWorkloadPolicy.
+// Violations are reported per overlay and application.
+func testWorkloadPolicy(t *testing.T) {
+	overlays, err := findOverlays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &defaultWorkloadPolicy
+
+	used := make([]bool, len(policy.Exemptions))
+	for _, overlay := range overlays {
+		apps, idx := loadOverlay(t, overlay)
+		t.Run(overlay, func(t *testing.T) {
+			for _, app := range apps {
+				if app.Dir == "" {
+					continue
+				}
+				sub := idx.Source(app.Dir)
+				if sub.Err(app.Dir) != nil {
+					// reported by Overlays
+					continue
+				}
+				t.Run(app.Name, func(t *testing.T) {
+					for _, obj := range sub.All() {
+						spec, err := podSpecOf(obj)
+						if err != nil {
+							t.Error(err)
+							continue
+						}
+						if spec == nil {
+							continue
+						}
+
+					violations:
+						for _, v := range checkPodSpec(spec) {
+							for i := range policy.Exemptions {
+								if policy.Exemptions[i].matches(app.Name, obj, v.Container, v.Rule) {
+									used[i] = true
+									continue violations
+								}
+							}
+							msg := fmt.Sprintf("%s %s/%s: %s: %s", obj.GetKind(), obj.GetNamespace(), obj.GetName(), v.Rule, v.Message)
+							switch {
+							case containsRule(policy.Enforced, v.Rule):
+								t.Error(msg)
+							case containsRule(policy.Reported, v.Rule):
+								t.Log(msg)
+							}
+						}
+					}
+				})
+			}
+		})
+	}
+
+	for i, e := range policy.Exemptions {
+		if e.Reason == "" {
+			t.Errorf("exemption for %s %s in %s has no reason", e.Kind, e.Name, e.App)
+		}
+		if e.Container == "" {
+			for _, r := range e.Rules {
+				if r != ruleHostNetwork && r != ruleHostPath {
+					t.Errorf("exemption for %s %s in %s has no container for %s", e.Kind, e.Name, e.App, r)
+				}
+			}
+		}
+		if !used[i] {
+			t.Errorf("exemption for %s %s in %s is not used; remove it", e.Kind, e.Name, e.App)
+		}
+	}
+}
+
+func TestCheckPodSpec(t *testing.T) {
+	nonRoot := true
+	readOnly := true
+	spec := &corev1.PodSpec{
+		HostNetwork:     true,
+		SecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: &nonRoot},
+		Volumes: []corev1.Volume{
+			{Name: "dev", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/dev"}}},
+			{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+		Containers: []corev1.Container{
+			{
+				Name: "good",
+				SecurityContext: &corev1.SecurityContext{
+					ReadOnlyRootFilesystem: &readOnly,
+					Capabilities:           &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("100m"),
+					corev1.ResourceMemory: resource.MustParse("100Mi"),
+				}},
+			},
+			{Name: "bad", SecurityContext: &corev1.SecurityContext{RunAsUser: new(int64)}},
+		},
+	}
+
+	var actual []string
+	for _, v := range checkPodSpec(spec) {
+		actual = append(actual, fmt.Sprintf("%s: %s", v.Rule, v.Message))
+	}
+	expected := []string{
+		"hostNetwork: uses hostNetwork",
+		"hostPath: volume dev uses hostPath /dev",
+		"runAsNonRoot: container bad runs as root",
+		"readOnlyRootFilesystem: container bad does not set readOnlyRootFilesystem",
+		"dropCapabilities: container bad does not drop ALL capabilities",
+		"resourceRequests: container bad has no cpu request",
+		"resourceRequests: container bad has no memory request",
+	}
+	if !cmp.Equal(actual, expected) {
+		t.Error(cmp.Diff(expected, actual))
+	}
+}